@@ -0,0 +1,306 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	pb "zstdb/pbs"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// The audit log records every Set, Delete, Txn and Admin call as one JSON line
+// in <audit-dir>/audit.log. When it grows over --audit-max-size-mb it is
+// renamed to audit-<time>.log, the newest --audit-keep files are kept.
+var (
+	AuditDir       string
+	AuditMaxSizeMB int64
+	AuditKeep      int
+
+	auditMu   sync.Mutex
+	auditFile *os.File
+	auditSize int64
+)
+
+const auditTimeLayout = "20060102T150405.000000000"
+
+type AuditEntry struct {
+	Time     time.Time `json:"ts"`
+	Op       string    `json:"op"`
+	Peer     string    `json:"peer"`
+	Identity string    `json:"identity,omitempty"`
+	Key      string    `json:"key,omitempty"`
+	Size     int       `json:"size"`
+	Result   string    `json:"result"`
+	Detail   string    `json:"detail,omitempty"`
+}
+
+type ctxKeyAudit struct{}
+
+func isAuditedMethod(fullMethod string) (string, bool) {
+	op := fullMethod[strings.LastIndex(fullMethod, "/")+1:]
+	switch op {
+	case "Set", "Delete", "Admin", "Txn":
+		return op, true
+	}
+	return op, false
+}
+
+// OpenAuditLog opens the audit log, nothing is recorded if --audit-dir is empty.
+func OpenAuditLog() error {
+	if AuditDir == "" {
+		return nil
+	}
+	if err := MakeDirs(AuditDir); err != nil {
+		return err
+	}
+
+	auditMu.Lock()
+	defer auditMu.Unlock()
+	return openAuditFile()
+}
+
+func openAuditFile() error {
+	fp, err := os.OpenFile(filepath.Join(AuditDir, "audit.log"), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	fi, err := fp.Stat()
+	if err != nil {
+		fp.Close()
+		return err
+	}
+	auditFile = fp
+	auditSize = fi.Size()
+	return nil
+}
+
+// CloseAuditLog is called by Shutdown once no rpc is running.
+func CloseAuditLog() {
+	auditMu.Lock()
+	defer auditMu.Unlock()
+	if auditFile != nil {
+		auditFile.Sync()
+		auditFile.Close()
+		auditFile = nil
+	}
+}
+
+// Audit appends e to the audit log.
+func Audit(e *AuditEntry) {
+	b, err := json.Marshal(e)
+	if err != nil {
+		PrintError("Audit", err)
+		return
+	}
+	b = append(b, '\n')
+
+	auditMu.Lock()
+	defer auditMu.Unlock()
+	if auditFile == nil {
+		return
+	}
+
+	if limit := cfg().AuditMaxSizeMB; limit > 0 && auditSize+int64(len(b)) > limit<<20 {
+		if err = rotateAuditFile(); err != nil {
+			PrintError("Audit", err)
+			if auditFile == nil {
+				return
+			}
+		}
+	}
+
+	n, err := auditFile.Write(b)
+	auditSize += int64(n)
+	if err != nil {
+		PrintError("Audit", err)
+	}
+}
+
+func rotateAuditFile() error {
+	auditFile.Close()
+	auditFile = nil
+
+	cur := filepath.Join(AuditDir, "audit.log")
+	rotated := filepath.Join(AuditDir, "audit-"+time.Now().UTC().Format(auditTimeLayout)+".log")
+	if err := os.Rename(cur, rotated); err != nil {
+		openAuditFile()
+		return err
+	}
+
+	if keep := cfg().AuditKeep; keep > 0 {
+		files := rotatedAuditFiles()
+		for len(files) > keep {
+			RemoveFile(files[0])
+			files = files[1:]
+		}
+	}
+	return openAuditFile()
+}
+
+// rotatedAuditFiles are sorted from the oldest.
+func rotatedAuditFiles() []string {
+	files, _ := filepath.Glob(filepath.Join(AuditDir, "audit-*.log"))
+	sort.Strings(files)
+	return files
+}
+
+// AuditNote sets the result of the audited rpc in ctx, e.g. "deduplicated".
+func AuditNote(ctx context.Context, result string) {
+	if e, ok := ctx.Value(ctxKeyAudit{}).(*AuditEntry); ok {
+		e.Result = result
+	}
+}
+
+// AuditInterceptor runs before the rate limiter, so rejected calls are
+// recorded too.
+func AuditInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	op, ok := isAuditedMethod(info.FullMethod)
+	if !ok || AuditDir == "" {
+		return handler(ctx, req)
+	}
+
+	e := &AuditEntry{Time: time.Now().UTC(), Op: op, Peer: PeerAddr(ctx)}
+	e.Identity, _ = identify(ctx)
+	if in, ok := req.(*pb.TxnRequest); ok {
+		var ops []string
+		for _, op := range in.Ops {
+			e.Size += len(op.Data)
+			ops = append(ops, op.Op+":"+string(op.Key))
+		}
+		e.Detail = strings.Join(ops, ",")
+		if len(e.Detail) > 256 {
+			e.Detail = e.Detail[:256]
+		}
+	}
+	if in, ok := req.(*pb.Item); ok {
+		e.Key = string(in.Key)
+		e.Size = len(in.Data)
+		if op == "Admin" {
+			e.Key = strings.ToLower(e.Key)
+			e.Detail = string(in.Data)
+			if len(e.Detail) > 256 {
+				e.Detail = e.Detail[:256]
+			}
+		}
+	}
+
+	resp, err := handler(context.WithValue(ctx, ctxKeyAudit{}, e), req)
+
+	if r, ok := resp.(*pb.ItemReply); ok && err == nil {
+		if op == "Set" && r.Key != nil {
+			// content addressed keys are only known now
+			e.Key = string(r.Key)
+		}
+		if r.Errcode != 0 {
+			e.Result = "error " + Int2Str(int(r.Errcode))
+			if r.Status != nil {
+				e.Result += ": " + string(r.Status)
+			}
+		}
+	}
+	if r, ok := resp.(*pb.TxnReply); ok && err == nil && r.Errcode != 0 {
+		e.Result = "error " + Int2Str(int(r.Errcode)) + ": " + string(r.Status)
+	}
+	if err != nil {
+		e.Result = "error " + status.Code(err).String() + ": " + status.Convert(err).Message()
+	}
+	if e.Result == "" {
+		e.Result = "ok"
+	}
+
+	Audit(e)
+	return resp, err
+}
+
+// QueryAudit returns the entries between since and until, at most limit,
+// from the oldest. Op and key prefix filters are optional.
+func QueryAudit(since, until time.Time, limit int, op, keyPrefix string) ([]AuditEntry, error) {
+	if AuditDir == "" {
+		return nil, NewError("audit log is not enabled, see --audit-dir")
+	}
+	if limit <= 0 {
+		limit = 1000
+	}
+
+	auditMu.Lock()
+	if auditFile != nil {
+		auditFile.Sync()
+	}
+	files := rotatedAuditFiles()
+	auditMu.Unlock()
+	files = append(files, filepath.Join(AuditDir, "audit.log"))
+
+	var entries []AuditEntry
+	for _, f := range files {
+		// a rotated file holds entries older than its rotation time
+		name := filepath.Base(f)
+		if strings.HasPrefix(name, "audit-") && !since.IsZero() {
+			t, err := time.Parse(auditTimeLayout, strings.TrimSuffix(strings.TrimPrefix(name, "audit-"), ".log"))
+			if err == nil && t.Before(since) {
+				continue
+			}
+		}
+
+		done, err := scanAuditFile(f, func(e AuditEntry) bool {
+			if (!since.IsZero() && e.Time.Before(since)) || (!until.IsZero() && e.Time.After(until)) {
+				return true
+			}
+			if (op != "" && !strings.EqualFold(op, e.Op)) || !strings.HasPrefix(e.Key, keyPrefix) {
+				return true
+			}
+			entries = append(entries, e)
+			return len(entries) < limit
+		})
+		if err != nil && !os.IsNotExist(err) {
+			return entries, err
+		}
+		if done {
+			break
+		}
+	}
+	return entries, nil
+}
+
+// scanAuditFile calls f for each entry until it returns false, done tells
+// if it stopped early.
+func scanAuditFile(path string, f func(e AuditEntry) bool) (done bool, err error) {
+	fp, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer fp.Close()
+
+	sc := bufio.NewScanner(fp)
+	sc.Buffer(make([]byte, 64<<10), 1<<20)
+	for sc.Scan() {
+		var e AuditEntry
+		if json.Unmarshal(sc.Bytes(), &e) != nil {
+			continue
+		}
+		if !f(e) {
+			return true, nil
+		}
+	}
+	return false, sc.Err()
+}
+
+// ParseAuditTime accepts RFC3339 or unix seconds, "" is the zero time.
+func ParseAuditTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if sec, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Unix(sec, 0).UTC(), nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
@@ -0,0 +1,432 @@
+package cmd
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	badger "github.com/dgraph-io/badger/v4"
+	"github.com/zeebo/blake3"
+)
+
+// Values larger than --blob-threshold-mb are saved as files outside the LSM,
+// <volume>/blobs/<ab>/<blake3 of the value> (see volume.go, the volume of
+// the data dir is DataDir), and Badger keeps a pointer. With --encryption the
+// blake3 is keyed (see blobNameKey), a plain one would let anyone who can
+// list the files check whether a value they can guess is stored.
+//
+//	[header, codec CodecBlob][file size:8][blake3 hex]
+//
+// The file holds the value encoded like any other (zstd, seekable frames,
+// encryption), so UnZstdBytes and ReadRange only have to follow the pointer.
+// Keys with the same content share a file. \x00zstdb/blobref/<hash> counts
+// the pointers in the same transaction as the Set/Delete, the last Delete
+// queues \x00zstdb/blobgc/<hash> and RunBlobGC removes the file once that
+// is committed. SweepBlobs removes files left by writes that failed.
+var (
+	BlobThresholdMB int64
+
+	// RLock from writing a file until its pointer is committed (or while
+	// files are copied by a backup), Lock to remove files.
+	blobMu sync.RWMutex
+)
+
+// a file without pointer is only swept once it is older than this, a Set
+// may still be writing it
+const blobSweepGrace = time.Hour
+
+func blobPath(dir, hash string) string {
+	return ToUnixSlash(filepath.Join(dir, hash[:2], hash))
+}
+
+func isBlobSize(n int) bool {
+	s := cfg()
+	if len(Volumes) > 0 && s.VolumeMinSizeKB > 0 && int64(n) > s.VolumeMinSizeKB<<10 {
+		return true
+	}
+	return s.BlobThresholdMB > 0 && int64(n) > s.BlobThresholdMB<<20
+}
+
+func blobRefKey(hash string) []byte {
+	return InternalKey("blobref/" + hash)
+}
+
+func blobGCKey(hash string) []byte {
+	return InternalKey("blobgc/" + hash)
+}
+
+// encodeStored is EncodeValueSum, large values become a file and a pointer.
+func encodeStored(raw []byte, p CompressionPolicy, sum64, owner uint64) ([]byte, error) {
+	if isBlobSize(len(raw)) {
+		return encodeBlob(raw, p, sum64, owner)
+	}
+	return EncodeValueSum(raw, p, sum64, owner), nil
+}
+
+// encodeBlob writes raw into its file unless it exists and returns the
+// pointer to store in Badger.
+func encodeBlob(raw []byte, p CompressionPolicy, sum64, owner uint64) ([]byte, error) {
+	hash := blobHash(raw)
+	size, err := storeBlobFile(hash, func() []byte {
+		return EncodeValueSum(raw, p, sum64, 0)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	h := valueHeader{Codec: CodecBlob, Flags: flagMeta, RawLen: uint64(len(raw)), Sum64: sum64, Owner: owner, Mtime: time.Now().Unix()}
+	b := h.AppendTo(make([]byte, 0, valueHeaderSize+8+len(hash)))
+	b = binary.LittleEndian.AppendUint64(b, uint64(size))
+	return append(b, hash...), nil
+}
+
+// blobHash names the file of raw.
+func blobHash(raw []byte) string {
+	key := blobNameKey()
+	if key == nil {
+		return string(SumBlake3(raw))
+	}
+	h, err := blake3.NewKeyed(key)
+	if err != nil {
+		panic(err)
+	}
+	h.Write(raw)
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
+
+// parseBlobPointer reads the payload of a CodecBlob value.
+func parseBlobPointer(payload []byte) (size uint64, hash string, ok bool) {
+	if len(payload) < 8+2 {
+		return 0, "", false
+	}
+	hash = string(payload[8:])
+	if strings.ContainsAny(hash, "/\\.") {
+		return 0, "", false
+	}
+	return binary.LittleEndian.Uint64(payload[:8]), hash, true
+}
+
+// loadBlob returns the stored bytes of the file a pointer refers to.
+func loadBlob(payload []byte) ([]byte, error) {
+	_, hash, ok := parseBlobPointer(payload)
+	if !ok {
+		return nil, NewError("invalid blob pointer")
+	}
+	b, err := readBlobFile(hash)
+	if err != nil {
+		return nil, err
+	}
+	if h, _, ok := parseValueHeader(b); !ok || h.Codec == CodecBlob {
+		return nil, NewError("invalid blob file: " + hash)
+	}
+	return b, nil
+}
+
+// readBlobRange is ReadRange on the file a pointer refers to. Only the
+// header, the seek table and the frames of the range are read from a
+// seekable file, only the range from an uncompressed one; an encrypted or
+// plain zstd file has to be read in full.
+func readBlobRange(payload []byte, offset, length uint64) ([]byte, uint64, error) {
+	_, hash, ok := parseBlobPointer(payload)
+	if !ok {
+		return nil, 0, NewError("invalid blob pointer")
+	}
+	fp, err := openBlobFile(hash)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer fp.Close()
+	fi, err := fp.Stat()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	size := uint64(fi.Size())
+	head := make([]byte, min(size, 2+255))
+	if _, err = fp.ReadAt(head, 0); err != nil {
+		return nil, 0, err
+	}
+	h, rest, ok := parseValueHeader(head)
+	if !ok || h.Codec == CodecBlob || h.Codec == CodecS3 {
+		return nil, 0, NewError("invalid blob file: " + hash)
+	}
+	start := uint64(len(head) - len(rest))
+	readAt := func(off, n uint64) ([]byte, error) {
+		b := make([]byte, n)
+		_, err := fp.ReadAt(b, int64(start+off))
+		return b, err
+	}
+
+	switch {
+	case h.Flags&flagEncrypted != 0:
+	case h.Codec == CodecNone:
+		total := size - start
+		end, err := rangeEnd(offset, length, total)
+		if err != nil {
+			return nil, total, err
+		}
+		b, err := readAt(offset, end-offset)
+		return b, total, err
+	case h.Codec == CodecZstd && h.Flags&flagSeekable != 0:
+		frames, sums, err := readSeekTable(size-start, readAt)
+		if err != nil {
+			return nil, 0, err
+		}
+		return readFrames(h.DictID, frames, sums, offset, length, readAt)
+	}
+
+	b := make([]byte, size)
+	if _, err = fp.ReadAt(b, 0); err != nil {
+		return nil, 0, err
+	}
+	return ReadRange(b, offset, length)
+}
+
+// writeFileSync writes path through a temporary file, so a file which
+// exists is always complete.
+func writeFileSync(path string, b []byte) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	fp, err := os.CreateTemp(dir, ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(fp.Name())
+
+	if _, err = fp.Write(b); err == nil {
+		err = fp.Sync()
+	}
+	if cerr := fp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	if err = os.Rename(fp.Name(), path); err != nil {
+		return err
+	}
+	return syncDir(dir)
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+// blobRef adds d to the pointers of hash inside txn.
+func blobRef(txn *badger.Txn, hash string, d int64) error {
+	k := blobRefKey(hash)
+	var n uint64
+	item, err := txn.Get(k)
+	if err == nil {
+		err = item.Value(func(v []byte) error {
+			if len(v) >= 8 {
+				n = binary.LittleEndian.Uint64(v)
+			}
+			return nil
+		})
+	}
+	if err != nil && err != badger.ErrKeyNotFound {
+		return err
+	}
+
+	n = addDelta(n, d)
+	if n == 0 {
+		if err = txn.Delete(k); err != nil {
+			return err
+		}
+		return txn.Set(blobGCKey(hash), nil)
+	}
+	return txn.Set(k, binary.LittleEndian.AppendUint64(nil, n))
+}
+
+// storedBlob returns the hash if v is a blob pointer.
+func storedBlob(v []byte) (string, bool) {
+	h, payload, ok := parseValueHeader(v)
+	if !ok || h.Codec != CodecBlob {
+		return "", false
+	}
+	_, hash, ok := parseBlobPointer(payload)
+	return hash, ok
+}
+
+// RunBlobGC removes the files queued by the last Delete of their pointer.
+func RunBlobGC(ctx context.Context) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		PrintError("RunBlobGC", removeQueuedBlobs())
+	}
+}
+
+func removeQueuedBlobs() error {
+	var hashes []string
+	prefix := InternalKey("blobgc/")
+	err := bgrdb.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		opts.Prefix = prefix
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		for it.Rewind(); it.Valid() && len(hashes) < 1000; it.Next() {
+			hashes = append(hashes, strings.TrimPrefix(string(it.Item().Key()), string(prefix)))
+		}
+		return nil
+	})
+	if err != nil || len(hashes) == 0 {
+		return err
+	}
+
+	// a backup is copying the files, next time
+	if !blobMu.TryLock() {
+		return nil
+	}
+	defer blobMu.Unlock()
+
+	return badgerUpdate(func(txn *badger.Txn) error {
+		for _, hash := range hashes {
+			// a Set may have pointed to it again
+			_, err := txn.Get(blobRefKey(hash))
+			if err == badger.ErrKeyNotFound {
+				if err = removeBlobFiles(hash); err != nil {
+					return err
+				}
+				DebugInfo("RunBlobGC", "removed ", hash)
+			} else if err != nil {
+				return err
+			}
+			if err = txn.Delete(blobGCKey(hash)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// SweepBlobs removes files no pointer refers to, e.g. written by a Set which
+// failed on its quota, and temporary files of a crash.
+func SweepBlobs() error {
+	if !blobMu.TryLock() {
+		return nil
+	}
+	defer blobMu.Unlock()
+
+	for _, v := range volumeList() {
+		if err := sweepBlobDir(v.blobDir()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func sweepBlobDir(dir string) error {
+	old := time.Now().Add(-blobSweepGrace)
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		fi, err := d.Info()
+		if err != nil || fi.ModTime().After(old) {
+			return nil
+		}
+		if !strings.HasPrefix(d.Name(), ".tmp-") {
+			found := false
+			err = bgrdb.View(func(txn *badger.Txn) error {
+				_, err := txn.Get(blobRefKey(d.Name()))
+				if err == nil {
+					found = true
+				}
+				if err == badger.ErrKeyNotFound {
+					return nil
+				}
+				return err
+			})
+			if err != nil || found {
+				return err
+			}
+		}
+		DebugInfo("SweepBlobs", "removed ", path)
+		return RemoveFile(path)
+	})
+}
+
+// copyBlobs copies the files of src missing in dst, for backup and restore.
+func copyBlobs(src, dst string) (n int, err error) {
+	err = filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() || strings.HasPrefix(d.Name(), ".tmp-") {
+			return nil
+		}
+		target := blobPath(dst, d.Name())
+		if _, err := os.Stat(target); err == nil {
+			return nil
+		}
+		if err := copyFileSync(path, target); err != nil {
+			return err
+		}
+		n++
+		return nil
+	})
+	return n, err
+}
+
+func copyFileSync(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	dir := filepath.Dir(dst)
+	if err = os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	fp, err := os.CreateTemp(dir, ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(fp.Name())
+
+	if _, err = io.Copy(fp, in); err == nil {
+		err = fp.Sync()
+	}
+	if cerr := fp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	if err = os.Rename(fp.Name(), dst); err != nil {
+		return err
+	}
+	return syncDir(dir)
+}
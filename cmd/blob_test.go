@@ -0,0 +1,163 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"os"
+	"testing"
+	"time"
+
+	badger "github.com/dgraph-io/badger/v4"
+)
+
+func TestBlobRange(t *testing.T) {
+	raw := make([]byte, 3<<20)
+	rand.Read(raw[:1<<20])
+	copy(raw[1<<20:], bytes.Repeat([]byte("0123456789abcdef"), 2<<16))
+
+	tests := []struct {
+		name        string
+		compression string
+		encrypted   bool
+	}{
+		{"none", "none", false},
+		{"seekable", "zstd", false},
+		{"encrypted", "zstd", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			openTestDB(t, func(s *Settings) {
+				s.BlobThresholdMB = 1
+				s.SeekableFrameKB = 64
+			})
+			if tt.encrypted {
+				testEncryption(t)
+			}
+			if _, err := badgerPut([]byte("k"), raw, GetXxhash(raw), SaveOptions{Compression: tt.compression}); err != nil {
+				t.Fatal(err)
+			}
+			hash := blobHash(raw)
+			if _, ok := blobFile(hash); !ok {
+				t.Fatal("no blob file")
+			}
+			if named := hash == string(SumBlake3(raw)); named == tt.encrypted {
+				t.Errorf("file named by the plain blake3: %v", named)
+			}
+
+			for _, r := range [][2]uint64{{0, 100}, {1<<20 - 10, 20}, {2 << 20, 1 << 16}, {3<<20 - 5, 0}} {
+				got, _, total, found, err := badgerGetRange(context.Background(), []byte("k"), r[0], r[1])
+				if err != nil || !found {
+					t.Fatalf("%v: found %v, %v", r, found, err)
+				}
+				end, _ := rangeEnd(r[0], r[1], total)
+				if total != uint64(len(raw)) || !bytes.Equal(got, raw[r[0]:end]) {
+					t.Errorf("%v: %d bytes of %d, not the range", r, len(got), total)
+				}
+			}
+		})
+	}
+}
+
+func TestBlobRefs(t *testing.T) {
+	openTestDB(t, func(s *Settings) {
+		s.BlobThresholdMB = 1
+	})
+	raw := bytes.Repeat([]byte("shared content "), 100000)
+	hash := blobHash(raw)
+
+	refs := func() uint64 {
+		var n uint64
+		err := bgrdb.View(func(txn *badger.Txn) error {
+			item, err := txn.Get(blobRefKey(hash))
+			if err == badger.ErrKeyNotFound {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			return item.Value(func(v []byte) error {
+				n = binary.LittleEndian.Uint64(v)
+				return nil
+			})
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+
+	steps := []struct {
+		op       string
+		key      string
+		refs     uint64
+		fileLeft bool
+	}{
+		{"put", "a", 1, true},
+		{"put", "b", 2, true},
+		{"delete", "a", 1, true},
+		{"delete", "b", 0, false},
+	}
+	for _, st := range steps {
+		var err error
+		if st.op == "put" {
+			_, err = badgerPut([]byte(st.key), raw, GetXxhash(raw), SaveOptions{})
+		} else {
+			_, _, err = badgerDelete([]byte(st.key))
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = removeQueuedBlobs(); err != nil {
+			t.Fatal(err)
+		}
+		if n := refs(); n != st.refs {
+			t.Errorf("%s %s: %d refs, want %d", st.op, st.key, n, st.refs)
+		}
+		if _, ok := blobFile(hash); ok != st.fileLeft {
+			t.Errorf("%s %s: file left %v, want %v", st.op, st.key, ok, st.fileLeft)
+		}
+	}
+
+	// a file no pointer refers to, e.g. of a Set which failed
+	orphan := blobPath(volumeList()[0].blobDir(), blobHash([]byte("orphan")))
+	if err := writeFileSync(orphan, []byte("x")); err != nil {
+		t.Fatal(err)
+	}
+	if err := SweepBlobs(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(orphan); err != nil {
+		t.Fatal("a new file was swept")
+	}
+	old := time.Now().Add(-2 * blobSweepGrace)
+	os.Chtimes(orphan, old, old)
+	if err := SweepBlobs(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(orphan); !os.IsNotExist(err) {
+		t.Errorf("orphan file left: %v", err)
+	}
+}
+
+// testEncryption turns encryption on with a random data key until the end
+// of the test.
+func testEncryption(t *testing.T) {
+	key := make([]byte, 32)
+	rand.Read(key)
+	aead, err := newAEAD(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyMu.Lock()
+	prevMaster, prevKeys, prevCurrent, prevName := masterKey, dataKeys, currentKeyID, nameKey
+	masterKey, dataKeys, currentKeyID, nameKey = aead, map[uint32]cipher.AEAD{1: aead}, 1, deriveNameKey(key)
+	keyMu.Unlock()
+	t.Cleanup(func() {
+		keyMu.Lock()
+		masterKey, dataKeys, currentKeyID, nameKey = prevMaster, prevKeys, prevCurrent, prevName
+		keyMu.Unlock()
+	})
+}
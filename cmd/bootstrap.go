@@ -2,9 +2,14 @@ package cmd
 
 import (
 	"path/filepath"
+
+	"github.com/robfig/cron/v3"
 )
 
 func BeforeStart() error {
+	_, err := LoadConfigFile(settingsFlags, false)
+	FatalError("BeforeStart: --config", err)
+
 	DataDir = filepath.ToSlash(GetEnv("zstdb_data", "data/zstdfs"))
 	if AltDataDir != "" {
 		DataDir = AltDataDir
@@ -13,19 +18,191 @@ func BeforeStart() error {
 	DebugInfo("BeforeStart: DataDir", DataDir)
 	MakeDirs(DataDir)
 
-	if MaxUploadSizeMB <= 0 {
-		MaxUploadSizeMB = 16
+	err = ApplyBadgerPreset()
+	FatalError("BeforeStart", err)
+
+	err = ApplySettings()
+	FatalError("BeforeStart", err)
+
+	return nil
+}
+
+// ApplySettings checks and derives the settings which can be reloaded,
+// they take effect only if all are valid.
+func ApplySettings() error {
+	s, err := buildSettings()
+	if err != nil {
+		return err
 	}
+	prev := settings.Swap(s)
+	DebugInfo("MaxUploadSizeMB", s.MaxUploadSizeMB)
 
-	if MaxUploadSizeMB > 1024 {
-		MaxUploadSizeMB = 1024
+	if bgrdb != nil && prev != nil && usageScopes(prev) != usageScopes(s) {
+		// the namespace or client counters are kept only with quotas
+		StartRecount()
 	}
 
-	MaxUploadSize = MaxUploadSizeMB << 20
+	SetupLogging()
+	ResetLimiters(0)
+	ResizeCache()
+	return nil
+}
 
-	DebugInfo("MaxUploadSizeMB", MaxUploadSizeMB)
+// buildSettings reads the flags into Settings, it changes nothing.
+func buildSettings() (*Settings, error) {
+	s := &Settings{
+		IsDebug:          IsDebug,
+		IsAllowOverWrite: IsAllowOverWrite,
+		IsDisableDelete:  IsDisableDelete,
+		IsDisableSet:     IsDisableSet,
+		MaxUploadSizeMB:  MaxUploadSizeMB,
+		AdminPassword:    AdminPassword,
 
-	return nil
+		MinFreeDiskSpaceMB:  MinFreeDiskSpaceMB,
+		DiskSoftFreeMB:      DiskSoftFreeMB,
+		DiskSoftMaxUploadMB: DiskSoftMaxUploadMB,
+		DiskReserveMB:       DiskReserveMB,
+		VolumePlacement:     VolumePlacement,
+		VolumeMinSizeKB:     VolumeMinSizeKB,
+
+		AutoBackupDir:         AutoBackupDir,
+		AutoBackupEvery:       AutoBackupEvery,
+		EncryptionRotateEvery: EncryptionRotateEvery,
+		ScrubEvery:            ScrubEvery,
+		ScrubRateMB:           ScrubRateMB,
+		ScrubAction:           ScrubAction,
+
+		CompressionMinRatio: CompressionMinRatio,
+		SeekableFrameKB:     SeekableFrameKB,
+		BlobThresholdMB:     BlobThresholdMB,
+		CacheSizeMB:         CacheSizeMB,
+
+		LogFormat:      LogFormat,
+		LogLevel:       LogLevel,
+		LogFileLevel:   LogFileLevel,
+		LogMaxSizeMB:   LogMaxSizeMB,
+		LogRotateEvery: LogRotateEvery,
+		LogKeep:        LogKeep,
+		AuditMaxSizeMB: AuditMaxSizeMB,
+		AuditKeep:      AuditKeep,
+
+		ShutdownTimeout:   ShutdownTimeout,
+		Durability:        Durability,
+		GroupCommitWindow: GroupCommitWindow,
+
+		RateLimitRPS:   RateLimitRPS,
+		RateLimitBurst: RateLimitBurst,
+		RateLimitBPS:   RateLimitBPS,
+
+		WatchRetention:     WatchRetention,
+		WatchBuffer:        WatchBuffer,
+		WebhookSecret:      WebhookSecret,
+		WebhookMaxAttempts: WebhookMaxAttempts,
+		WebhookTimeout:     WebhookTimeout,
+
+		S3Endpoint:       S3Endpoint,
+		S3Bucket:         S3Bucket,
+		S3Region:         S3Region,
+		S3AccessKey:      S3AccessKey,
+		S3SecretKey:      S3SecretKey,
+		S3Prefix:         S3Prefix,
+		S3Timeout:        S3Timeout,
+		OffloadAfter:     OffloadAfter,
+		OffloadMinSizeKB: OffloadMinSizeKB,
+		S3Rewarm:         S3Rewarm,
+
+		GCInterval:             GCInterval,
+		GCDiscardRatio:         GCDiscardRatio,
+		GCPressureDiscardRatio: GCPressureDiscardRatio,
+		GCBusyRPS:              GCBusyRPS,
+	}
+
+	if s.MaxUploadSizeMB <= 0 {
+		s.MaxUploadSizeMB = 16
+	}
+
+	// a value must fit in a value log file, leaving room for a compressed
+	// value larger than the raw one; larger ones only fit in blob files, up
+	// to the 2GB limit of a protobuf message
+	vlogLimitMB := max(1, min(1024, BadgerValueLogFileSizeMB*9/10))
+	maxUploadSizeMB := vlogLimitMB
+	if s.BlobThresholdMB > 0 && s.BlobThresholdMB < vlogLimitMB {
+		maxUploadSizeMB = 2047
+	}
+	if len(Volumes) > 0 && s.VolumeMinSizeKB > 0 && s.VolumeMinSizeKB < vlogLimitMB<<10 {
+		maxUploadSizeMB = 2047
+	}
+	if len(Volumes) > 0 && s.BlobThresholdMB <= 0 && s.VolumeMinSizeKB <= 0 {
+		DebugWarn("buildSettings", "--volume holds blob files only, none is written without --blob-threshold-mb or --volume-min-size-kb")
+	}
+	if s.MaxUploadSizeMB > maxUploadSizeMB {
+		s.MaxUploadSizeMB = maxUploadSizeMB
+	}
+	s.MaxUploadSize = s.MaxUploadSizeMB << 20
+
+	if s.CompressionMinRatio <= 0 || s.CompressionMinRatio > 1 {
+		s.CompressionMinRatio = 0.97
+	}
+
+	if s.AutoBackupEvery != "" {
+		if _, err := cron.ParseStandard(s.AutoBackupEvery); err != nil {
+			PrintError("StartCron,--auto-backup-every= invalid, will use default", err)
+			s.AutoBackupEvery = "@every 1h"
+		}
+	}
+	for name, spec := range map[string]string{"encryption-rotate-every": s.EncryptionRotateEvery, "scrub-every": s.ScrubEvery} {
+		if spec == "" {
+			continue
+		}
+		if _, err := cron.ParseStandard(spec); err != nil {
+			return nil, NewError("--" + name + " invalid: " + err.Error())
+		}
+	}
+
+	if _, _, err := logLevels(s); err != nil {
+		return nil, err
+	}
+	if s.LogFormat != "" && s.LogFormat != "text" && s.LogFormat != "json" {
+		return nil, NewError("--log-format must be text or json: " + s.LogFormat)
+	}
+
+	err := checkDurability(s.Durability)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = checkScrubAction(s.ScrubAction); err != nil {
+		return nil, err
+	}
+
+	if s.gcWindows, err = checkGCSettings(s.GCDiscardRatio, s.GCPressureDiscardRatio, GCWindows); err != nil {
+		return nil, err
+	}
+
+	if err = checkVolumePlacement(s.VolumePlacement); err != nil {
+		return nil, err
+	}
+
+	if s.authTokens, err = parseAuthTokens(AuthTokens); err != nil {
+		return nil, err
+	}
+
+	if s.namespaceQuotas, err = parseQuotas(QuotaNamespaces); err != nil {
+		return nil, err
+	}
+	if s.clientQuotas, err = parseQuotas(QuotaClients); err != nil {
+		return nil, err
+	}
+
+	if s.webhooks, err = parseWebhooks(Webhooks, s.WebhookSecret); err != nil {
+		return nil, err
+	}
+
+	s.compressionDefault, s.compressionRules, err = parseCompressionRules(CompressionDefault, CompressionPrefixes)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
 }
 
 func BeforeGrpcStart() error {
@@ -33,5 +210,24 @@ func BeforeGrpcStart() error {
 	bgrdb = badgerConnect()
 	DebugInfo("Max Version", bgrdb.MaxVersion())
 
+	err := LoadEncryptionKeys()
+	FatalError("BeforeGrpcStart", err)
+
+	err = LoadDicts()
+	FatalError("BeforeGrpcStart", err)
+
+	err = LoadVolumes()
+	FatalError("BeforeGrpcStart", err)
+
+	err = OpenAuditLog()
+	FatalError("BeforeGrpcStart", err)
+
+	err = LoadJobs()
+	FatalError("BeforeGrpcStart", err)
+	ResumeVolumeDrains()
+
+	err = StartRecountIfMissing()
+	FatalError("BeforeGrpcStart", err)
+
 	return nil
 }
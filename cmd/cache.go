@@ -0,0 +1,168 @@
+package cmd
+
+import (
+	"container/list"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// The value cache keeps decompressed values of Get in memory, least recently
+// used first out, bounded by --cache-size-mb. Writers invalidate a key after
+// their commit; a Get that read the db before such an invalidation does not
+// fill the cache, see cacheFill.
+var (
+	CacheSizeMB int64
+
+	valueCache = &lruCache{items: make(map[string]*list.Element), order: list.New()}
+)
+
+// a value larger than capacity/cacheMaxItemShare is not cached
+const cacheMaxItemShare = 16
+
+type cacheEntry struct {
+	key   string
+	val   []byte
+	ver   uint64
+	sum64 uint64
+}
+
+type lruCache struct {
+	mu       sync.Mutex
+	capacity int64
+	size     int64
+	items    map[string]*list.Element
+	order    *list.List
+
+	// generations of invalidations, striped by key hash
+	gens [256]atomic.Uint64
+
+	hits      atomic.Uint64
+	misses    atomic.Uint64
+	evictions atomic.Uint64
+}
+
+// ResizeCache applies --cache-size-mb, 0 disables and empties the cache.
+func ResizeCache() {
+	c := valueCache
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.capacity = cfg().CacheSizeMB << 20
+	c.evict()
+}
+
+func (c *lruCache) enabled() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.capacity > 0
+}
+
+func (c *lruCache) gen(key []byte) *atomic.Uint64 {
+	return &c.gens[GetXxhash(key)%uint64(len(c.gens))]
+}
+
+// cacheGet returns the cached value of key, gen must be passed to cacheFill
+// after a miss.
+func cacheGet(key []byte) (e *cacheEntry, gen uint64) {
+	c := valueCache
+	if !c.enabled() {
+		return nil, 0
+	}
+	gen = c.gen(key).Load()
+
+	c.mu.Lock()
+	el, ok := c.items[string(key)]
+	if ok {
+		c.order.MoveToFront(el)
+		e = el.Value.(*cacheEntry)
+	}
+	c.mu.Unlock()
+
+	if ok {
+		c.hits.Add(1)
+	} else {
+		c.misses.Add(1)
+	}
+	return e, gen
+}
+
+// cacheFill stores a value read from the db, unless key was invalidated
+// since cacheGet returned gen.
+func cacheFill(key, val []byte, ver, sum64, gen uint64) {
+	c := valueCache
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := int64(len(key) + len(val))
+	if c.capacity <= 0 || n > c.capacity/cacheMaxItemShare {
+		return
+	}
+	if c.gen(key).Load() != gen {
+		return
+	}
+	if el, ok := c.items[string(key)]; ok {
+		c.remove(el)
+	}
+	c.items[string(key)] = c.order.PushFront(&cacheEntry{key: string(key), val: val, ver: ver, sum64: sum64})
+	c.size += n
+	c.evict()
+}
+
+// CacheInvalidate is called after a commit that changed keys.
+func CacheInvalidate(keys ...[]byte) {
+	c := valueCache
+	for _, k := range keys {
+		c.gen(k).Add(1)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, k := range keys {
+		if el, ok := c.items[string(k)]; ok {
+			c.remove(el)
+		}
+	}
+}
+
+// CacheInvalidatePrefix drops every key with prefix, "" drops all.
+func CacheInvalidatePrefix(prefix string) {
+	c := valueCache
+	for i := range c.gens {
+		c.gens[i].Add(1)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for k, el := range c.items {
+		if strings.HasPrefix(k, prefix) {
+			c.remove(el)
+		}
+	}
+}
+
+// remove and evict are called with mu held.
+func (c *lruCache) remove(el *list.Element) {
+	e := c.order.Remove(el).(*cacheEntry)
+	delete(c.items, e.key)
+	c.size -= int64(len(e.key) + len(e.val))
+}
+
+func (c *lruCache) evict() {
+	for c.size > c.capacity && c.order.Len() > 0 {
+		c.remove(c.order.Back())
+		c.evictions.Add(1)
+	}
+}
+
+// CacheStats is shown in Admin status.
+func CacheStats() map[string]string {
+	c := valueCache
+	c.mu.Lock()
+	m := map[string]string{
+		"cache_capacity": Int64ToString(c.capacity),
+		"cache_bytes":    Int64ToString(c.size),
+		"cache_entries":  Int2Str(len(c.items)),
+	}
+	c.mu.Unlock()
+	m["cache_hits"] = Uint64ToString(c.hits.Load())
+	m["cache_misses"] = Uint64ToString(c.misses.Load())
+	m["cache_evictions"] = Uint64ToString(c.evictions.Load())
+	return m
+}
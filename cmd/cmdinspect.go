@@ -0,0 +1,365 @@
+package cmd
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	badger "github.com/dgraph-io/badger/v4"
+	humanize "github.com/dustin/go-humanize"
+	"github.com/spf13/cobra"
+)
+
+var (
+	inspectDepth        int
+	inspectTop          int
+	inspectSample       int
+	inspectExportKey    string
+	inspectExportPrefix string
+	inspectExportDir    string
+)
+
+// inspectCmd reads the fbin directory without the server. Badger is
+// opened read-only, the server must be stopped as it holds the directory
+// lock. A read-only open fails when a write-ahead log ends with a partial
+// write, e.g. after a crash, then inspect opens a scratch copy writable,
+// which cuts it like a start of the server would, and the directory is
+// left as it is. What keeps the server from opening the directory (a
+// corrupt table or MANIFEST) keeps inspect from opening it too.
+var inspectCmd = &cobra.Command{
+	Use:   "inspect",
+	Short: "print the layout and contents of the database, or export keys, without the server",
+	Long:  ``,
+	Run: func(cmd *cobra.Command, args []string) {
+		db, err := openOffline(badgerDir(), true)
+		if truncateNeeded(err) {
+			fmt.Println("the write-ahead log ends with a partial write, reading a scratch copy where it is cut")
+			var scratch string
+			scratch, err = os.MkdirTemp(filepath.Dir(badgerDir()), ".inspect-")
+			FatalError("inspect", err)
+			defer os.RemoveAll(scratch)
+			if _, err = copyBadgerFiles(badgerDir(), scratch, true); err == nil {
+				db, err = openOffline(scratch, false)
+			}
+		}
+		FatalError("inspect", err)
+		defer db.Close()
+
+		if inspectExportKey != "" || inspectExportPrefix != "" {
+			FatalError("inspect", exportKeys(unescapeArg(inspectExportKey), unescapeArg(inspectExportPrefix), inspectExportDir))
+			return
+		}
+		printLayout(db)
+		FatalError("inspect", printKeys(db))
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(inspectCmd)
+
+	inspectCmd.Flags().IntVar(&inspectDepth, "depth", 1, "count keys by their first n path segments")
+	inspectCmd.Flags().IntVar(&inspectTop, "top", 10, "list the n largest values")
+	inspectCmd.Flags().IntVar(&inspectSample, "sample", 20, "decode and verify n values spread over all keys")
+	inspectCmd.Flags().StringVar(&inspectExportKey, "export-key", "", "write the value of this key into --export-dir")
+	inspectCmd.Flags().StringVar(&inspectExportPrefix, "export-prefix", "",
+		"write the values of the keys with this prefix into --export-dir, Go escapes like \\x00 are read")
+	inspectCmd.Flags().StringVar(&inspectExportDir, "export-dir", "export", "directory for --export-key and --export-prefix")
+}
+
+// truncateNeeded tells if Badger refused a read-only open for a partial
+// write, its error does not wrap badger.ErrTruncateNeeded.
+func truncateNeeded(err error) bool {
+	return err != nil && strings.Contains(err.Error(), badger.ErrTruncateNeeded.Error())
+}
+
+// openOffline opens datadir, the fbin directory or a copy of it, with the
+// options of the server and loads what decoding values needs.
+func openOffline(datadir string, readOnly bool) (*badger.DB, error) {
+	if _, err := os.Stat(filepath.Join(datadir, badger.ManifestFilename)); err != nil {
+		return nil, err
+	}
+	opts := badgerOptions(datadir)
+	opts.ReadOnly = readOnly
+	opts.Logger = nil
+	if readOnly {
+		opts.CompactL0OnClose = false
+	}
+	db, err := badger.Open(opts)
+	if err != nil {
+		return nil, err
+	}
+	bgrdb = db
+
+	// a read-only db cannot save a new data key, values still decode
+	if err = LoadEncryptionKeys(); err != nil {
+		PrintError("openOffline", err)
+	}
+	if err = LoadDicts(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if err = LoadVolumes(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+func printLayout(db *badger.DB) {
+	lsm, vlog := db.Size()
+	fmt.Printf("data dir: %s\n", badgerDir())
+	fmt.Printf("lsm: %s, vlog: %s, max version: %d\n\n", humanize.IBytes(uint64(lsm)), humanize.IBytes(uint64(vlog)), db.MaxVersion())
+
+	fmt.Println("level  tables        size      target       stale   score")
+	for _, l := range db.Levels() {
+		fmt.Printf("%5d  %6d  %10s  %10s  %10s  %6.2f\n", l.Level, l.NumTables,
+			humanize.IBytes(uint64(l.Size)), humanize.IBytes(uint64(l.TargetSize)), humanize.IBytes(uint64(l.StaleDatSize)), l.Score)
+	}
+
+	entries, err := os.ReadDir(badgerDir())
+	if err != nil {
+		PrintError("inspect", err)
+		return
+	}
+	fmt.Println("\nfiles:")
+	for _, e := range entries {
+		ext := filepath.Ext(e.Name())
+		if ext == ".sst" {
+			continue
+		}
+		if info, err := e.Info(); err == nil {
+			fmt.Printf("  %-24s %10s\n", e.Name(), humanize.IBytes(uint64(info.Size())))
+		}
+	}
+	fmt.Printf("  %-24s %10d\n", "*.sst", len(db.Tables()))
+}
+
+type prefixStats struct {
+	keys  uint64
+	bytes int64
+}
+
+type largeValue struct {
+	key  []byte
+	ver  uint64
+	size int64
+}
+
+func printKeys(db *badger.DB) error {
+	prefixes := make(map[string]*prefixStats)
+	var top []largeValue
+	var keys, minVer, maxVer uint64
+
+	err := db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			item := it.Item()
+			p := keyGroup(item.Key(), inspectDepth)
+			if prefixes[p] == nil {
+				prefixes[p] = &prefixStats{}
+			}
+			prefixes[p].keys++
+			prefixes[p].bytes += item.ValueSize()
+			if IsInternalKey(item.Key()) {
+				continue
+			}
+
+			keys++
+			if v := item.Version(); minVer == 0 || v < minVer {
+				minVer = v
+			}
+			maxVer = max(maxVer, item.Version())
+			if size := item.ValueSize(); inspectTop > 0 && (len(top) < inspectTop || size > top[len(top)-1].size) {
+				i := sort.Search(len(top), func(i int) bool { return top[i].size < size })
+				top = append(top[:i], append([]largeValue{{item.KeyCopy(nil), item.Version(), size}}, top[i:]...)...)
+				if len(top) > inspectTop {
+					top = top[:inspectTop]
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("\nkeys: %d, versions: %d - %d\n", keys, minVer, maxVer)
+	names := make([]string, 0, len(prefixes))
+	for p := range prefixes {
+		names = append(names, p)
+	}
+	sort.Strings(names)
+	fmt.Println("\nprefix                                keys      stored")
+	for _, p := range names {
+		fmt.Printf("  %-32q %10d  %10s\n", p, prefixes[p].keys, humanize.IBytes(uint64(prefixes[p].bytes)))
+	}
+
+	fmt.Println("\nlargest values:")
+	err = db.View(func(txn *badger.Txn) error {
+		for _, lv := range top {
+			item, err := txn.Get(lv.key)
+			if err != nil {
+				fmt.Printf("  %q: %v\n", lv.key, err)
+				continue
+			}
+			err = item.Value(func(v []byte) error {
+				h, stored, raw := valueSizes(v)
+				fmt.Printf("  %-40q ver %d, codec %d, stored %s, raw %s\n", lv.key, lv.ver, h.Codec, humanize.IBytes(stored), humanize.IBytes(raw))
+				return nil
+			})
+			if err != nil {
+				fmt.Printf("  %q: %v\n", lv.key, err)
+			}
+		}
+		return nil
+	})
+	if err != nil || inspectSample <= 0 || keys == 0 {
+		return err
+	}
+	return sampleValues(db, keys)
+}
+
+// sampleValues decodes inspectSample values spread over the keys and checks
+// them like the scrubber.
+func sampleValues(db *badger.DB, keys uint64) error {
+	every := max(keys/uint64(inspectSample), 1)
+	var checked, failed, skipped int
+	fmt.Println("\nsampled values:")
+	err := db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		n := uint64(0)
+		for it.Rewind(); it.Valid() && checked < inspectSample; it.Next() {
+			item := it.Item()
+			if IsInternalKey(item.Key()) {
+				continue
+			}
+			if n++; (n-1)%every != 0 {
+				continue
+			}
+			checked++
+			var skip bool
+			err := item.Value(func(v []byte) error {
+				var err error
+				_, skip, err = checkValue(item.Key(), v)
+				return err
+			})
+			switch {
+			case err != nil:
+				failed++
+				fmt.Printf("  %q ver %d: %v\n", item.Key(), item.Version(), err)
+			case skip:
+				skipped++
+			}
+		}
+		return nil
+	})
+	fmt.Printf("  checked %d, failed %d, offloaded (not fetched) %d\n", checked, failed, skipped)
+	return err
+}
+
+// keyGroup is the first depth segments of key, internal keys are grouped by
+// their kind.
+func keyGroup(key []byte, depth int) string {
+	k := string(key)
+	if IsInternalKey(key) {
+		rest := strings.TrimPrefix(k, string(InternalKey("")))
+		kind, _, _ := strings.Cut(rest, "/")
+		return string(InternalKey(kind + "/"))
+	}
+	end := 0
+	for i := 0; i < depth; i++ {
+		j := strings.IndexByte(k[end:], '/')
+		if j < 0 {
+			break
+		}
+		end += j + 1
+	}
+	if end == 0 {
+		return "(no prefix)"
+	}
+	return k[:end]
+}
+
+// exportKeys writes the decoded value of key, or of every key under prefix,
+// into dir. A value which does not decode is written as stored, with
+// ".stored" appended to its name.
+func exportKeys(key, prefix, dir string) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	var n, failed int
+	err := bgrdb.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		p := []byte(prefix)
+		if key != "" {
+			p = []byte(key)
+		}
+		for it.Seek(p); it.ValidForPrefix(p); it.Next() {
+			item := it.Item()
+			if key != "" && string(item.Key()) != key {
+				break
+			}
+			v, err := item.ValueCopy(nil)
+			if err != nil {
+				fmt.Printf("%q: %v\n", item.Key(), err)
+				failed++
+				continue
+			}
+			name := filepath.Join(dir, exportName(item.Key()))
+			out, err := UnZstdBytes(v)
+			if IsInternalKey(item.Key()) {
+				out, err = v, nil
+			}
+			if err != nil {
+				fmt.Printf("%q: %v, written as stored\n", item.Key(), err)
+				failed++
+				out, name = v, name+".stored"
+			}
+			if err = os.WriteFile(name, out, 0600); err != nil {
+				return err
+			}
+			n++
+		}
+		return nil
+	})
+	fmt.Printf("exported %d keys into %s, %d did not decode\n", n, dir, failed)
+	if err == nil && n == 0 {
+		err = NewError("no key found")
+	}
+	return err
+}
+
+// unescapeArg reads Go escapes, a command line cannot hold the \x00 of the
+// internal keys.
+func unescapeArg(s string) string {
+	if !strings.Contains(s, "\\") {
+		return s
+	}
+	if u, err := strconv.Unquote(`"` + s + `"`); err == nil {
+		return u
+	}
+	return s
+}
+
+// exportName is key as a file name, "/" and other unsafe bytes escaped.
+func exportName(key []byte) string {
+	name := url.PathEscape(string(key))
+	if strings.HasPrefix(name, ".") {
+		name = "%2E" + name[1:]
+	}
+	return name
+}
@@ -0,0 +1,178 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	repairTruncate bool
+	repairFlatten  bool
+	repairYes      bool
+)
+
+// repairCmd recovers the fbin directory without the server. Without flags
+// it only verifies the table checksums.
+//
+// --truncate opens the db writable. Badger v4 then cuts the write-ahead logs
+// (*.mem) and the last value log at their first partial write, the entries
+// after it are lost; the server does the same when it starts, so --truncate
+// is the same recovery done offline, after the files it changes were copied
+// to <fbin>.repair-<unix time>, and with the usage counters dropped. It
+// cannot recover a corrupt entry in the middle of a value log, a corrupt
+// table or MANIFEST: restore a backup, and export what is still readable
+// with inspect first. --flatten compacts all levels into one.
+var repairCmd = &cobra.Command{
+	Use:   "repair",
+	Short: "verify the database, or recover it with --truncate and --flatten, without the server",
+	Long:  ``,
+	Run: func(cmd *cobra.Command, args []string) {
+		if !repairTruncate && !repairFlatten {
+			db, err := openOffline(badgerDir(), true)
+			FatalError("repair", err)
+			defer db.Close()
+			fmt.Println("verifying table checksums ...")
+			FatalError("repair", db.VerifyChecksum())
+			fmt.Println("ok")
+			return
+		}
+
+		fmt.Printf("repair %s:\n", badgerDir())
+		if repairTruncate {
+			fmt.Println("  --truncate: entries after the first partial write of the logs are lost, as when the server starts")
+		}
+		if repairFlatten {
+			fmt.Println("  --flatten: rewrites all tables into one level")
+		}
+		fmt.Println("stop the server first.")
+		if !repairYes && !confirm("type yes to continue: ") {
+			fmt.Println("cancelled")
+			return
+		}
+
+		if repairTruncate {
+			saved := badgerDir() + ".repair-" + Int64ToString(time.Now().Unix())
+			n, err := copyBadgerFiles(badgerDir(), saved, false)
+			FatalError("repair", err)
+			fmt.Printf("  %d files the open may change are copied to %s\n", n, saved)
+		}
+		db, err := openOffline(badgerDir(), false)
+		FatalError("repair", err)
+		defer db.Close()
+
+		if repairTruncate {
+			// the counters may count lost entries, the next start recounts
+			FatalError("repair", db.DropPrefix(InternalKey("usage")))
+		}
+		if repairFlatten {
+			fmt.Println("flattening ...")
+			FatalError("repair", db.Flatten(badgerOptions(badgerDir()).NumCompactors))
+		}
+		fmt.Println("done")
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(repairCmd)
+
+	repairCmd.Flags().BoolVar(&repairTruncate, "truncate", false, "copy the logs aside, then open the database writable, which truncates partial writes at the end of the logs")
+	repairCmd.Flags().BoolVar(&repairFlatten, "flatten", false, "compact all levels into one")
+	repairCmd.Flags().BoolVar(&repairYes, "yes", false, "do not ask for confirmation")
+}
+
+func confirm(prompt string) bool {
+	fmt.Print(prompt)
+	line, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	return strings.TrimSpace(line) == "yes"
+}
+
+// copyBadgerFiles copies to dst the files of the Badger directory src
+// which a writable open changes in place: the write-ahead logs, the last
+// value log, MANIFEST and the like. With link the tables and the other value
+// logs, which an open does not change, are hard linked (or copied), so dst
+// can be opened itself.
+func copyBadgerFiles(src, dst string, link bool) (n int, err error) {
+	entries, err := os.ReadDir(src)
+	if err != nil {
+		return 0, err
+	}
+	var lastVlog string
+	for _, e := range entries {
+		if filepath.Ext(e.Name()) == ".vlog" && e.Name() > lastVlog {
+			lastVlog = e.Name()
+		}
+	}
+	if err = os.MkdirAll(dst, 0700); err != nil {
+		return 0, err
+	}
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || name == "LOCK" {
+			continue
+		}
+		from, to := filepath.Join(src, name), filepath.Join(dst, name)
+		if ext := filepath.Ext(name); ext == ".sst" || (ext == ".vlog" && name != lastVlog) {
+			if !link {
+				continue
+			}
+			if os.Link(from, to) == nil {
+				continue
+			}
+		}
+		if err = copySparse(from, to); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+// copySparse copies src to dst with holes for the zero blocks, the logs
+// are preallocated and mostly zeros after a crash.
+func copySparse(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	buf := make([]byte, 1<<20)
+	var size int64
+	for {
+		n, rerr := io.ReadFull(in, buf)
+		if n > 0 {
+			if bytes.Count(buf[:n], []byte{0}) == n {
+				_, err = out.Seek(int64(n), io.SeekCurrent)
+			} else {
+				_, err = out.Write(buf[:n])
+			}
+			if err != nil {
+				return err
+			}
+			size += int64(n)
+		}
+		if rerr == io.EOF || rerr == io.ErrUnexpectedEOF {
+			break
+		}
+		if rerr != nil {
+			return rerr
+		}
+	}
+	if err = out.Truncate(size); err != nil {
+		return err
+	}
+	return out.Sync()
+}
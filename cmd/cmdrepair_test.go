@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	badger "github.com/dgraph-io/badger/v4"
+)
+
+func TestCopyBadgerFiles(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "fbin")
+	opts := func(dir string) badger.Options {
+		return badger.DefaultOptions(dir).WithLogger(nil).WithMemTableSize(8 << 20).WithValueLogFileSize(1 << 20)
+	}
+	db, err := badger.Open(opts(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// left open, as by a crash: the write-ahead log is preallocated and ends
+	// with zeros
+	t.Cleanup(func() { db.Close() })
+	err = db.Update(func(txn *badger.Txn) error {
+		return txn.Set([]byte("k"), []byte("v"))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	saved := filepath.Join(dir, "saved")
+	n, err := copyBadgerFiles(src, saved, false)
+	if err != nil || n == 0 {
+		t.Fatalf("%d files: %v", n, err)
+	}
+	if files, _ := filepath.Glob(filepath.Join(saved, "*.sst")); len(files) != 0 {
+		t.Errorf("tables copied without link: %v", files)
+	}
+	if _, err := os.Stat(filepath.Join(saved, "LOCK")); err == nil {
+		t.Error("LOCK copied")
+	}
+
+	scratch := filepath.Join(dir, "scratch")
+	if _, err = copyBadgerFiles(src, scratch, true); err != nil {
+		t.Fatal(err)
+	}
+	ro, err := badger.Open(opts(scratch).WithReadOnly(true))
+	if err == nil {
+		ro.Close()
+	}
+	if !truncateNeeded(err) {
+		t.Fatalf("read-only open: %v", err)
+	}
+	rw, err := badger.Open(opts(scratch))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rw.Close()
+	err = rw.View(func(txn *badger.Txn) error {
+		_, err := txn.Get([]byte("k"))
+		return err
+	})
+	if err != nil {
+		t.Errorf("key of the cut log: %v", err)
+	}
+}
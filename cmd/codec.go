@@ -0,0 +1,400 @@
+package cmd
+
+import (
+	"encoding/binary"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/klauspost/compress"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Every value written by zstdb starts with a small header so that
+// UnZstdBytes knows how the payload was encoded:
+//
+//	[valueMagic][header length][codec][flags][dict id:4][raw length:8][xxhash:8][key id:4][owner:8][mtime:8]
+//
+// The header length counts the bytes after itself, new fields are appended
+// to the end and readers treat missing fields as zero. Values written before
+// the header existed are bare zstd frames, which never start with valueMagic.
+//
+// raw length and xxhash describe the uncompressed value, so Exists and the
+// metadata of Get need no decompression. flagMeta tells they are present.
+//
+// With flagEncrypted the payload is nonce + AES-GCM(compressed payload)
+// sealed with data key <key id>, the header is the additional data.
+//
+// owner is the OwnerID of the client which wrote the value, for quotas.
+// mtime is the unix time it was written, 0 for older values.
+//
+// With flagSeekable the zstd payload is made of independent frames plus a
+// seek table, see seekable.go. CodecBlob values only point to a file, see
+// blob.go, CodecS3 values to an object, see offload.go.
+const (
+	valueMagic byte = 0xDB
+
+	CodecNone byte = 0
+	CodecZstd byte = 1
+	CodecBlob byte = 2
+	CodecS3   byte = 3
+
+	flagMeta      byte = 1 << 0
+	flagEncrypted byte = 1 << 1
+	flagSeekable  byte = 1 << 2
+)
+
+type valueHeader struct {
+	Codec  byte
+	Flags  byte
+	DictID uint32
+	RawLen uint64
+	Sum64  uint64
+	KeyID  uint32
+	Owner  uint64
+	Mtime  int64
+}
+
+// CompressionPolicy decides how a value is encoded before it is saved.
+type CompressionPolicy struct {
+	Codec  byte
+	Level  int
+	Auto   bool
+	DictID uint32
+}
+
+var (
+	CompressionDefault  string
+	CompressionPrefixes []string
+	CompressionMinRatio float64
+)
+
+type compressionRule struct {
+	prefix string
+	policy CompressionPolicy
+}
+
+// ParseCompression accepts "none", "zstd", "zstd:<level>", "auto" or "auto:<level>".
+// "auto" compresses with zstd but keeps the raw bytes if the ratio is poor.
+func ParseCompression(s string) (CompressionPolicy, error) {
+	p := CompressionPolicy{Codec: CodecZstd}
+	name, level, hasLevel := strings.Cut(strings.ToLower(strings.TrimSpace(s)), ":")
+	switch name {
+	case "none":
+		p.Codec = CodecNone
+		if hasLevel {
+			return p, NewError("compression none does not take a level")
+		}
+		return p, nil
+	case "zstd", "":
+	case "auto":
+		p.Auto = true
+	default:
+		return p, NewError("unknown compression: " + s)
+	}
+
+	if hasLevel {
+		p.Level = Str2Int(level)
+		if p.Level < 1 || p.Level > 22 {
+			return p, NewError("zstd level must be 1~22: " + s)
+		}
+	}
+	return p, nil
+}
+
+func (p CompressionPolicy) String() string {
+	if p.Codec == CodecNone {
+		return "none"
+	}
+	name := "zstd"
+	if p.Auto {
+		name = "auto"
+	}
+	if p.Level > 0 {
+		return strings.Join([]string{name, Int2Str(p.Level)}, ":")
+	}
+	return name
+}
+
+// parseCompressionRules parses --compression and --compression-prefix.
+func parseCompressionRules(def string, prefixes []string) (CompressionPolicy, []compressionRule, error) {
+	p, err := ParseCompression(def)
+	if err != nil {
+		return p, nil, err
+	}
+
+	var rules []compressionRule
+	for _, rule := range prefixes {
+		prefix, spec, ok := strings.Cut(rule, "=")
+		if !ok {
+			return p, nil, NewError("--compression-prefix must be prefix=codec: " + rule)
+		}
+		rp, err := ParseCompression(spec)
+		if err != nil {
+			return p, nil, err
+		}
+		rules = append(rules, compressionRule{prefix: prefix, policy: rp})
+	}
+	// longest prefix wins
+	sort.SliceStable(rules, func(i, j int) bool {
+		return len(rules[i].prefix) > len(rules[j].prefix)
+	})
+	return p, rules, nil
+}
+
+// CompressionFor picks the policy for key, a non-empty override
+// (from the request) takes precedence over the namespace rules.
+// A trained dictionary assigned to the key's prefix is used with zstd.
+func CompressionFor(key []byte, override string) (CompressionPolicy, error) {
+	p, err := compressionPolicyFor(key, override)
+	if err != nil {
+		return p, err
+	}
+	if p.Codec == CodecZstd {
+		p.DictID, _ = DictFor(key)
+	}
+	return p, nil
+}
+
+func compressionPolicyFor(key []byte, override string) (CompressionPolicy, error) {
+	if override != "" {
+		return ParseCompression(override)
+	}
+	s := cfg()
+	for _, rule := range s.compressionRules {
+		if strings.HasPrefix(string(key), rule.prefix) {
+			return rule.policy, nil
+		}
+	}
+	return s.compressionDefault, nil
+}
+
+// EncodeValue turns raw into the bytes stored in badger.
+func EncodeValue(raw []byte, p CompressionPolicy) []byte {
+	return EncodeValueSum(raw, p, GetXxhash(raw), 0)
+}
+
+// EncodeValueSum is EncodeValue for callers that already hashed raw.
+func EncodeValueSum(raw []byte, p CompressionPolicy, sum64 uint64, owner uint64) []byte {
+	h := valueHeader{Codec: p.Codec, Flags: flagMeta, RawLen: uint64(len(raw)), Sum64: sum64, Owner: owner, Mtime: time.Now().Unix()}
+	payload := raw
+
+	if p.Codec == CodecZstd {
+		if p.Auto && IsIncompressible(raw) {
+			h.Codec = CodecNone
+		} else {
+			var z []byte
+			// the header names the dictionary the payload was really compressed with
+			if size := seekableFrameSize(len(raw)); size > 0 {
+				z, h.DictID = zstdSeekable(raw, p.Level, p.DictID, size)
+				h.Flags |= flagSeekable
+			} else if p.DictID > 0 {
+				z, h.DictID = zstdBytesDict(raw, p.Level, p.DictID)
+			} else {
+				z = ZstdBytesLevel(raw, p.Level)
+			}
+			if p.Auto && float64(len(z)) > float64(len(raw))*cfg().CompressionMinRatio {
+				h.Codec = CodecNone
+				h.DictID = 0
+				h.Flags &^= flagSeekable
+			} else {
+				payload = z
+			}
+		}
+	}
+
+	if id, aead := currentDataKey(); aead != nil {
+		h.Flags |= flagEncrypted
+		h.KeyID = id
+		hb := h.AppendTo(make([]byte, 0, valueHeaderSize+aead.NonceSize()+len(payload)+aead.Overhead()))
+		return append(hb, seal(aead, payload, hb)...)
+	}
+
+	b := make([]byte, 0, valueHeaderSize+len(payload))
+	b = h.AppendTo(b)
+	return append(b, payload...)
+}
+
+// IsIncompressible is a cheap guess for already compressed data
+// (mp4, webp, zip ...), so auto does not waste a zstd pass on it.
+func IsIncompressible(raw []byte) bool {
+	sample := raw
+	if len(sample) > 64<<10 {
+		sample = sample[:64<<10]
+	}
+	if len(sample) < 1024 {
+		return false
+	}
+	return compress.Estimate(sample) < 0.02
+}
+
+const valueHeaderSize = 2 + 42
+
+func (h valueHeader) AppendTo(b []byte) []byte {
+	b = append(b, valueMagic, valueHeaderSize-2, h.Codec, h.Flags)
+	b = binary.LittleEndian.AppendUint32(b, h.DictID)
+	b = binary.LittleEndian.AppendUint64(b, h.RawLen)
+	b = binary.LittleEndian.AppendUint64(b, h.Sum64)
+	b = binary.LittleEndian.AppendUint32(b, h.KeyID)
+	b = binary.LittleEndian.AppendUint64(b, h.Owner)
+	return binary.LittleEndian.AppendUint64(b, uint64(h.Mtime))
+}
+
+// parseValueHeader splits a stored value into its header and payload,
+// ok is false for legacy values without a header.
+func parseValueHeader(b []byte) (h valueHeader, payload []byte, ok bool) {
+	if len(b) < 2 || b[0] != valueMagic {
+		return h, b, false
+	}
+	hlen := int(b[1])
+	if len(b) < 2+hlen {
+		return h, b, false
+	}
+	fields := b[2 : 2+hlen]
+	if len(fields) > 0 {
+		h.Codec = fields[0]
+	}
+	if len(fields) > 1 {
+		h.Flags = fields[1]
+	}
+	if len(fields) >= 6 {
+		h.DictID = binary.LittleEndian.Uint32(fields[2:6])
+	}
+	if len(fields) >= 22 {
+		h.RawLen = binary.LittleEndian.Uint64(fields[6:14])
+		h.Sum64 = binary.LittleEndian.Uint64(fields[14:22])
+	} else {
+		h.Flags &^= flagMeta
+	}
+	if len(fields) >= 26 {
+		h.KeyID = binary.LittleEndian.Uint32(fields[22:26])
+	} else {
+		h.Flags &^= flagEncrypted
+	}
+	if len(fields) >= 34 {
+		h.Owner = binary.LittleEndian.Uint64(fields[26:34])
+	}
+	if len(fields) >= 42 {
+		h.Mtime = int64(binary.LittleEndian.Uint64(fields[34:42]))
+	}
+	return h, b[2+hlen:], true
+}
+
+// openValue is parseValueHeader plus decryption of the payload.
+func openValue(b []byte) (h valueHeader, payload []byte, ok bool, err error) {
+	h, payload, ok = parseValueHeader(b)
+	if !ok || h.Flags&flagEncrypted == 0 {
+		return h, payload, ok, nil
+	}
+
+	aead := getDataKey(h.KeyID)
+	if aead == nil {
+		return h, nil, ok, NewError("encryption key not available: " + Uint64ToString(uint64(h.KeyID)))
+	}
+	payload, err = unseal(aead, payload, b[:len(b)-len(payload)])
+	return h, payload, ok, err
+}
+
+// StoredValueInfo reports the codec, the logical length and the xxhash of
+// a stored value without decompressing it. ok is false when the value
+// predates the metadata, then the caller has to decode it.
+func StoredValueInfo(stored []byte) (codec byte, length int, sum64 uint64, ok bool) {
+	h, payload, hasHeader := parseValueHeader(stored)
+	if !hasHeader {
+		return CodecZstd, -1, 0, false
+	}
+	if h.Flags&flagMeta != 0 {
+		return h.Codec, int(h.RawLen), h.Sum64, true
+	}
+	if h.Codec == CodecNone {
+		return h.Codec, len(payload), GetXxhash(payload), true
+	}
+	return h.Codec, -1, 0, false
+}
+
+// zstd encoders and decoders are expensive to create, EncodeAll/DecodeAll
+// are safe for concurrent use, so one per level/dictionary is kept.
+type encoderKey struct {
+	level  int
+	dictID uint32
+}
+
+var (
+	zstdMu       sync.Mutex
+	zstdEncoders map[encoderKey]*zstd.Encoder = make(map[encoderKey]*zstd.Encoder)
+	zstdDecoders map[uint32]*zstd.Decoder     = make(map[uint32]*zstd.Decoder)
+)
+
+// getZstdEncoder returns the shared encoder for level with dictionary dictID
+// (0 = none), dictionaries are immutable once saved, until LoadDicts.
+func getZstdEncoder(level int, dictID uint32) (*zstd.Encoder, error) {
+	k := encoderKey{level: level, dictID: dictID}
+	zstdMu.Lock()
+	defer zstdMu.Unlock()
+	if enc, ok := zstdEncoders[k]; ok {
+		return enc, nil
+	}
+
+	var opts []zstd.EOption
+	if level > 0 {
+		opts = append(opts, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(level)))
+	}
+	if dictID > 0 {
+		d := getDict(dictID)
+		if d == nil {
+			return nil, NewError("zstd dictionary not found: " + Uint64ToString(uint64(dictID)))
+		}
+		opts = append(opts, zstd.WithEncoderDict(d))
+	}
+	enc, err := zstd.NewWriter(nil, opts...)
+	if err != nil {
+		return nil, err
+	}
+	zstdEncoders[k] = enc
+	return enc, nil
+}
+
+// zstdEncoderFor is getZstdEncoder which falls back to no dictionary if
+// dictID is not loaded, it returns the dictionary the encoder uses.
+func zstdEncoderFor(level int, dictID uint32) (*zstd.Encoder, uint32) {
+	enc, err := getZstdEncoder(level, dictID)
+	if err != nil {
+		PrintError("zstdEncoderFor", err)
+		enc, _ = getZstdEncoder(level, 0)
+		dictID = 0
+	}
+	return enc, dictID
+}
+
+// resetZstdCodecs drops the shared codecs, LoadDicts calls it as a restore
+// may bring other dictionaries under the same ids.
+func resetZstdCodecs() {
+	zstdMu.Lock()
+	defer zstdMu.Unlock()
+	zstdEncoders = make(map[encoderKey]*zstd.Encoder)
+	zstdDecoders = make(map[uint32]*zstd.Decoder)
+}
+
+func getZstdDecoder(dictID uint32) (*zstd.Decoder, error) {
+	zstdMu.Lock()
+	defer zstdMu.Unlock()
+	if dec, ok := zstdDecoders[dictID]; ok {
+		return dec, nil
+	}
+
+	var opts []zstd.DOption
+	if dictID > 0 {
+		d := getDict(dictID)
+		if d == nil {
+			return nil, NewError("zstd dictionary not found: " + Uint64ToString(uint64(dictID)))
+		}
+		opts = append(opts, zstd.WithDecoderDicts(d))
+	}
+	dec, err := zstd.NewReader(nil, opts...)
+	if err != nil {
+		return nil, err
+	}
+	zstdDecoders[dictID] = dec
+	return dec, nil
+}
@@ -0,0 +1,215 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"os"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestValueHeader(t *testing.T) {
+	h := valueHeader{Codec: CodecZstd, Flags: flagMeta | flagEncrypted | flagSeekable, DictID: 7, RawLen: 1 << 40,
+		Sum64: 0x0123456789abcdef, KeyID: 3, Owner: 42, Mtime: 1700000000}
+	full := h.AppendTo(nil)
+	if len(full) != valueHeaderSize {
+		t.Fatalf("header of %d bytes, want %d", len(full), valueHeaderSize)
+	}
+
+	// headers written by older versions, and by newer ones with more fields
+	withFields := func(n int) []byte {
+		fields := append(full[2:], make([]byte, 8)...)
+		return append([]byte{valueMagic, byte(n)}, fields[:n]...)
+	}
+	older := h
+	older.Mtime = 0
+	tests := []struct {
+		name   string
+		header []byte
+		want   valueHeader
+	}{
+		{"current", full, h},
+		{"codec only", withFields(1), valueHeader{Codec: CodecZstd}},
+		{"dict id", withFields(6), valueHeader{Codec: CodecZstd, Flags: flagSeekable, DictID: 7}},
+		{"raw length", withFields(22), valueHeader{Codec: CodecZstd, Flags: flagMeta | flagSeekable, DictID: 7, RawLen: h.RawLen, Sum64: h.Sum64}},
+		{"key id", withFields(26), valueHeader{Codec: CodecZstd, Flags: h.Flags, DictID: 7, RawLen: h.RawLen, Sum64: h.Sum64, KeyID: 3}},
+		{"owner", withFields(34), older},
+		{"newer", withFields(50), h},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, payload, ok := parseValueHeader(append(tt.header, "payload"...))
+			if !ok || got != tt.want || string(payload) != "payload" {
+				t.Errorf("got %+v %q %v, want %+v", got, payload, ok, tt.want)
+			}
+		})
+	}
+
+	for _, b := range [][]byte{nil, {valueMagic}, {valueMagic, 42, 1}, ZstdBytes([]byte("legacy"))} {
+		if _, payload, ok := parseValueHeader(b); ok || !bytes.Equal(payload, b) {
+			t.Errorf("%x: parsed as a header", b)
+		}
+	}
+}
+
+func TestEncodeValue(t *testing.T) {
+	random := make([]byte, 64<<10)
+	rand.Read(random)
+	text := bytes.Repeat([]byte("compressible text "), 4<<10)
+
+	tests := []struct {
+		name      string
+		raw       []byte
+		policy    string
+		encrypted bool
+		codec     byte
+		flags     byte
+	}{
+		{"empty", nil, "zstd", false, CodecZstd, flagMeta},
+		{"none", text, "none", false, CodecNone, flagMeta},
+		{"zstd", text[:1000], "zstd:19", false, CodecZstd, flagMeta},
+		{"seekable", text, "zstd", false, CodecZstd, flagMeta | flagSeekable},
+		{"auto incompressible", random, "auto", false, CodecNone, flagMeta},
+		{"auto compressible", text, "auto", false, CodecZstd, flagMeta | flagSeekable},
+		{"encrypted", text, "zstd", true, CodecZstd, flagMeta | flagSeekable | flagEncrypted},
+		{"encrypted none", random, "none", true, CodecNone, flagMeta | flagEncrypted},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			openTestDB(t, func(s *Settings) {
+				s.SeekableFrameKB = 16
+			})
+			if tt.encrypted {
+				testEncryption(t)
+			}
+			p, err := ParseCompression(tt.policy)
+			if err != nil {
+				t.Fatal(err)
+			}
+			stored := EncodeValueSum(tt.raw, p, GetXxhash(tt.raw), 9)
+			h, _, ok := parseValueHeader(stored)
+			if !ok || h.Codec != tt.codec || h.Flags != tt.flags || h.Owner != 9 || h.Mtime == 0 {
+				t.Fatalf("header %+v", h)
+			}
+			got, err := UnZstdBytes(stored)
+			if err != nil || !bytes.Equal(got, tt.raw) {
+				t.Fatalf("decoded %d bytes of %d: %v", len(got), len(tt.raw), err)
+			}
+			codec, length, sum64, ok := StoredValueInfo(stored)
+			if !ok || codec != tt.codec || length != len(tt.raw) || sum64 != GetXxhash(tt.raw) {
+				t.Errorf("info %d %d %x %v", codec, length, sum64, ok)
+			}
+		})
+	}
+
+	// values written before the header are bare zstd frames
+	legacy := ZstdBytes(text)
+	if got, err := UnZstdBytes(legacy); err != nil || !bytes.Equal(got, text) {
+		t.Errorf("legacy: %d bytes: %v", len(got), err)
+	}
+	if _, length, _, ok := StoredValueInfo(legacy); ok || length != -1 {
+		t.Errorf("legacy info: %d %v", length, ok)
+	}
+
+	t.Run("tampered header", func(t *testing.T) {
+		openTestDB(t, nil)
+		testEncryption(t)
+		stored := EncodeValue(text, CompressionPolicy{Codec: CodecZstd})
+		// the raw length, the header is the additional data of the seal
+		binary.LittleEndian.PutUint64(stored[2+6:], 1)
+		if _, err := UnZstdBytes(stored); err == nil {
+			t.Error("decrypted with a changed header")
+		}
+	})
+}
+
+// benchData is half random, half repeated text, or the file named by
+// ZSTDB_BENCH_INPUT.
+func benchData(b *testing.B) []byte {
+	if name := os.Getenv("ZSTDB_BENCH_INPUT"); name != "" {
+		raw, err := os.ReadFile(name)
+		if err != nil {
+			b.Fatal(err)
+		}
+		return raw
+	}
+
+	size := 256 << 10
+	raw := make([]byte, size/2)
+	rand.Read(raw)
+	text := bytes.Repeat([]byte(`{"name":"zstdb","tags":["video","thumbnail"]}`), size/2/45+1)
+	return append(raw, text[:size-len(raw)]...)
+}
+
+func runBench(b *testing.B, raw []byte, f func()) {
+	b.ReportAllocs()
+	b.SetBytes(int64(len(raw)))
+	for b.Loop() {
+		f()
+	}
+}
+
+// "per-call" is how values were encoded/decoded before the codecs were pooled.
+func BenchmarkZstdBytes(b *testing.B) {
+	raw := benchData(b)
+	b.Run("per-call", func(b *testing.B) {
+		runBench(b, raw, func() {
+			enc, _ := zstd.NewWriter(nil)
+			enc.EncodeAll(raw, nil)
+			enc.Close()
+		})
+	})
+	b.Run("pooled", func(b *testing.B) {
+		runBench(b, raw, func() {
+			ZstdBytes(raw)
+		})
+	})
+}
+
+func BenchmarkUnZstdBytes(b *testing.B) {
+	raw := benchData(b)
+	legacy := ZstdBytes(raw)
+	stored := EncodeValue(raw, CompressionPolicy{Codec: CodecZstd})
+	b.Run("per-call", func(b *testing.B) {
+		runBench(b, raw, func() {
+			dec, _ := zstd.NewReader(nil)
+			dec.DecodeAll(legacy, nil)
+			dec.Close()
+		})
+	})
+	b.Run("pooled", func(b *testing.B) {
+		runBench(b, raw, func() {
+			UnZstdBytes(stored)
+		})
+	})
+}
+
+// Get used to hash the decoded value, the header now holds the xxhash.
+func BenchmarkGet(b *testing.B) {
+	raw := benchData(b)
+	legacy := ZstdBytes(raw)
+	stored := EncodeValue(raw, CompressionPolicy{Codec: CodecZstd})
+	b.Run("decode+xxhash", func(b *testing.B) {
+		runBench(b, raw, func() {
+			v, _ := UnZstdBytes(legacy)
+			GetXxhash(v)
+		})
+	})
+	b.Run("decode+header", func(b *testing.B) {
+		runBench(b, raw, func() {
+			UnZstdBytes(stored)
+			StoredValueInfo(stored)
+		})
+	})
+}
+
+// Exists mode=1 used to cost the same as Get/decode+xxhash.
+func BenchmarkExists(b *testing.B) {
+	raw := benchData(b)
+	stored := EncodeValue(raw, CompressionPolicy{Codec: CodecZstd})
+	runBench(b, raw, func() {
+		StoredValueInfo(stored)
+	})
+}
@@ -0,0 +1,403 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
+)
+
+// The config file uses the flag names as keys:
+//
+//	max-upload-size-mb: 64
+//	disable-delete: true
+//	auto-backup-every: "@every 30m"
+//	compression-prefix: ["videos/=none", "json/=zstd:19"]
+//
+// Flags given on the command line always override the file.
+var (
+	ConfigFile string
+
+	// settingsFlags is rootCmd.PersistentFlags(), set in init
+	settingsFlags *pflag.FlagSet
+
+	configMu      sync.Mutex
+	configApplied map[string]bool = make(map[string]bool)
+)
+
+// reloadableSettings can be changed by SIGHUP or Admin reload, the others
+// (address, data dir, keys ...) need a restart.
+var reloadableSettings = map[string]bool{
+	"debug":                     true,
+	"allow-overwrite":           true,
+	"disable-delete":            true,
+	"disable-set":               true,
+	"max-upload-size-mb":        true,
+	"min-free-disk-space-mb":    true,
+	"admin-password":            true,
+	"auto-backup-dir":           true,
+	"auto-backup-every":         true,
+	"compression":               true,
+	"compression-prefix":        true,
+	"compression-min-ratio":     true,
+	"encryption-rotate-every":   true,
+	"log-max-size-mb":           true,
+	"shutdown-timeout":          true,
+	"auth-token":                true,
+	"rate-limit-rps":            true,
+	"rate-limit-burst":          true,
+	"rate-limit-bps":            true,
+	"quota-namespace":           true,
+	"quota-client":              true,
+	"audit-max-size-mb":         true,
+	"audit-keep":                true,
+	"log-format":                true,
+	"log-level":                 true,
+	"log-file-level":            true,
+	"log-rotate-every":          true,
+	"log-keep":                  true,
+	"watch-retention":           true,
+	"watch-buffer":              true,
+	"webhook":                   true,
+	"webhook-secret":            true,
+	"webhook-max-attempts":      true,
+	"webhook-timeout":           true,
+	"cache-size-mb":             true,
+	"seekable-frame-kb":         true,
+	"blob-threshold-mb":         true,
+	"s3-endpoint":               true,
+	"s3-bucket":                 true,
+	"s3-region":                 true,
+	"s3-access-key":             true,
+	"s3-secret-key":             true,
+	"s3-prefix":                 true,
+	"s3-timeout":                true,
+	"offload-after":             true,
+	"offload-min-size-kb":       true,
+	"s3-rewarm":                 true,
+	"scrub-every":               true,
+	"scrub-rate-mb":             true,
+	"scrub-action":              true,
+	"durability":                true,
+	"group-commit-window":       true,
+	"gc-interval":               true,
+	"gc-discard-ratio":          true,
+	"gc-pressure-discard-ratio": true,
+	"gc-windows":                true,
+	"gc-busy-rps":               true,
+	"disk-soft-free-mb":         true,
+	"disk-soft-max-upload-mb":   true,
+	"disk-reserve-mb":           true,
+	"volume-placement":          true,
+	"volume-min-size-kb":        true,
+}
+
+// secretSettings are masked in EffectiveConfig.
+var secretSettings = map[string]bool{
+	"admin-password": true,
+	"auth-token":     true,
+	"webhook-secret": true,
+	"webhook":        true,
+	"s3-access-key":  true,
+	"s3-secret-key":  true,
+}
+
+// Settings are the reloadable settings in effect. ApplySettings builds them
+// from the flags and publishes them once they are all valid, so the server
+// reads them with cfg() and never the flag variables: a reload sets those
+// before they are checked, and puts them back if the check fails.
+type Settings struct {
+	IsDebug          bool
+	IsAllowOverWrite bool
+	IsDisableDelete  bool
+	IsDisableSet     bool
+	MaxUploadSizeMB  int64
+	MaxUploadSize    int64
+	AdminPassword    string
+
+	MinFreeDiskSpaceMB  uint64
+	DiskSoftFreeMB      uint64
+	DiskSoftMaxUploadMB int64
+	DiskReserveMB       uint64
+	VolumePlacement     string
+	VolumeMinSizeKB     int64
+
+	AutoBackupDir         string
+	AutoBackupEvery       string
+	EncryptionRotateEvery string
+	ScrubEvery            string
+	ScrubRateMB           int64
+	ScrubAction           string
+
+	CompressionMinRatio float64
+	SeekableFrameKB     int64
+	BlobThresholdMB     int64
+	CacheSizeMB         int64
+
+	LogFormat      string
+	LogLevel       string
+	LogFileLevel   string
+	LogMaxSizeMB   int64
+	LogRotateEvery time.Duration
+	LogKeep        int
+	AuditMaxSizeMB int64
+	AuditKeep      int
+
+	ShutdownTimeout   time.Duration
+	Durability        string
+	GroupCommitWindow time.Duration
+
+	RateLimitRPS   float64
+	RateLimitBurst int
+	RateLimitBPS   int64
+
+	WatchRetention     time.Duration
+	WatchBuffer        int
+	WebhookSecret      string
+	WebhookMaxAttempts int
+	WebhookTimeout     time.Duration
+
+	S3Endpoint       string
+	S3Bucket         string
+	S3Region         string
+	S3AccessKey      string
+	S3SecretKey      string
+	S3Prefix         string
+	S3Timeout        time.Duration
+	OffloadAfter     time.Duration
+	OffloadMinSizeKB int64
+	S3Rewarm         bool
+
+	GCInterval             time.Duration
+	GCDiscardRatio         float64
+	GCPressureDiscardRatio float64
+	GCBusyRPS              float64
+
+	// parsed from the list flags
+	gcWindows          []gcWindow
+	authTokens         map[string]string
+	namespaceQuotas    map[string]Quota
+	clientQuotas       map[string]Quota
+	webhooks           []Webhook
+	compressionDefault CompressionPolicy
+	compressionRules   []compressionRule
+}
+
+var (
+	settings   atomic.Pointer[Settings]
+	noSettings = &Settings{}
+	reloadMu   sync.Mutex
+)
+
+// cfg returns the settings in effect, zero values before ApplySettings.
+func cfg() *Settings {
+	if s := settings.Load(); s != nil {
+		return s
+	}
+	return noSettings
+}
+
+// LoadConfigFile applies --config to every flag not set on the command
+// line. With reload=true only reloadableSettings are touched.
+func LoadConfigFile(flags *pflag.FlagSet, reload bool) (changed []string, err error) {
+	if ConfigFile == "" {
+		return nil, nil
+	}
+
+	content, err := os.ReadFile(ConfigFile)
+	if err != nil {
+		return nil, err
+	}
+
+	m := make(map[string]any)
+	if err = yaml.Unmarshal(content, &m); err != nil {
+		return nil, err
+	}
+
+	configMu.Lock()
+	defer configMu.Unlock()
+
+	for k := range m {
+		if flags.Lookup(k) == nil {
+			return nil, NewError("unknown setting in config file: " + k)
+		}
+	}
+
+	applied := make(map[string]bool)
+	var errs []string
+	flags.VisitAll(func(f *pflag.Flag) {
+		if f.Changed || f.Name == "config" {
+			return
+		}
+		if reload && !reloadableSettings[f.Name] {
+			if _, ok := m[f.Name]; ok {
+				applied[f.Name] = configApplied[f.Name]
+			}
+			return
+		}
+
+		v, ok := m[f.Name]
+		if !ok {
+			// removed from the file, back to the default
+			if configApplied[f.Name] {
+				before := f.Value.String()
+				setFlagValue(f, f.DefValue)
+				if before != f.Value.String() {
+					changed = append(changed, f.Name)
+				}
+			}
+			return
+		}
+
+		before := f.Value.String()
+		if err := setFlagValue(f, v); err != nil {
+			errs = append(errs, f.Name+": "+err.Error())
+			return
+		}
+		applied[f.Name] = true
+		if before != f.Value.String() {
+			changed = append(changed, f.Name)
+		}
+	})
+	configApplied = applied
+
+	if len(errs) > 0 {
+		return changed, NewError(strings.Join(errs, "; "))
+	}
+	sort.Strings(changed)
+	return changed, nil
+}
+
+// isSettingSet tells if name is given on the command line or in the config
+// file.
+func isSettingSet(name string) bool {
+	configMu.Lock()
+	defer configMu.Unlock()
+	f := settingsFlags.Lookup(name)
+	return f != nil && (f.Changed || configApplied[name])
+}
+
+// setFlagValue sets f without marking it as changed on the command line.
+func setFlagValue(f *pflag.Flag, v any) error {
+	if sv, ok := f.Value.(pflag.SliceValue); ok {
+		var items []string
+		switch t := v.(type) {
+		case []any:
+			for _, item := range t {
+				items = append(items, fmt.Sprintf("%v", item))
+			}
+		case string:
+			if t != "" && t != "[]" {
+				items = strings.Split(t, ",")
+			}
+		default:
+			items = []string{fmt.Sprintf("%v", t)}
+		}
+		return sv.Replace(items)
+	}
+	return f.Value.Set(fmt.Sprintf("%v", v))
+}
+
+// ReloadConfig re-reads the config file and applies the settings that can
+// change at runtime. The flags are the staging area: if a value is invalid
+// they are put back and the settings in effect do not change.
+func ReloadConfig() ([]string, error) {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+
+	saved := saveFlags()
+	changed, err := LoadConfigFile(settingsFlags, true)
+	if err == nil {
+		err = ApplySettings()
+	}
+	if err != nil {
+		restoreFlags(saved)
+		PrintError("ReloadConfig", err)
+		return nil, err
+	}
+
+	ScheduleAutoBackup()
+	ScheduleKeyRotation()
+	ScheduleScrub()
+
+	DebugInfo("ReloadConfig", "changed: ", strings.Join(changed, ","))
+	return changed, nil
+}
+
+type savedFlags struct {
+	values  map[string]any
+	applied map[string]bool
+}
+
+// saveFlags keeps the reloadable flags and which came from the file.
+func saveFlags() savedFlags {
+	configMu.Lock()
+	defer configMu.Unlock()
+	saved := savedFlags{values: make(map[string]any), applied: configApplied}
+	settingsFlags.VisitAll(func(f *pflag.Flag) {
+		if !reloadableSettings[f.Name] {
+			return
+		}
+		if sv, ok := f.Value.(pflag.SliceValue); ok {
+			saved.values[f.Name] = sv.GetSlice()
+		} else {
+			saved.values[f.Name] = f.Value.String()
+		}
+	})
+	return saved
+}
+
+func restoreFlags(saved savedFlags) {
+	configMu.Lock()
+	defer configMu.Unlock()
+	for name, v := range saved.values {
+		f := settingsFlags.Lookup(name)
+		if list, ok := v.([]string); ok {
+			PrintError("restoreFlags", f.Value.(pflag.SliceValue).Replace(list))
+		} else {
+			PrintError("restoreFlags", f.Value.Set(v.(string)))
+		}
+	}
+	configApplied = saved.applied
+}
+
+// EffectiveConfig lists the current value of every setting.
+func EffectiveConfig() map[string]string {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+	m := make(map[string]string)
+	settingsFlags.VisitAll(func(f *pflag.Flag) {
+		v := f.Value.String()
+		if secretSettings[f.Name] && v != "" && v != "[]" {
+			v = "***"
+		}
+		m[f.Name] = v
+	})
+
+	// the values buildSettings replaced
+	s := cfg()
+	m["max-upload-size-mb"] = Int64ToString(s.MaxUploadSizeMB)
+	m["compression-min-ratio"] = strconv.FormatFloat(s.CompressionMinRatio, 'g', -1, 64)
+	m["auto-backup-every"] = s.AutoBackupEvery
+	return m
+}
+
+func onReload() {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGHUP)
+	go func() {
+		for range c {
+			PrintlnInfo("zstdb", "SIGHUP, reloading ", ConfigFile)
+			ReloadConfig()
+		}
+	}()
+}
@@ -1,6 +1,8 @@
 package cmd
 
 import (
+	"context"
+	"sync"
 	"time"
 
 	"github.com/robfig/cron/v3"
@@ -8,42 +10,119 @@ import (
 
 var (
 	ScheduleTask *cron.Cron
+
+	scheduleMu       sync.Mutex
+	autoBackupEntry  cron.EntryID
+	keyRotationEntry cron.EntryID
+	scrubEntry       cron.EntryID
 )
 
-func StartCron() {
+func StartCron(ctx context.Context) {
+	scheduleMu.Lock()
 	ScheduleTask = cron.New()
-	time.Sleep(3 * time.Second)
-	if AutoBackupEvery != "" {
-		_, err := cron.ParseStandard(AutoBackupEvery)
-		if err != nil {
-			PrintError("StartCron,--auto-backup-every= invalid, will use default", err)
-			AutoBackupEvery = "@every 1h"
-		}
+	scheduleMu.Unlock()
+
+	select {
+	case <-ctx.Done():
+		return
+	case <-time.After(3 * time.Second):
+	}
+
+	ScheduleAutoBackup()
+	ScheduleKeyRotation()
+	ScheduleScrub()
+
+	ScheduleTask.AddFunc("@every 1m", func() {
+		RotateLogIfDue()
+	})
+
+	ScheduleTask.AddFunc("@every 10m", func() {
+		PrintError("TrimChangeLog", TrimChangeLog())
+	})
+
+	ScheduleTask.AddFunc("@every 1h", func() {
+		PrintError("SweepBlobs", SweepBlobs())
+		AutoOffload()
+	})
+
+	scheduleMu.Lock()
+	if ctx.Err() == nil {
+		ScheduleTask.Start()
+	}
+	scheduleMu.Unlock()
+}
 
+// ScheduleAutoBackup (re)schedules AutoBackup with --auto-backup-every,
+// it is called again when the config is reloaded.
+func ScheduleAutoBackup() {
+	if ScheduleTask == nil {
+		return
 	}
+	scheduleMu.Lock()
+	defer scheduleMu.Unlock()
 
-	if AutoBackupDir != "" && AutoBackupEvery != "" {
-		DebugInfo("StartCron: --auto-backup-every is using", AutoBackupEvery, ", --auto-backup-dir=", AutoBackupDir)
+	if autoBackupEntry != 0 {
+		ScheduleTask.Remove(autoBackupEntry)
+		autoBackupEntry = 0
+	}
+
+	// an invalid --auto-backup-every is replaced by the default in buildSettings
+	s := cfg()
+	if s.AutoBackupDir != "" && s.AutoBackupEvery != "" {
+		DebugInfo("StartCron: --auto-backup-every is using", s.AutoBackupEvery, ", --auto-backup-dir=", s.AutoBackupDir)
 	} else {
 		DebugInfo("StartCron: AutoBackup", "disabled")
+		return
 	}
 
-	ScheduleTask.AddFunc(AutoBackupEvery, func() {
-		if AutoBackupDir != "" && AutoBackupEvery != "" {
-			DebugInfo("StartCron", AutoBackupEvery, ", Dir: ", AutoBackupDir)
+	autoBackupEntry, _ = ScheduleTask.AddFunc(s.AutoBackupEvery, func() {
+		if s := cfg(); s.AutoBackupDir != "" && s.AutoBackupEvery != "" {
+			DebugInfo("StartCron", s.AutoBackupEvery, ", Dir: ", s.AutoBackupDir)
 			AutoBackup()
 		}
 	})
+}
 
-	if enableFileLogging {
-		DebugInfo("StartCron: FileLogging", "enabled => ", errorLogFile)
-	} else {
-		DebugInfo("StartCron: FileLogging", "disabled")
+// ScheduleKeyRotation (re)schedules RotateDataKey with --encryption-rotate-every.
+func ScheduleKeyRotation() {
+	if ScheduleTask == nil {
+		return
 	}
+	scheduleMu.Lock()
+	defer scheduleMu.Unlock()
 
-	ScheduleTask.AddFunc("@every 1m", func() {
-		WatchErrorLogFile()
-	})
+	if keyRotationEntry != 0 {
+		ScheduleTask.Remove(keyRotationEntry)
+		keyRotationEntry = 0
+	}
 
-	ScheduleTask.Start()
+	if cfg().EncryptionRotateEvery != "" && IsEncryptionEnabled() {
+		DebugInfo("StartCron: --encryption-rotate-every is using", cfg().EncryptionRotateEvery)
+		var err error
+		keyRotationEntry, err = ScheduleTask.AddFunc(cfg().EncryptionRotateEvery, func() {
+			RotateDataKey()
+		})
+		PrintError("StartCron,--encryption-rotate-every= invalid", err)
+	}
+}
+
+// ScheduleScrub (re)schedules AutoScrub with --scrub-every.
+func ScheduleScrub() {
+	if ScheduleTask == nil {
+		return
+	}
+	scheduleMu.Lock()
+	defer scheduleMu.Unlock()
+
+	if scrubEntry != 0 {
+		ScheduleTask.Remove(scrubEntry)
+		scrubEntry = 0
+	}
+
+	if cfg().ScrubEvery != "" {
+		DebugInfo("StartCron: --scrub-every is using", cfg().ScrubEvery)
+		var err error
+		scrubEntry, err = ScheduleTask.AddFunc(cfg().ScrubEvery, AutoScrub)
+		PrintError("StartCron,--scrub-every= invalid", err)
+	}
 }
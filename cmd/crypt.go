@@ -0,0 +1,332 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"os"
+	"strings"
+	"sync"
+
+	badger "github.com/dgraph-io/badger/v4"
+	"github.com/zeebo/blake3"
+)
+
+// Values are encrypted with AES-256-GCM data keys, the data keys are
+// stored inside the db wrapped (AES-256-GCM) by the master key:
+//
+//	\x00zstdb/keys/<id>   => nonce + wrapped data key
+//	\x00zstdb/keys-current => id used for new writes
+//
+// The master key never touches the disk through zstdb, so both the fbin
+// directory and the backups only hold ciphertext.
+var (
+	EncryptionKeyFile     string
+	EncryptionRotateEvery string
+
+	keyPrefix     = InternalKey("keys/")
+	keyCurrentKey = InternalKey("keys-current")
+
+	keyMu        sync.RWMutex
+	masterKey    cipher.AEAD
+	dataKeys     map[uint32]cipher.AEAD = make(map[uint32]cipher.AEAD)
+	currentKeyID uint32
+	nameKey      []byte
+)
+
+// IsEncryptionEnabled tells if new values are encrypted.
+func IsEncryptionEnabled() bool {
+	keyMu.RLock()
+	defer keyMu.RUnlock()
+	return masterKey != nil
+}
+
+// ReadMasterKey loads the master key from --encryption-key-file, or the
+// env var zstdb_encryption_key. It returns nil if neither is set.
+func ReadMasterKey(fpath string) ([]byte, error) {
+	var content []byte
+	if fpath != "" {
+		content = ReadFile(fpath)
+		if content == nil {
+			return nil, NewError("cannot read encryption key file: " + fpath)
+		}
+	} else {
+		ev := os.Getenv("zstdb_encryption_key")
+		if ev == "" {
+			return nil, nil
+		}
+		content = []byte(ev)
+	}
+	return parseKeyMaterial(content)
+}
+
+// parseKeyMaterial accepts 32 raw bytes, 64 hex chars or base64 of 32 bytes.
+func parseKeyMaterial(b []byte) ([]byte, error) {
+	if len(b) == 32 {
+		return b, nil
+	}
+	s := strings.TrimSpace(string(b))
+	if k, err := hex.DecodeString(s); err == nil && len(k) == 32 {
+		return k, nil
+	}
+	if k, err := base64.StdEncoding.DecodeString(s); err == nil && len(k) == 32 {
+		return k, nil
+	}
+	return nil, NewError("encryption key must be 32 bytes, 64 hex chars or base64 of 32 bytes")
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func keyIDAAD(id uint32) []byte {
+	return []byte("zstdb-data-key-" + Uint64ToString(uint64(id)))
+}
+
+func seal(aead cipher.AEAD, plain, aad []byte) []byte {
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plain)+aead.Overhead())
+	rand.Read(nonce)
+	return aead.Seal(nonce, nonce, plain, aad)
+}
+
+func unseal(aead cipher.AEAD, sealed, aad []byte) ([]byte, error) {
+	if len(sealed) < aead.NonceSize() {
+		return nil, NewError("ciphertext is too short")
+	}
+	return aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], aad)
+}
+
+// LoadEncryptionKeys unwraps all data keys with the master key. It fails if
+// the master key is wrong, or missing while the db holds data keys.
+func LoadEncryptionKeys() error {
+	mk, err := ReadMasterKey(EncryptionKeyFile)
+	if err != nil {
+		return err
+	}
+
+	wrapped := make(map[uint32][]byte)
+	var current uint32
+	err = bgrdb.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+		for it.Seek(keyPrefix); it.ValidForPrefix(keyPrefix); it.Next() {
+			item := it.Item()
+			v, err := item.ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+			id := Str2Uint64(strings.TrimPrefix(string(item.Key()), string(keyPrefix)))
+			wrapped[uint32(id)] = v
+		}
+
+		item, err := txn.Get(keyCurrentKey)
+		if err == nil {
+			v, err := item.ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+			current = uint32(Str2Uint64(string(v)))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if mk == nil {
+		// new values would be written in plaintext and the encrypted ones fail to read
+		if len(wrapped) > 0 {
+			return NewError("db has encrypted values, --encryption-key-file or zstdb_encryption_key must be set")
+		}
+		return nil
+	}
+
+	mAEAD, err := newAEAD(mk)
+	if err != nil {
+		return err
+	}
+
+	keys := make(map[uint32]cipher.AEAD)
+	var first uint32
+	var names []byte
+	for id, w := range wrapped {
+		dk, err := unseal(mAEAD, w, keyIDAAD(id))
+		if err != nil {
+			return NewError("cannot unwrap data key " + Uint64ToString(uint64(id)) + ", wrong encryption key?")
+		}
+		keys[id], err = newAEAD(dk)
+		if err != nil {
+			return err
+		}
+		if first == 0 || id < first {
+			first, names = id, deriveNameKey(dk)
+		}
+	}
+
+	keyMu.Lock()
+	masterKey = mAEAD
+	dataKeys = keys
+	currentKeyID = current
+	nameKey = names
+	keyMu.Unlock()
+
+	if current == 0 || keys[current] == nil {
+		_, err = RotateDataKey()
+		return err
+	}
+
+	DebugInfo("LoadEncryptionKeys", "data keys: ", len(keys), ", current: ", current)
+	return nil
+}
+
+// RotateDataKey creates a new data key for new writes, values written
+// with older keys stay readable.
+func RotateDataKey() (uint32, error) {
+	keyMu.Lock()
+	defer keyMu.Unlock()
+	if masterKey == nil {
+		return 0, NewError("encryption is not enabled")
+	}
+
+	id := uint32(1)
+	for k := range dataKeys {
+		if k >= id {
+			id = k + 1
+		}
+	}
+
+	dk := make([]byte, 32)
+	if _, err := rand.Read(dk); err != nil {
+		return 0, err
+	}
+	aead, err := newAEAD(dk)
+	if err != nil {
+		return 0, err
+	}
+
+	err = bgrdb.Update(func(txn *badger.Txn) error {
+		err := txn.Set(InternalKey("keys/"+Uint64ToString(uint64(id))), seal(masterKey, dk, keyIDAAD(id)))
+		if err != nil {
+			return err
+		}
+		return txn.Set(keyCurrentKey, []byte(Uint64ToString(uint64(id))))
+	})
+	if err != nil {
+		PrintError("RotateDataKey", err)
+		return 0, err
+	}
+
+	dataKeys[id] = aead
+	currentKeyID = id
+	if nameKey == nil {
+		nameKey = deriveNameKey(dk)
+	}
+	DebugInfo("RotateDataKey", "current data key: ", id)
+	return id, nil
+}
+
+// RewrapDataKeys re-encrypts every data key with a new master key, the
+// server must be started with the new key afterwards.
+func RewrapDataKeys(newMaster []byte) error {
+	nAEAD, err := newAEAD(newMaster)
+	if err != nil {
+		return err
+	}
+
+	keyMu.Lock()
+	defer keyMu.Unlock()
+	if masterKey == nil {
+		return NewError("encryption is not enabled")
+	}
+
+	err = bgrdb.Update(func(txn *badger.Txn) error {
+		for id := range dataKeys {
+			k := InternalKey("keys/" + Uint64ToString(uint64(id)))
+			item, err := txn.Get(k)
+			if err != nil {
+				return err
+			}
+			w, err := item.ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+			dk, err := unseal(masterKey, w, keyIDAAD(id))
+			if err != nil {
+				return err
+			}
+			if err = txn.Set(k, seal(nAEAD, dk, keyIDAAD(id))); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		PrintError("RewrapDataKeys", err)
+		return err
+	}
+
+	masterKey = nAEAD
+	DebugInfo("RewrapDataKeys", "data keys: ", len(dataKeys))
+	return nil
+}
+
+// currentDataKey returns the key for new writes, nil if encryption is off.
+func currentDataKey() (uint32, cipher.AEAD) {
+	keyMu.RLock()
+	defer keyMu.RUnlock()
+	if masterKey == nil {
+		return 0, nil
+	}
+	return currentKeyID, dataKeys[currentKeyID]
+}
+
+// blobNameKey keys the hash naming blob files, nil if encryption is off.
+// It is derived from the first data key, so it stays the same through
+// rotations and a new master key.
+func blobNameKey() []byte {
+	keyMu.RLock()
+	defer keyMu.RUnlock()
+	if masterKey == nil {
+		return nil
+	}
+	return nameKey
+}
+
+func deriveNameKey(dk []byte) []byte {
+	k := make([]byte, 32)
+	blake3.DeriveKey("zstdb blob file names", dk, k)
+	return k
+}
+
+func getDataKey(id uint32) cipher.AEAD {
+	keyMu.RLock()
+	defer keyMu.RUnlock()
+	return dataKeys[id]
+}
+
+// EncryptionStatus is reported by Admin status.
+func EncryptionStatus() (enabled bool, current uint32, keys int) {
+	keyMu.RLock()
+	defer keyMu.RUnlock()
+	return masterKey != nil, currentKeyID, len(dataKeys)
+}
+
+// decodeInternal reads an internal value which may have been written
+// through EncodeValue (and so be encrypted) or as plain bytes.
+func decodeInternal(b []byte) ([]byte, error) {
+	if _, _, ok := parseValueHeader(b); ok {
+		v, err := UnZstdBytes(b)
+		if err != nil {
+			return nil, err
+		}
+		return bytes.Clone(v), nil
+	}
+	return b, nil
+}
@@ -1,159 +1,423 @@
 package cmd
 
 import (
+	"bytes"
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
-	"runtime"
 	"strings"
 	"sync"
 	"time"
 
 	badger "github.com/dgraph-io/badger/v4"
-	badgeroptions "github.com/dgraph-io/badger/v4/options"
 )
 
-var (
-	bgrdb         *badger.DB
-	cacheCounters map[string]uint64 = make(map[string]uint64)
-)
+var bgrdb *badger.DB
+
+// internalPrefix marks keys zstdb keeps for itself (dictionaries ...),
+// they are hidden from List/Count and cannot be used by clients.
+const internalPrefix = "\x00zstdb/"
+
+func InternalKey(name string) []byte {
+	return []byte(internalPrefix + name)
+}
+
+func IsInternalKey(key []byte) bool {
+	return bytes.HasPrefix(key, []byte(internalPrefix))
+}
 
 func badgerConnect() *badger.DB {
-	datadir := ToUnixSlash(filepath.Join(DataDir, "fbin"))
+	datadir := badgerDir()
 	MakeDirs(datadir)
 	DebugInfo("badgerConnect", datadir)
-	numCompactors := runtime.NumCPU()
-	if numCompactors < 4 {
-		numCompactors = 4
-	}
-	if numCompactors > 16 {
-		numCompactors = 16
-	}
+
+	db, err := badger.Open(badgerOptions(datadir))
+	FatalError("badgerConnect", err)
+	return db
+}
+
+func badgerDir() string {
+	return ToUnixSlash(filepath.Join(DataDir, "fbin"))
+}
+
+// badgerOptions are the options the server opens datadir with, inspect and
+// repair use the same.
+func badgerOptions(datadir string) badger.Options {
+	// checked by ApplyBadgerPreset
+	compression, _ := parseBlockCompression(BadgerBlockCompression)
+
 	opts := badger.DefaultOptions(datadir)
 	opts.Dir = datadir
 	opts.ValueDir = datadir
-	opts.BaseTableSize = 256 << 20
+	opts.BaseTableSize = BadgerBaseTableSizeMB << 20
 	opts.NumVersionsToKeep = 1
-	opts.NumCompactors = numCompactors
-	opts.Compression = badgeroptions.ZSTD
-	opts.ValueLogFileSize = 2<<30 - 64<<20
-	opts.SyncWrites = false
-	opts.ValueThreshold = 32
+	opts.NumCompactors = numCompactors()
+	opts.Compression = compression
+	opts.ValueLogFileSize = BadgerValueLogFileSizeMB << 20
+	opts.SyncWrites = BadgerSyncWrites
+	opts.ValueThreshold = BadgerValueThreshold
+	opts.BlockCacheSize = BadgerBlockCacheMB << 20
+	opts.IndexCacheSize = BadgerIndexCacheMB << 20
+	opts.MemTableSize = BadgerMemTableSizeMB << 20
+	opts.NumMemtables = BadgerNumMemtables
 	opts.CompactL0OnClose = true
+	return opts
+}
 
-	db, err := badger.Open(opts)
-	FatalError("badgerConnect", err)
-	return db
+// SaveOptions come with a Set request.
+type SaveOptions struct {
+	Compression string
+	Client      string
 }
 
-func badgerSave(key, val []byte) []byte {
-	if int64(len(val)) > MaxUploadSize {
+// badgerSave stores val, sum64 is its xxhash which the caller has verified.
+// created is false when the key already existed and was kept as it is.
+func badgerSave(key, val []byte, sum64 uint64, so SaveOptions) (k []byte, created bool, err error) {
+	if int64(len(val)) > cfg().MaxUploadSize {
 		DebugWarn("badgerSetKV", "val is oversized")
-		return nil
+		return nil, false, NewError("val is oversized")
 	}
 
 	if IsAllowUserKey {
-		return badgerSetKV(key, val)
+		return badgerSetKV(key, val, sum64, so)
 	}
 
-	return badgerSetV(val)
+	return badgerSetV(val, sum64, so)
 }
 
-func badgerSetKV(key, val []byte) []byte {
+func badgerSetKV(key, val []byte, sum64 uint64, so SaveOptions) ([]byte, bool, error) {
 	if IsAnyNil(key, val) {
 		DebugWarn("badgerSetKV", "key/val cannot be empty")
-		return nil
+		return nil, false, NewError("key/val cannot be empty")
 	}
 
-	err := bgrdb.Update(func(txn *badger.Txn) error {
-		_, err := txn.Get(key)
-		if err == nil && IsAllowOverWrite == false {
-			//DebugInfo("badgerSetKV", "SKIP as exists")
-			return nil
-		}
+	if IsInternalKey(key) {
+		DebugWarn("badgerSetKV", "key is reserved")
+		return nil, false, NewError("key is reserved")
+	}
 
-		err = txn.Set(key, ZstdBytes(val))
-		PrintError("badgerSetKV", err)
-		return err
-	})
+	created, err := badgerPut(key, val, sum64, so)
 	if err != nil {
-		return nil
+		PrintError("badgerSetKV", err)
+		return nil, false, err
 	}
-	return key
+	return key, created, nil
 }
 
-func badgerSetV(val []byte) (key []byte) {
+func badgerSetV(val []byte, sum64 uint64, so SaveOptions) (key []byte, created bool, err error) {
 	if val == nil {
 		DebugWarn("badgerSetV", "val cannot be empty")
-		return nil
+		return nil, false, NewError("val cannot be empty")
 	}
 
 	key = SumBlake3(val)
 
-	err := bgrdb.Update(func(txn *badger.Txn) error {
-		_, err := txn.Get(key)
-		if err == nil && IsAllowOverWrite == false {
-			//DebugInfo("badgerSetV", "SKIP as exists")
-			return nil
-		}
-		err = txn.Set([]byte(key), ZstdBytes(val))
+	created, err = badgerPut(key, val, sum64, so)
+	if err != nil {
 		PrintError("badgerSetV", err)
+		return nil, false, err
+	}
+	return key, created, nil
+}
+
+// badgerPut encodes val outside of the transaction, then writes it and
+// updates the usage counters together.
+func badgerPut(key, val []byte, sum64 uint64, so SaveOptions) (created bool, err error) {
+	policy, err := CompressionFor(key, so.Compression)
+	if err != nil {
+		return false, err
+	}
+
+	owner := OwnerID(so.Client)
+	var encoded []byte
+	encode := func() ([]byte, error) {
+		var err error
+		if encoded == nil {
+			encoded, err = encodeStored(val, policy, sum64, owner)
+		}
+		return encoded, err
+	}
+
+	if isBlobSize(len(val)) {
+		// the file must not be removed before the pointer is committed
+		blobMu.RLock()
+		defer blobMu.RUnlock()
+	}
+	err = badgerUpdate(func(txn *badger.Txn) error {
+		created, err = txnPut(txn, key, val, sum64, owner, encode)
 		return err
 	})
+	CacheInvalidate(key)
+	if created && err == nil {
+		wakeWebhooks()
+	}
+	return created, err
+}
+
+// txnPut writes key in txn with the usage counters, the change log and the
+// webhook jobs.
+// encode is only called if the value is written.
+func txnPut(txn *badger.Txn, key, val []byte, sum64, owner uint64, encode func() ([]byte, error)) (created bool, err error) {
+	item, err := txn.Get(key)
+	if err == nil && cfg().IsAllowOverWrite == false {
+		//DebugInfo("txnPut", "SKIP as exists")
+		return false, nil
+	}
+	if err != nil && err != badger.ErrKeyNotFound {
+		return false, err
+	}
+
+	encoded, err := encode()
 	if err != nil {
+		return false, err
+	}
+	if item != nil {
+		// overwrite: give the old value back to its owner first
+		if _, err = releaseUsage(txn, key, item); err != nil {
+			return false, err
+		}
+	}
+	_, stored, _ := valueSizes(encoded)
+	if err = usageDelta(txn, key, owner, 1, int64(stored), int64(len(val))); err != nil {
+		return false, err
+	}
+	if hash, ok := storedBlob(encoded); ok {
+		if err = blobRef(txn, hash, 1); err != nil {
+			return false, err
+		}
+	}
+	if err = cdcAppend(txn, cdcSet, key, uint64(len(val)), sum64); err != nil {
+		return false, err
+	}
+	if err = queueKeyWebhooks(txn, "set", key, uint64(len(val)), sum64); err != nil {
+		return false, err
+	}
+	return true, txn.Set(key, encoded)
+}
+
+// releaseUsage subtracts a stored item from the counters, it returns the
+// header of the item.
+func releaseUsage(txn *badger.Txn, key []byte, item *badger.Item) (valueHeader, error) {
+	var h valueHeader
+	var stored, raw uint64
+	var hash, object string
+	var isBlob, isStub bool
+	err := item.Value(func(v []byte) error {
+		h, stored, raw = valueSizes(v)
+		hash, isBlob = storedBlob(v)
+		object, isStub = storedS3(v)
 		return nil
+	})
+	if err != nil {
+		return h, err
+	}
+	if isBlob {
+		if err = blobRef(txn, hash, -1); err != nil {
+			return h, err
+		}
+	}
+	if isStub {
+		if err = txn.Set(s3GCKey(object), nil); err != nil {
+			return h, err
+		}
+	}
+	if item.UserMeta()&metaMoved != 0 {
+		if err = txn.Delete(movedVerKey(key)); err != nil {
+			return h, err
+		}
 	}
-	return key
+	return h, usageDelta(txn, key, h.Owner, -1, -int64(stored), -int64(raw))
 }
 
-func badgerGet(key []byte) (val []byte, ver uint64) {
-	if key == nil {
+// badgerUpdate is bgrdb.Update, retried when it conflicts with another
+// writer on the same counters.
+func badgerUpdate(fn func(txn *badger.Txn) error) error {
+	var err error
+	for i := 0; i < 16; i++ {
+		err = bgrdb.Update(fn)
+		if err != badger.ErrConflict {
+			return err
+		}
+		time.Sleep(time.Duration(i+1) * time.Millisecond)
+	}
+	return err
+}
+
+// badgerGet returns the decoded value, its version and its xxhash. The
+// object of an offloaded value is fetched with ctx, after the read txn.
+func badgerGet(ctx context.Context, key []byte) (val []byte, ver uint64, sum64 uint64) {
+	if key == nil || IsInternalKey(key) {
 		DebugWarn("badgerGet.10", "key cannot be empty")
-		return nil, 0
+		return nil, 0, 0
 	}
 
-	bgrdb.View(func(txn *badger.Txn) error {
+	noteAccess(key)
+	cached, gen := cacheGet(key)
+	if cached != nil {
+		return cached.val, cached.ver, cached.sum64
+	}
+
+	var stub []byte
+	var storedVer uint64
+	err := bgrdb.View(func(txn *badger.Txn) error {
 		item, err := txn.Get(key)
 		if err != nil {
 			DebugWarn("badgerGet.20", err, ":", string(key))
 			return nil
 		}
 
-		itemVal, err := item.ValueCopy(nil)
-		if err != nil {
-			PrintError("badgerGet.30", err)
+		if ver, err = itemVersion(txn, item); err != nil {
 			return err
 		}
+		storedVer = item.Version()
 
-		ver = item.Version()
+		// decode straight from badger's buffer, no copy of the compressed value
+		return item.Value(func(itemVal []byte) error {
+			if storedS3Stub(itemVal) {
+				stub = bytes.Clone(itemVal)
+				return nil
+			}
+			val, sum64, err = decodeItem(itemVal, itemVal)
+			return err
+		})
+	})
+	if err == nil && stub != nil {
+		var h valueHeader
+		var obj []byte
+		h, obj, _, err = fetchS3Stub(ctx, stub)
+		if err == nil {
+			val, sum64, err = decodeItem(stub, obj)
+		}
+		if err == nil && cfg().S3Rewarm {
+			rewarm(key, storedVer, h, obj, val)
+		}
+	}
+	if err != nil {
+		PrintError("badgerGet.30", err)
+		return nil, 0, 0
+	}
 
-		val, err = UnZstdBytes(itemVal)
+	if val != nil {
+		cacheFill(key, val, ver, sum64, gen)
+	}
+	return val, ver, sum64
+}
+
+// decodeItem decodes stored, the value as stored in itemVal or the object
+// of the stub in itemVal.
+func decodeItem(itemVal, stored []byte) (v []byte, sum64 uint64, err error) {
+	v, err = UnZstdBytes(stored)
+	if err != nil {
+		return nil, 0, err
+	}
+	codec, _, s, ok := StoredValueInfo(itemVal)
+	if codec == CodecNone {
+		// v points into itemVal, which is only valid inside Value
+		v = bytes.Clone(v)
+	}
+	if !ok {
+		s = GetXxhash(v)
+	}
+	return v, s, nil
+}
+
+// badgerGetRange reads length bytes of key from offset (length 0: to the
+// end), total is the length of the whole value. found is false if key does
+// not exist. The object of an offloaded value is fetched with ctx, after the
+// read txn.
+func badgerGetRange(ctx context.Context, key []byte, offset, length uint64) (val []byte, ver uint64, total uint64, found bool, err error) {
+	if key == nil || IsInternalKey(key) {
+		return nil, 0, 0, false, NewError("key cannot be empty")
+	}
+
+	noteAccess(key)
+	if cached, _ := cacheGet(key); cached != nil {
+		total = uint64(len(cached.val))
+		end, err := rangeEnd(offset, length, total)
+		if err != nil {
+			return nil, cached.ver, total, true, err
+		}
+		return cached.val[offset:end], cached.ver, total, true, nil
+	}
+
+	var stub []byte
+	err = bgrdb.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(key)
+		if err == badger.ErrKeyNotFound {
+			return nil
+		}
 		if err != nil {
 			return err
 		}
-		return err
+		found = true
+		if ver, err = itemVersion(txn, item); err != nil {
+			return err
+		}
+		return item.Value(func(itemVal []byte) error {
+			if storedS3Stub(itemVal) {
+				stub = bytes.Clone(itemVal)
+				return nil
+			}
+			val, total, err = ReadRange(itemVal, offset, length)
+			return err
+		})
 	})
-
-	return val, ver
+	if err == nil && stub != nil {
+		var obj []byte
+		if _, obj, _, err = fetchS3Stub(ctx, stub); err == nil {
+			val, total, err = ReadRange(obj, offset, length)
+		}
+	}
+	return val, ver, total, found, err
 }
 
-func badgerDelete(key []byte) error {
+// badgerDelete removes key, found is false if it did not exist, h is the
+// header of the deleted value.
+func badgerDelete(key []byte) (h valueHeader, found bool, err error) {
 	if key == nil {
 		DebugWarn("badgerDelete", "key cannot be empty")
-		return NewError("key cannot be empty")
+		return h, false, NewError("key cannot be empty")
 	}
 
-	err := bgrdb.Update(func(txn *badger.Txn) error {
-		_, err := txn.Get(key)
-		if err != nil {
-			return nil
-		}
-		err = txn.Delete(key)
+	if IsInternalKey(key) {
+		return h, false, NewError("key is reserved")
+	}
+
+	err = badgerUpdate(func(txn *badger.Txn) error {
+		h, found, err = txnDelete(txn, key)
 		PrintError("badgerDelete", err)
 		return err
 	})
+	CacheInvalidate(key)
+	if found && err == nil {
+		wakeWebhooks()
+	}
 
-	return err
+	return h, found, err
+}
+
+// txnDelete removes key in txn with the usage counters, the change log and
+// the webhook jobs.
+func txnDelete(txn *badger.Txn, key []byte) (h valueHeader, found bool, err error) {
+	item, err := txn.Get(key)
+	if err == badger.ErrKeyNotFound {
+		return h, false, nil
+	}
+	if err != nil {
+		return h, false, err
+	}
+	h, err = releaseUsage(txn, key, item)
+	if err != nil {
+		return h, false, err
+	}
+	if err = cdcAppend(txn, cdcDelete, key, h.RawLen, h.Sum64); err != nil {
+		return h, false, err
+	}
+	if err = queueKeyWebhooks(txn, "delete", key, h.RawLen, h.Sum64); err != nil {
+		return h, false, err
+	}
+	return h, true, txn.Delete(key)
 }
 
 func badgerList(prefix string, pageNum int) []string {
@@ -173,6 +437,9 @@ func badgerList(prefix string, pageNum int) []string {
 		counter := 0
 		prefixByte := []byte(prefix)
 		for it.Seek(prefixByte); it.ValidForPrefix(prefixByte); it.Next() {
+			if IsInternalKey(it.Item().Key()) {
+				continue
+			}
 			if counter < skipRows {
 				counter++
 				continue
@@ -182,7 +449,11 @@ func badgerList(prefix string, pageNum int) []string {
 				break
 			}
 			item := it.Item()
-			k := strings.Join([]string{string(item.Key()), Uint64ToString(item.Version())}, ":")
+			ver, err := itemVersion(txn, item)
+			if err != nil {
+				return err
+			}
+			k := strings.Join([]string{string(item.Key()), Uint64ToString(ver)}, ":")
 			if strings.HasPrefix(k, prefix) {
 				pageKeys = append(pageKeys, k)
 			}
@@ -193,53 +464,13 @@ func badgerList(prefix string, pageNum int) []string {
 	return pageKeys
 }
 
-func badgerCount(prefix string) uint64 {
-	// saving memory
-	if len(cacheCounters) > 32 {
-		for k, _ := range cacheCounters {
-			delete(cacheCounters, k)
-		}
-	}
-
-	cacheKey := strings.Join([]string{"keycount", prefix}, "_")
-	cacheVersion, ok := cacheCounters["cacheVersion"]
-	if ok {
-		if cacheVersion == bgrdb.MaxVersion() {
-			val, ok := cacheCounters[cacheKey]
-			if ok {
-				DebugInfo("badgerCount", "cache HIT: ", cacheKey)
-				return val
-			}
-		} else {
-			for k, _ := range cacheCounters {
-				delete(cacheCounters, k)
-			}
-		}
-	}
-
-	counter := uint64(0)
-	bgrdb.View(func(txn *badger.Txn) error {
-		opts := badger.DefaultIteratorOptions
-		opts.PrefetchSize = 0
-		opts.PrefetchValues = false
-		it := txn.NewIterator(opts)
-		defer it.Close()
-		prefixByte := []byte(prefix)
-		for it.Seek(prefixByte); it.ValidForPrefix(prefixByte); it.Next() {
-			counter++
-		}
-		return nil
-	})
-	cacheCounters["cacheVersion"] = bgrdb.MaxVersion()
-	cacheCounters[cacheKey] = counter
-
-	return counter
-}
-
-func badgerExists(key []byte, model int) (verNum uint64, length int, sum64 uint64) {
-	if key == nil {
+// badgerExists reports the version, the logical length, the stored length
+// and the codec of key. With model=0 length is 0 if it needs decompression,
+// as before the header.
+func badgerExists(key []byte, model int) (verNum uint64, length int, stored int, codec int, sum64 uint64) {
+	if key == nil || IsInternalKey(key) {
 		DebugWarn("badgerExists", "key cannot be empty")
-		return 0, 0, 0
+		return 0, 0, 0, 0, 0
 	}
 
 	err := bgrdb.View(func(txn *badger.Txn) error {
@@ -247,26 +478,41 @@ func badgerExists(key []byte, model int) (verNum uint64, length int, sum64 uint6
 		if err != nil {
 			return err
 		}
-		verNum = it.Version()
-		if model == 1 {
-			itVal, err := it.ValueCopy(nil)
-			if err != nil {
-				return err
+		if verNum, err = itemVersion(txn, it); err != nil {
+			return err
+		}
+		stored = int(it.ValueSize())
+		return it.Value(func(itVal []byte) error {
+			// only the header is read here, the value is not copied
+			c, l, s, ok := StoredValueInfo(itVal)
+			codec = int(c)
+			length = max(l, 0)
+			if c == CodecBlob || c == CodecS3 {
+				_, size, _ := valueSizes(itVal)
+				stored = int(size)
 			}
-			valUnzstd, err := UnZstdBytes(itVal)
-			if err != nil {
-				return err
+			if ok {
+				if model == 1 {
+					sum64 = s
+				}
+				return nil
 			}
-			length = len(valUnzstd)
-			sum64 = GetXxhash(valUnzstd)
-		}
-		return nil
+			if model == 1 {
+				valUnzstd, err := UnZstdBytes(itVal)
+				if err != nil {
+					return err
+				}
+				length = len(valUnzstd)
+				sum64 = GetXxhash(valUnzstd)
+			}
+			return nil
+		})
 	})
 	if err != nil {
-		return 0, 0, 0
+		return 0, 0, 0, 0, 0
 	}
 
-	return verNum, length, sum64
+	return verNum, length, stored, codec, sum64
 }
 
 func badgerSync() error {
@@ -291,6 +537,13 @@ func badgerBackup(fpath string, fsince uint64) error {
 		}
 		defer ft.Close()
 
+		// no blob file nor object is removed until they are copied next to
+		// the backup
+		blobMu.RLock()
+		defer blobMu.RUnlock()
+		s3CopyMu.RLock()
+		defer s3CopyMu.RUnlock()
+
 		lastVersion, err := bgrdb.Backup(ft, fsince)
 		if err != nil {
 			PrintError("Backup", err)
@@ -298,6 +551,24 @@ func badgerBackup(fpath string, fsince uint64) error {
 		}
 		ft.Close()
 
+		n := 0
+		for _, v := range volumeList() {
+			c, err := copyBlobs(v.blobDir(), ToUnixSlash(filepath.Join(filepath.Dir(fpath), "blobs")))
+			if err != nil {
+				PrintError("Backup", err)
+				return
+			}
+			n += c
+		}
+		DebugInfo("Backup", "blob files copied: ", n)
+
+		n, err = copyS3Objects(appCtx, ToUnixSlash(filepath.Join(filepath.Dir(fpath), "s3")))
+		if err != nil {
+			PrintError("Backup", err)
+			return
+		}
+		DebugInfo("Backup", "s3 objects copied: ", n)
+
 		lastVersionFile := ToUnixSlash(filepath.Join(filepath.Dir(fpath), "ver"))
 		DebugInfo("Backup", lastVersion)
 		err = WriteFile(lastVersionFile, []byte(Uint64ToString(lastVersion)))
@@ -315,6 +586,12 @@ func badgerBackup(fpath string, fsince uint64) error {
 
 		WriteFile(doneFile, []byte(ftarget))
 
+		var size uint64
+		if fi, err := os.Stat(ftarget); err == nil {
+			size = uint64(fi.Size())
+		}
+		NotifyWebhooks(WebhookEvent{Event: "backup", Key: ftarget, Version: lastVersion, Size: size})
+
 	}(fpath, fsince, bgrdb, doneFile)
 
 	wg.Wait()
@@ -332,8 +609,17 @@ func badgerBackup(fpath string, fsince uint64) error {
 	return nil
 }
 
+// badgerRestore loads the backup fpath with the blob files and S3 objects
+// copied next to it, unless the disk watermarks block a write of its size.
 func badgerRestore(fpath string) error {
 	DebugInfo("badgerRestore", "from: ", fpath)
+	fi, err := os.Stat(fpath)
+	if err != nil {
+		return err
+	}
+	if blocked := diskWriteBlocked(fi.Size()); blocked != "" {
+		return NewError(blocked)
+	}
 	errorFile := strings.Join([]string{fpath, "restore", "error"}, ".")
 	RemoveFile(errorFile)
 	wg := sync.WaitGroup{}
@@ -348,6 +634,19 @@ func badgerRestore(fpath string) error {
 		}
 		defer ft.Close()
 
+		_, err = restoreBlobs(ToUnixSlash(filepath.Join(filepath.Dir(fpath), "blobs")))
+		if err != nil {
+			PrintError("Restore", err)
+			WriteFile(errorFile, []byte(err.Error()))
+			return
+		}
+		_, err = restoreS3Objects(appCtx, ToUnixSlash(filepath.Join(filepath.Dir(fpath), "s3")))
+		if err != nil {
+			PrintError("Restore", err)
+			WriteFile(errorFile, []byte(err.Error()))
+			return
+		}
+
 		err = bgrdb.Load(ft, 16)
 		if err != nil {
 			PrintError("Restore", err)
@@ -359,10 +658,14 @@ func badgerRestore(fpath string) error {
 
 	wg.Wait()
 
-	_, err := os.Stat(errorFile)
+	_, err = os.Stat(errorFile)
 	if err != nil {
 		DebugInfo("badgerRestore", "complete")
-		return nil
+		// the loaded keys bypassed the usage counters and the cache
+		CacheInvalidatePrefix("")
+		StartRecount()
+		// the backup may carry its own dictionaries
+		return LoadDicts()
 	}
 
 	errContent := ReadFile(errorFile)
@@ -372,17 +675,3 @@ func badgerRestore(fpath string) error {
 
 	return nil
 }
-
-func BadgerRunValueLogGC() {
-	ticker := time.NewTicker(5 * time.Minute)
-	defer ticker.Stop()
-	for range ticker.C {
-	again:
-		DebugInfo("RunValueLogGC", 0.5)
-		err := bgrdb.RunValueLogGC(0.5)
-		if err == nil {
-			time.Sleep(3 * time.Second)
-			goto again
-		}
-	}
-}
@@ -0,0 +1,176 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"time"
+
+	badger "github.com/dgraph-io/badger/v4"
+)
+
+// scannedKey is what a delete job needs to know about a key.
+type scannedKey struct {
+	key    []byte
+	owner  uint64
+	stored uint64
+	raw    uint64
+	blob   string
+	object string
+}
+
+// scanKeys calls f for the keys from start while in(key) is true, at most
+// limit of them (0: all), internal keys are skipped.
+func scanKeys(ctx context.Context, start []byte, in func(key []byte) bool, limit int, f func(k scannedKey)) error {
+	return bgrdb.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		n := 0
+		for it.Seek(start); it.Valid(); it.Next() {
+			item := it.Item()
+			if !in(item.Key()) {
+				break
+			}
+			if IsInternalKey(item.Key()) {
+				continue
+			}
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			k := scannedKey{key: item.KeyCopy(nil)}
+			err := item.Value(func(v []byte) error {
+				var h valueHeader
+				h, k.stored, k.raw = valueSizes(v)
+				k.owner = h.Owner
+				k.blob, _ = storedBlob(v)
+				k.object, _ = storedS3(v)
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			f(k)
+			n++
+			if limit > 0 && n >= limit {
+				break
+			}
+		}
+		return nil
+	})
+}
+
+// checkDeletable refuses prefixes and ranges that reach internal keys.
+func checkDeletable(key string, dryRun bool) error {
+	if cfg().IsDisableDelete && !dryRun {
+		return NewError("server disabled the delete action")
+	}
+	if key == "" {
+		return NewError("prefix/start cannot be empty")
+	}
+	if IsInternalKey([]byte(key)) || strings.HasPrefix(internalPrefix, key) {
+		return NewError("key is reserved")
+	}
+	return nil
+}
+
+// StartDeletePrefix deletes every key with prefix in batches, like
+// StartDeleteRange. With dryRun it only counts.
+func StartDeletePrefix(prefix string, dryRun bool) (*Job, error) {
+	if err := checkDeletable(prefix, dryRun); err != nil {
+		return nil, err
+	}
+
+	params := map[string]string{"prefix": prefix, "dry_run": boolString(dryRun)}
+	return StartJob("delete-prefix", params, func(ctx context.Context, j *Job) error {
+		p := []byte(prefix)
+		return deleteKeys(ctx, j, p, func(key []byte) bool { return bytes.HasPrefix(key, p) }, dryRun)
+	}), nil
+}
+
+// StartDeleteRange deletes the keys in [start, end) in batches, like
+// Delete does for one key. With dryRun it only counts.
+func StartDeleteRange(start, end string, dryRun bool) (*Job, error) {
+	if err := checkDeletable(start, dryRun); err != nil {
+		return nil, err
+	}
+	if end == "" || end <= start {
+		return nil, NewError("end must be greater than start")
+	}
+
+	params := map[string]string{"start": start, "end": end, "dry_run": boolString(dryRun)}
+	return StartJob("delete-range", params, func(ctx context.Context, j *Job) error {
+		e := []byte(end)
+		return deleteKeys(ctx, j, []byte(start), func(key []byte) bool { return bytes.Compare(key, e) < 0 }, dryRun)
+	}), nil
+}
+
+// deleteKeys deletes the keys from start while in(key) in transactions of
+// up to 1000, each key with its usage, change log and webhooks. A key
+// written meanwhile is either deleted by a later batch or kept with its
+// counters. A batch which conflicts with those writes, on the usage shards
+// mostly, is retried smaller after a growing pause until ctx is done.
+func deleteKeys(ctx context.Context, j *Job, start []byte, in func(key []byte) bool, dryRun bool) error {
+	if dryRun {
+		return scanKeys(ctx, start, in, 0, func(k scannedKey) {
+			j.Add(1, k.stored, k.raw)
+		})
+	}
+
+	cursor := start
+	size, conflicts := 1000, 0
+	for {
+		var batch []scannedKey
+		err := scanKeys(ctx, cursor, in, size, func(k scannedKey) {
+			batch = append(batch, k)
+		})
+		if err != nil {
+			return err
+		}
+		if len(batch) == 0 {
+			return nil
+		}
+
+		err = bgrdb.Update(func(txn *badger.Txn) error {
+			for _, k := range batch {
+				if _, _, err := txnDelete(txn, k.key); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		for _, k := range batch {
+			CacheInvalidate(k.key)
+		}
+		if err == badger.ErrConflict {
+			conflicts++
+			size = max(size/2, 1)
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(time.Millisecond << min(conflicts, 8)):
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		conflicts = 0
+		size = min(size*2, 1000)
+		wakeWebhooks()
+		for _, k := range batch {
+			j.Add(1, k.stored, k.raw)
+		}
+		// the keys are gone, continue after the last one
+		cursor = append(batch[len(batch)-1].key, 0)
+	}
+}
+
+func boolString(b bool) string {
+	if b {
+		return "true"
+	}
+	return "false"
+}
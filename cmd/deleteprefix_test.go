@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	badger "github.com/dgraph-io/badger/v4"
+)
+
+func TestDeletePrefixWithWrites(t *testing.T) {
+	openTestDB(t, func(s *Settings) {
+		s.IsAllowOverWrite = true
+		s.namespaceQuotas = map[string]Quota{"p": {}}
+	})
+	put := func(key string) {
+		val := []byte(key)
+		if _, err := badgerPut([]byte(key), val, GetXxhash(val), SaveOptions{}); err != nil {
+			t.Error(err)
+		}
+	}
+	for i := 0; i < 3000; i++ {
+		put(fmt.Sprintf("p/%05d", i))
+	}
+
+	// writes racing the delete end up either deleted or counted
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+				put(fmt.Sprintf("p/new%05d", i))
+			}
+		}
+	}()
+	j, err := StartDeletePrefix("p/", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := j.Wait(time.Minute)
+	close(stop)
+	wg.Wait()
+	if done.State != JobDone || done.Keys < 3000 {
+		t.Fatalf("job %s with %d keys: %s", done.State, done.Keys, done.Error)
+	}
+
+	var left uint64
+	err = bgrdb.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.IteratorOptions{Prefix: []byte("p/")})
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			left++
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u := readTestCounter(t, namespaceUsageKey("p")); u.Keys != left {
+		t.Errorf("counter has %d keys, %d are left", u.Keys, left)
+	}
+}
@@ -0,0 +1,212 @@
+package cmd
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	badger "github.com/dgraph-io/badger/v4"
+	"github.com/klauspost/compress/dict"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Trained zstd dictionaries live inside the db:
+//
+//	\x00zstdb/dict/<id>         => dictionary
+//	\x00zstdb/dictprefix/<prefix> => id used for new writes under prefix
+var (
+	dictKeyPrefix       = InternalKey("dict/")
+	dictPrefixKeyPrefix = InternalKey("dictprefix/")
+
+	dictMu       sync.RWMutex
+	dictByID     map[uint32][]byte = make(map[uint32][]byte)
+	dictPrefixes []dictPrefix
+)
+
+type dictPrefix struct {
+	prefix string
+	id     uint32
+}
+
+const dictMinID uint32 = 32768
+
+// LoadDicts reads all dictionaries and prefix assignments into memory.
+func LoadDicts() error {
+	byID := make(map[uint32][]byte)
+	var prefixes []dictPrefix
+
+	err := bgrdb.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		for it.Seek(dictKeyPrefix); it.ValidForPrefix(dictKeyPrefix); it.Next() {
+			item := it.Item()
+			id := Str2Uint64(strings.TrimPrefix(string(item.Key()), string(dictKeyPrefix)))
+			v, err := item.ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+			// dictionaries hold pieces of the samples, they are encrypted like values
+			d, err := decodeInternal(v)
+			if err != nil {
+				return err
+			}
+			byID[uint32(id)] = d
+		}
+
+		for it.Seek(dictPrefixKeyPrefix); it.ValidForPrefix(dictPrefixKeyPrefix); it.Next() {
+			item := it.Item()
+			v, err := item.ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+			prefix := strings.TrimPrefix(string(item.Key()), string(dictPrefixKeyPrefix))
+			prefixes = append(prefixes, dictPrefix{prefix: prefix, id: uint32(Str2Uint64(string(v)))})
+		}
+		return nil
+	})
+	if err != nil {
+		PrintError("LoadDicts", err)
+		return err
+	}
+
+	sort.SliceStable(prefixes, func(i, j int) bool {
+		return len(prefixes[i].prefix) > len(prefixes[j].prefix)
+	})
+
+	dictMu.Lock()
+	dictByID = byID
+	dictPrefixes = prefixes
+	dictMu.Unlock()
+	resetZstdCodecs()
+
+	DebugInfo("LoadDicts", "dicts: ", len(byID), ", prefixes: ", len(prefixes))
+	return nil
+}
+
+// DictFor returns the dictionary assigned to the longest matching prefix of key.
+func DictFor(key []byte) (uint32, []byte) {
+	dictMu.RLock()
+	defer dictMu.RUnlock()
+	for _, dp := range dictPrefixes {
+		if strings.HasPrefix(string(key), dp.prefix) {
+			return dp.id, dictByID[dp.id]
+		}
+	}
+	return 0, nil
+}
+
+func getDict(id uint32) []byte {
+	dictMu.RLock()
+	defer dictMu.RUnlock()
+	return dictByID[id]
+}
+
+// TrainDict samples up to maxSamples values under prefix, trains a zstd
+// dictionary, saves it and assigns it to prefix for new writes.
+func TrainDict(prefix string, maxSamples int, maxDictSize int) (id uint32, samples int, err error) {
+	if maxSamples <= 0 {
+		maxSamples = 2000
+	}
+	if maxDictSize <= 0 {
+		maxDictSize = 64 << 10
+	}
+
+	var input [][]byte
+	err = bgrdb.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		prefixByte := []byte(prefix)
+		for it.Seek(prefixByte); it.ValidForPrefix(prefixByte); it.Next() {
+			if len(input) >= maxSamples {
+				break
+			}
+			item := it.Item()
+			if IsInternalKey(item.Key()) {
+				continue
+			}
+			// dictionaries only help small values
+			if item.ValueSize() > 128<<10 {
+				continue
+			}
+			v, err := item.ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+			if c, _, _, _ := StoredValueInfo(v); c == CodecBlob || c == CodecS3 {
+				continue
+			}
+			raw, err := UnZstdBytes(v)
+			if err != nil {
+				continue
+			}
+			input = append(input, raw)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if len(input) < 8 {
+		return 0, len(input), NewError("not enough samples under prefix")
+	}
+
+	id = nextDictID()
+	d, err := dict.BuildZstdDict(input, dict.Options{
+		MaxDictSize: maxDictSize,
+		HashBytes:   6,
+		ZstdDictID:  id,
+		ZstdLevel:   zstd.SpeedDefault,
+	})
+	if err != nil {
+		PrintError("TrainDict", err)
+		return 0, len(input), err
+	}
+
+	err = bgrdb.Update(func(txn *badger.Txn) error {
+		err := txn.Set(dictKey(id), EncodeValue(d, CompressionPolicy{Codec: CodecNone}))
+		if err != nil {
+			return err
+		}
+		return txn.Set(InternalKey("dictprefix/"+prefix), []byte(Uint64ToString(uint64(id))))
+	})
+	if err != nil {
+		PrintError("TrainDict", err)
+		return 0, len(input), err
+	}
+
+	DebugInfo("TrainDict", "prefix: ", prefix, ", id: ", id, ", samples: ", len(input), ", size: ", len(d))
+	return id, len(input), LoadDicts()
+}
+
+func nextDictID() uint32 {
+	dictMu.RLock()
+	defer dictMu.RUnlock()
+	id := dictMinID
+	for k := range dictByID {
+		if k >= id {
+			id = k + 1
+		}
+	}
+	return id
+}
+
+func dictKey(id uint32) []byte {
+	return InternalKey("dict/" + Uint64ToString(uint64(id)))
+}
+
+// DictList returns prefix => dictionary id and size, for Admin dict-list.
+func DictList() map[string]string {
+	dictMu.RLock()
+	defer dictMu.RUnlock()
+	m := make(map[string]string)
+	for _, dp := range dictPrefixes {
+		m[dp.prefix] = strings.Join([]string{Uint64ToString(uint64(dp.id)), Int2Str(len(dictByID[dp.id]))}, ":")
+	}
+	return m
+}
@@ -0,0 +1,216 @@
+package cmd
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// Writes are blocked by the operator with --disable-set, or automatically
+// by the free space of the disk holding the data dir. Below the soft
+// watermark the value log GC runs and uploads above --disk-soft-max-upload-mb
+// are rejected, below the hard watermark (--min-free-disk-space-mb) all
+// writes are. The file data-dir/reserve holds --disk-reserve-mb, it is
+// deleted at the hard watermark so deletes, GC and compaction still have
+// room, and written again once the free space is above the soft watermark.
+var (
+	DiskSoftFreeMB      uint64
+	DiskSoftMaxUploadMB int64
+	DiskReserveMB       uint64
+
+	diskState atomic.Int32
+	diskFree  atomic.Uint64
+)
+
+const (
+	DiskOK int32 = iota
+	DiskSoft
+	DiskHard
+)
+
+var diskStateNames = []string{"ok", "soft", "hard"}
+
+// minFreeSpace is the hard watermark, --min-free-disk-space-mb in bytes,
+// at least 512MB.
+func minFreeSpace() uint64 {
+	var cmdMinFreeDiskSpaceMB uint64 = cfg().MinFreeDiskSpaceMB
+	if cmdMinFreeDiskSpaceMB < 512 {
+		cmdMinFreeDiskSpaceMB = 512
+	}
+	return cmdMinFreeDiskSpaceMB << 20
+}
+
+// softFreeSpace is the soft watermark, --disk-soft-free-mb in bytes, twice
+// the hard one if not above it.
+func softFreeSpace() uint64 {
+	soft := cfg().DiskSoftFreeMB << 20
+	if soft <= minFreeSpace() {
+		soft = 2 * minFreeSpace()
+	}
+	return soft
+}
+
+// dataDirFree is the free space of the disk holding DataDir, 0 if unknown.
+func dataDirFree() (uint64, error) {
+	absDataDir, err := filepath.Abs(DataDir)
+	if err != nil {
+		return 0, err
+	}
+	absDataDir = filepath.ToSlash(absDataDir)
+	if absDataDir == "" {
+		return 0, nil
+	}
+	return DiskFree(absDataDir), nil
+}
+
+func reservePath() string {
+	return filepath.Join(DataDir, "reserve")
+}
+
+// DiskState is the automatic write block: DiskOK, DiskSoft or DiskHard.
+func DiskState() int32 {
+	return diskState.Load()
+}
+
+func WatchDiskFreeSpace() error {
+	freeSpace, err := dataDirFree()
+	if err != nil {
+		DebugInfo("WatchDiskFreeSpace: ERROR", err)
+		return err
+	}
+	if freeSpace == 0 {
+		return nil
+	}
+	diskFree.Store(freeSpace)
+	watchVolumes()
+
+	soft := softFreeSpace()
+	old := diskState.Load()
+	state := diskLevel(freeSpace, old)
+	if state != old {
+		diskState.Store(state)
+		DebugWarn("WatchDiskFreeSpace", "disk state ", diskStateNames[old], " -> ", diskStateNames[state],
+			", free space ", freeSpace>>20, "MB")
+	}
+
+	reserve := cfg().DiskReserveMB << 20
+	switch {
+	case state == DiskHard || reserve == 0:
+		if err = os.Remove(reservePath()); err == nil {
+			DebugWarn("WatchDiskFreeSpace", "reserved space released")
+		} else if !os.IsNotExist(err) {
+			PrintError("WatchDiskFreeSpace", err)
+		}
+	case state == DiskOK:
+		size := int64(0)
+		if fi, err := os.Stat(reservePath()); err == nil {
+			size = fi.Size()
+		}
+		// growing the reserve must not push the free space below the soft watermark
+		if size == int64(reserve) || (size < int64(reserve) && freeSpace < soft+reserve-uint64(size)) {
+			break
+		}
+		PrintError("WatchDiskFreeSpace", resizeReserve(int64(reserve)))
+	}
+	return nil
+}
+
+// diskLevel is the state for free bytes of free space, old is the state
+// before.
+func diskLevel(free uint64, old int32) int32 {
+	hard, soft := minFreeSpace(), softFreeSpace()
+	switch {
+	case free < hard:
+		return DiskHard
+	// a little above the soft watermark before leaving it, so it does not flap
+	case free < soft, old != DiskOK && free < soft+soft/16:
+		return DiskSoft
+	}
+	return DiskOK
+}
+
+// resizeReserve writes zeros, a sparse file would not hold the space.
+func resizeReserve(size int64) error {
+	f, err := os.OpenFile(reservePath(), os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	cur, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+	if cur > size {
+		return f.Truncate(size)
+	}
+	zeros := make([]byte, 1<<20)
+	for cur < size {
+		n, err := f.Write(zeros[:min(int64(len(zeros)), size-cur)])
+		if err != nil {
+			return err
+		}
+		cur += int64(n)
+	}
+	return f.Sync()
+}
+
+// diskWriteBlocked is why a write of size bytes is refused by the automatic
+// block, "" if it is not. With --volume a value stored as a blob file is
+// checked against the volumes which can take the file, only its pointer
+// goes to the data dir, which is checked against the hard watermark.
+func diskWriteBlocked(size int64) string {
+	state := DiskState()
+	if state == DiskHard {
+		return "disk is full, writes are blocked"
+	}
+	if len(Volumes) > 0 && isBlobSize(int(size)) {
+		if state = blobVolumeLevel(); state == DiskHard {
+			return "no volume has space for the value"
+		}
+	}
+	if state == DiskSoft {
+		if limit := cfg().DiskSoftMaxUploadMB; limit > 0 && size > limit<<20 {
+			return "disk is nearly full, values larger than " + Int64ToString(limit) + "MB are refused"
+		}
+	}
+	return ""
+}
+
+// DiskStats is reported by Admin status.
+func DiskStats() map[string]string {
+	reserve := int64(0)
+	if fi, err := os.Stat(reservePath()); err == nil {
+		reserve = fi.Size()
+	}
+	return map[string]string{
+		"disk_state":          diskStateNames[DiskState()],
+		"disk_free":           Uint64ToString(diskFree.Load()),
+		"disk_soft_watermark": Uint64ToString(softFreeSpace()),
+		"disk_hard_watermark": Uint64ToString(minFreeSpace()),
+		"disk_reserve":        Int64ToString(reserve),
+		"set_disabled":        strconv.FormatBool(cfg().IsDisableSet),
+	}
+}
+
+// diskMetrics are the disk gauges in the Prometheus text format.
+func diskMetrics() string {
+	var b strings.Builder
+	stats := DiskStats()
+	gauge := func(name, help, value string) {
+		b.WriteString("# HELP " + name + " " + help + "\n# TYPE " + name + " gauge\n" + name + " " + value + "\n")
+	}
+	gauge("zstdb_disk_state", "automatic write block: 0 ok, 1 soft watermark, 2 hard watermark", Int2Str(int(DiskState())))
+	gauge("zstdb_disk_free_bytes", "free space of the disk holding the data dir", stats["disk_free"])
+	gauge("zstdb_disk_soft_watermark_bytes", "free space below which large uploads are refused and the gc runs", stats["disk_soft_watermark"])
+	gauge("zstdb_disk_hard_watermark_bytes", "free space below which all writes are refused", stats["disk_hard_watermark"])
+	gauge("zstdb_disk_reserve_bytes", "space held by the reserve file", stats["disk_reserve"])
+	blocked := "0"
+	if cfg().IsDisableSet {
+		blocked = "1"
+	}
+	gauge("zstdb_set_disabled", "writes disabled by the operator", blocked)
+	return b.String()
+}
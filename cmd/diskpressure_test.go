@@ -0,0 +1,118 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDiskLevel(t *testing.T) {
+	openTestDB(t, func(s *Settings) {
+		s.MinFreeDiskSpaceMB = 1024
+		s.DiskSoftFreeMB = 0
+	})
+	const mb = 1 << 20
+	if hard, soft := minFreeSpace(), softFreeSpace(); hard != 1024*mb || soft != 2048*mb {
+		t.Fatalf("watermarks %d %d", hard, soft)
+	}
+	tests := []struct {
+		free uint64
+		old  int32
+		want int32
+	}{
+		{4096 * mb, DiskOK, DiskOK},
+		{2047 * mb, DiskOK, DiskSoft},
+		{1023 * mb, DiskOK, DiskHard},
+		{1023 * mb, DiskSoft, DiskHard},
+		// leaving the soft watermark takes 1/16 more
+		{2100 * mb, DiskSoft, DiskSoft},
+		{2100 * mb, DiskHard, DiskSoft},
+		{2100 * mb, DiskOK, DiskOK},
+		{2200 * mb, DiskSoft, DiskOK},
+		{1500 * mb, DiskHard, DiskSoft},
+	}
+	for _, tt := range tests {
+		if got := diskLevel(tt.free, tt.old); got != tt.want {
+			t.Errorf("%dMB from %s: %s, want %s", tt.free/mb, diskStateNames[tt.old], diskStateNames[got], diskStateNames[tt.want])
+		}
+	}
+}
+
+func TestDiskWriteBlocked(t *testing.T) {
+	openTestDB(t, func(s *Settings) {
+		s.DiskSoftMaxUploadMB = 4
+	})
+	t.Cleanup(func() { diskState.Store(DiskOK) })
+
+	tests := []struct {
+		state   int32
+		size    int64
+		blocked bool
+	}{
+		{DiskOK, 1 << 30, false},
+		{DiskSoft, 4 << 20, false},
+		{DiskSoft, 4<<20 + 1, true},
+		{DiskHard, 0, true},
+	}
+	for _, tt := range tests {
+		diskState.Store(tt.state)
+		if got := diskWriteBlocked(tt.size); (got != "") != tt.blocked {
+			t.Errorf("%s, %d bytes: %q", diskStateNames[tt.state], tt.size, got)
+		}
+	}
+
+	// nor restore nor rewarm write at the hard watermark
+	diskState.Store(DiskHard)
+	backup := filepath.Join(t.TempDir(), "b.zstdb.bak")
+	if err := os.WriteFile(backup, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := badgerRestore(backup); err == nil {
+		t.Error("restored at the hard watermark")
+	}
+	rewarm([]byte("k"), 1, valueHeader{}, []byte("obj"), []byte("raw"))
+	if _, busy := rewarming.Load("k"); busy {
+		t.Error("rewarm started at the hard watermark")
+	}
+}
+
+func TestWatchDiskFreeSpace(t *testing.T) {
+	openTestDB(t, nil)
+	free, err := dataDirFree()
+	if err != nil || free == 0 {
+		t.Skip("free space unknown:", err)
+	}
+	t.Cleanup(func() { diskState.Store(DiskOK) })
+
+	// in order: the reserve is written, then released at the hard watermark
+	tests := []struct {
+		name      string
+		minFreeMB uint64
+		state     int32
+		reserve   int64
+	}{
+		{"ok", 512, DiskOK, 1 << 20},
+		{"hard", free>>20 + 1024, DiskHard, -1},
+	}
+	if free < 4<<30 {
+		t.Skip("less than 4GB free")
+	}
+	for _, tt := range tests {
+		s := *cfg()
+		s.MinFreeDiskSpaceMB, s.DiskReserveMB = tt.minFreeMB, 1
+		settings.Store(&s)
+		if err := WatchDiskFreeSpace(); err != nil {
+			t.Fatal(err)
+		}
+		if DiskState() != tt.state {
+			t.Errorf("%s: state %s", tt.name, diskStateNames[DiskState()])
+		}
+		size := int64(-1)
+		if fi, err := os.Stat(reservePath()); err == nil {
+			size = fi.Size()
+		}
+		if size != tt.reserve {
+			t.Errorf("%s: reserve of %d bytes, want %d", tt.name, size, tt.reserve)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package cmd
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// A write is acknowledged once it is committed, which survives a crash of
+// zstdb but not of the machine. With durability sync the value log and the
+// write-ahead log are fsynced before the reply; group does the same but
+// writers arriving within --group-commit-window share one fsync. A request
+// may choose with the grpc metadata x-zstdb-durability: async or sync
+// (which is group if the server runs with group).
+var (
+	Durability        string
+	GroupCommitWindow time.Duration
+
+	syncCount    atomic.Uint64
+	syncedWrites atomic.Uint64
+
+	groupMu    sync.Mutex
+	groupBatch *syncBatch
+)
+
+const (
+	DurabilityAsync = "async"
+	DurabilitySync  = "sync"
+	DurabilityGroup = "group"
+)
+
+type syncBatch struct {
+	done chan struct{}
+	err  error
+}
+
+func checkDurability(mode string) error {
+	if mode != DurabilityAsync && mode != DurabilitySync && mode != DurabilityGroup {
+		return NewError("durability must be async, sync or group")
+	}
+	return nil
+}
+
+// requestDurability is the durability a write request asks for.
+func requestDurability(ctx context.Context) (string, error) {
+	mode := incomingMeta(ctx, "x-zstdb-durability")
+	switch mode {
+	case "":
+		return cfg().Durability, nil
+	case DurabilitySync:
+		if cfg().Durability == DurabilityGroup {
+			return DurabilityGroup, nil
+		}
+		return DurabilitySync, nil
+	case DurabilityAsync:
+		return DurabilityAsync, nil
+	}
+	return "", NewError("x-zstdb-durability must be async or sync")
+}
+
+// waitDurable returns once the writes committed before the call are on
+// disk, as mode requires.
+func waitDurable(mode string) error {
+	if mode == DurabilityAsync || bgrdb.Opts().SyncWrites {
+		return nil
+	}
+	syncedWrites.Add(1)
+	if mode != DurabilityGroup || cfg().GroupCommitWindow <= 0 {
+		syncCount.Add(1)
+		return badgerSync()
+	}
+
+	// the first writer of a batch waits for the window, then syncs for all
+	groupMu.Lock()
+	b := groupBatch
+	leader := b == nil
+	if leader {
+		b = &syncBatch{done: make(chan struct{})}
+		groupBatch = b
+	}
+	groupMu.Unlock()
+
+	if !leader {
+		<-b.done
+		return b.err
+	}
+
+	time.Sleep(cfg().GroupCommitWindow)
+	groupMu.Lock()
+	// later writers may commit after the fsync started, they start the next batch
+	groupBatch = nil
+	groupMu.Unlock()
+
+	syncCount.Add(1)
+	b.err = badgerSync()
+	close(b.done)
+	return b.err
+}
+
+// DurabilityStats is reported by Admin status.
+func DurabilityStats() map[string]string {
+	return map[string]string{
+		"synced_writes": Uint64ToString(syncedWrites.Load()),
+		"syncs":         Uint64ToString(syncCount.Load()),
+	}
+}
@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	badger "github.com/dgraph-io/badger/v4"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestRequestDurability(t *testing.T) {
+	tests := []struct {
+		server, header, want string
+		err                  bool
+	}{
+		{DurabilityAsync, "", DurabilityAsync, false},
+		{DurabilitySync, "", DurabilitySync, false},
+		{DurabilityGroup, "", DurabilityGroup, false},
+		{DurabilityAsync, "sync", DurabilitySync, false},
+		{DurabilityGroup, "sync", DurabilityGroup, false},
+		{DurabilitySync, "async", DurabilityAsync, false},
+		{DurabilitySync, "group", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.server+"/"+tt.header, func(t *testing.T) {
+			openTestDB(t, func(s *Settings) {
+				s.Durability = tt.server
+			})
+			ctx := context.Background()
+			if tt.header != "" {
+				ctx = metadata.NewIncomingContext(ctx, metadata.Pairs("x-zstdb-durability", tt.header))
+			}
+			got, err := requestDurability(ctx)
+			if got != tt.want || (err != nil) != tt.err {
+				t.Errorf("got %q, %v", got, err)
+			}
+		})
+	}
+}
+
+func TestGroupCommit(t *testing.T) {
+	const window = 50 * time.Millisecond
+	openTestDB(t, func(s *Settings) {
+		s.GroupCommitWindow = window
+	})
+	// an in-memory db has no log to sync
+	db, err := badger.Open(badger.DefaultOptions(t.TempDir()).WithLogger(nil).WithMemTableSize(8 << 20))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bgrdb = db
+	t.Cleanup(func() { db.Close() })
+
+	tests := []struct {
+		mode       string
+		writers    int
+		minSync    uint64
+		maxSync    uint64
+		syncWrites uint64
+	}{
+		{DurabilityAsync, 10, 0, 0, 0},
+		{DurabilitySync, 10, 10, 10, 10},
+		// the writers arrive well within one window, a slow start may split
+		// them in two batches
+		{DurabilityGroup, 10, 1, 2, 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			syncs, writes := syncCount.Load(), syncedWrites.Load()
+			start := time.Now()
+			var wg sync.WaitGroup
+			for i := 0; i < tt.writers; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					if err := waitDurable(tt.mode); err != nil {
+						t.Error(err)
+					}
+				}()
+			}
+			wg.Wait()
+
+			gotSyncs, gotWrites := syncCount.Load()-syncs, syncedWrites.Load()-writes
+			if gotSyncs < tt.minSync || gotSyncs > tt.maxSync {
+				t.Errorf("%d syncs for %d writers", gotSyncs, tt.writers)
+			}
+			if gotWrites != tt.syncWrites {
+				t.Errorf("%d synced writes, want %d", gotWrites, tt.syncWrites)
+			}
+			// nobody of a group returns before the sync of the window
+			if elapsed := time.Since(start); tt.mode == DurabilityGroup && elapsed < window {
+				t.Errorf("returned after %v, before the window", elapsed)
+			}
+		})
+	}
+}
@@ -1,139 +1,226 @@
 package cmd
 
 import (
-	"fmt"
+	"compress/gzip"
+	"io"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 )
 
-var LogDir string
-var LogMaxSizeMB int64
-var errorLogFile string
-var errorLogFileHandler *os.File
-var enableFileLogging bool
+// The file log is <log-dir>/zstdb_<host>_<port>.log. It is rotated when it
+// is larger than --log-max-size-mb or older than --log-rotate-every, the
+// old file is gzipped to zstdb_<host>_<port>_<time>.log.gz and only the
+// newest --log-keep of them are kept.
+var (
+	LogDir         string
+	LogMaxSizeMB   int64
+	LogRotateEvery time.Duration
+	LogKeep        int
+
+	fileLogMu sync.Mutex
+	fileLog   *rotatingFile
+)
 
-var logChan chan string = make(chan string, 1000)
+type rotatingFile struct {
+	mu     sync.Mutex
+	path   string
+	fp     *os.File
+	size   int64
+	opened time.Time
+	gzipWG sync.WaitGroup
+}
 
 func StartFileLogging() error {
-	time.Sleep(1 * time.Second)
 	if LogDir == "" {
 		return nil
 	}
+	if err := MakeDirs(LogDir); err != nil {
+		PrintError("StartFileLogging", err)
+		return err
+	}
 
-	refreshErrorLogFileHandler()
-
-	go func() {
-		var msg string
-
-		fp, err := refreshErrorLogFileHandler()
-		if err != nil {
-			PrintError("StartFileLogging", err)
-			enableFileLogging = false
-			return
-		}
-
-		for {
-			msg = <-logChan
-			if msg == "refresh-error-log-file-handler" {
-				fp.Close()
-				fp, err = refreshErrorLogFileHandler()
-				if err != nil {
-					PrintError("refreshErrorLogFileHandler", err)
-					enableFileLogging = false
-					break
-				}
-				continue
-			}
-			if msg != "" {
-				fp.WriteString(fmt.Sprintf("%v\n", msg))
-			}
+	rf := &rotatingFile{
+		path: ToUnixSlash(filepath.Join(LogDir, strings.Join([]string{"zstdb", Host, Port}, "_")+".log")),
+	}
+	if err := rf.open(); err != nil {
+		PrintError("StartFileLogging", err)
+		return err
+	}
 
-		}
-	}()
+	fileLogMu.Lock()
+	fileLog = rf
+	fileLogMu.Unlock()
+	buildLogger()
 
+	DebugInfo("StartFileLogging", "enabled => ", rf.path)
 	return nil
 }
 
-func StopFileLogging() {
-	if LogDir != "" {
-		return
+// fileLogWriter is nil when file logging is off.
+func fileLogWriter() io.Writer {
+	fileLogMu.Lock()
+	defer fileLogMu.Unlock()
+	if fileLog == nil {
+		return nil
 	}
-	enableFileLogging = false
-	close(logChan)
-	errorLogFileHandler.Close()
+	return fileLog
 }
 
-func refreshErrorLogFileHandler() (*os.File, error) {
+func StopFileLogging() {
 	if LogDir == "" {
-		return nil, NewError("file logging is not active")
+		return
 	}
 
-	enableFileLogging = false
-	if errorLogFile != "" {
-		errorLogFileHandler.Close()
+	fileLogMu.Lock()
+	rf := fileLog
+	fileLog = nil
+	fileLogMu.Unlock()
+	if rf == nil {
+		return
 	}
-	errorLogFile = ToUnixSlash(filepath.Join(LogDir, strings.Join([]string{"zstdb", Host, Port, time.Now().Format("20060102"), "error.log"}, "_")))
-	if LogMaxSizeMB < 1 {
-		LogMaxSizeMB = 1
+
+	buildLogger()
+	rf.Close()
+}
+
+func (rf *rotatingFile) open() error {
+	fp, err := os.OpenFile(rf.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
 	}
-	lfinfo, err := os.Stat(errorLogFile)
-	if err == nil {
-		maxSize := LogMaxSizeMB << 20
-		if lfinfo.Size() > maxSize {
-			err = os.Truncate(errorLogFile, 0)
-			DebugWarn("refreshErrorLogFileHandler", "truncate log file")
-			if err != nil {
-				PrintError("refreshErrorLogFileHandler", err)
-				return nil, err
-			}
+	fi, err := fp.Stat()
+	if err != nil {
+		fp.Close()
+		return err
+	}
+	rf.fp = fp
+	rf.size = fi.Size()
+	rf.opened = time.Now()
+	return nil
+}
+
+func (rf *rotatingFile) Write(p []byte) (int, error) {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	if rf.fp == nil {
+		return 0, os.ErrClosed
+	}
+
+	if rf.isDue(int64(len(p))) {
+		if err := rf.rotate(); err != nil {
+			// keep logging into the current file
+			rf.size = 0
+		}
+		if rf.fp == nil {
+			return 0, os.ErrClosed
 		}
 	}
 
-	errorLogFileHandler, err = os.OpenFile(errorLogFile, os.O_CREATE|os.O_RDWR|os.O_APPEND, os.ModeAppend|os.ModePerm)
-	if err != nil {
-		PrintError("cannot open log file", err)
-		return nil, err
+	n, err := rf.fp.Write(p)
+	rf.size += int64(n)
+	return n, err
+}
+
+func (rf *rotatingFile) isDue(next int64) bool {
+	if rf.size == 0 {
+		return false
+	}
+	s := cfg()
+	if s.LogMaxSizeMB > 0 && rf.size+next > s.LogMaxSizeMB<<20 {
+		return true
+	}
+	return s.LogRotateEvery > 0 && time.Since(rf.opened) > s.LogRotateEvery
+}
+
+func (rf *rotatingFile) rotate() error {
+	rf.fp.Close()
+	rf.fp = nil
+
+	base := strings.TrimSuffix(rf.path, ".log")
+	rotated := base + "_" + time.Now().Format("20060102T150405.000") + ".log"
+	err := os.Rename(rf.path, rotated)
+	if err == nil {
+		rf.gzipWG.Add(1)
+		go func() {
+			defer rf.gzipWG.Done()
+			gzipFile(rotated)
+			pruneLogs(base, cfg().LogKeep)
+		}()
 	}
-	enableFileLogging = true
 
-	return errorLogFileHandler, nil
+	if oerr := rf.open(); oerr != nil {
+		return oerr
+	}
+	return err
 }
 
-func WatchErrorLogFile() error {
-	if LogDir == "" {
+func (rf *rotatingFile) Close() error {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	rf.gzipWG.Wait()
+	if rf.fp == nil {
 		return nil
 	}
+	err := rf.fp.Close()
+	rf.fp = nil
+	return err
+}
+
+// RotateLogIfDue rotates by time even when nothing is logged, cron calls it.
+func RotateLogIfDue() {
+	fileLogMu.Lock()
+	rf := fileLog
+	fileLogMu.Unlock()
+	if rf == nil {
+		return
+	}
 
-	lfinfo, err := os.Stat(errorLogFile)
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	if rf.fp != nil && rf.isDue(0) {
+		rf.rotate()
+	}
+}
+
+func gzipFile(path string) error {
+	in, err := os.Open(path)
 	if err != nil {
-		logChan <- "refresh-error-log-file-handler"
-		PrintError("WatchErrorLogFile", err)
-		DebugWarn("WatchErrorLogFile", errorLogFile)
 		return err
 	}
-	maxSize := LogMaxSizeMB << 20
-	if lfinfo.Size() > maxSize {
-		logChan <- "refresh-error-log-file-handler"
+	defer in.Close()
+
+	out, err := os.OpenFile(path+".gz", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
 	}
-	if time.Now().Format("1504") == "0000" {
-		logChan <- "refresh-error-log-file-handler"
+	zw := gzip.NewWriter(out)
+	_, err = io.Copy(zw, in)
+	if cerr := zw.Close(); err == nil {
+		err = cerr
 	}
-
-	return nil
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(path + ".gz")
+		return err
+	}
+	return os.Remove(path)
 }
 
-func flog(args ...any) error {
-	if LogDir == "" || !enableFileLogging {
-		return nil
+// pruneLogs keeps the newest keep rotated logs of base, 0 keeps all.
+func pruneLogs(base string, keep int) {
+	if keep <= 0 {
+		return
 	}
-
-	var info []string
-	info = append(info, time.Now().Format("2006-01-02 15:04:05"))
-	for _, arg := range args {
-		info = append(info, fmt.Sprintf("%v", arg))
+	files, _ := filepath.Glob(base + "_*.log.gz")
+	sort.Strings(files)
+	for len(files) > keep {
+		os.Remove(files[0])
+		files = files[1:]
 	}
-	logChan <- strings.Join(info, " ")
-	return nil
 }
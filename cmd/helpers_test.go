@@ -0,0 +1,34 @@
+package cmd
+
+import (
+	"testing"
+
+	badger "github.com/dgraph-io/badger/v4"
+)
+
+// openTestDB points bgrdb at an in-memory db and DataDir at a temp dir,
+// with the settings of the default flags changed by set.
+func openTestDB(t testing.TB, set func(s *Settings)) {
+	t.Helper()
+	db, err := badger.Open(badger.DefaultOptions("").WithInMemory(true).WithLogger(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := buildSettings()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if set != nil {
+		set(s)
+	}
+
+	prevDB, prevDir, prevSettings := bgrdb, DataDir, settings.Load()
+	bgrdb, DataDir = db, t.TempDir()
+	settings.Store(s)
+
+	t.Cleanup(func() {
+		db.Close()
+		bgrdb, DataDir = prevDB, prevDir
+		settings.Store(prevSettings)
+	})
+}
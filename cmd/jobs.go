@@ -0,0 +1,214 @@
+package cmd
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	badger "github.com/dgraph-io/badger/v4"
+)
+
+// Long Admin operations run as jobs. Each job is saved under
+// \x00zstdb/jobs/<id:8> whenever it changes, so Admin jobs still lists
+// them after a restart; a job running at shutdown is listed as interrupted.
+const (
+	JobRunning     = "running"
+	JobDone        = "done"
+	JobFailed      = "failed"
+	JobInterrupted = "interrupted"
+)
+
+type Job struct {
+	ID       uint64            `json:"id"`
+	Kind     string            `json:"kind"`
+	Params   map[string]string `json:"params,omitempty"`
+	State    string            `json:"state"`
+	Started  time.Time         `json:"started"`
+	Finished time.Time         `json:"finished,omitzero"`
+	Keys     uint64            `json:"keys"`
+	Bytes    uint64            `json:"bytes"`
+	RawBytes uint64            `json:"raw_bytes"`
+	Error    string            `json:"error,omitempty"`
+
+	done chan struct{}
+}
+
+var (
+	jobsMu sync.Mutex
+	jobs   map[uint64]*Job = make(map[uint64]*Job)
+	jobSeq atomic.Uint64
+)
+
+const maxJobs = 100
+
+func jobKey(id uint64) []byte {
+	return binary.BigEndian.AppendUint64(InternalKey("jobs/"), id)
+}
+
+// LoadJobs reads the saved jobs after the db is opened.
+func LoadJobs() error {
+	jobSeq.Store(uint64(time.Now().UnixMilli()))
+
+	var list []*Job
+	err := bgrdb.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = InternalKey("jobs/")
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			err := it.Item().Value(func(v []byte) error {
+				j := &Job{}
+				if err := json.Unmarshal(v, j); err != nil {
+					return err
+				}
+				list = append(list, j)
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	jobsMu.Lock()
+	defer jobsMu.Unlock()
+	for _, j := range list {
+		if j.State == JobRunning {
+			j.State = JobInterrupted
+			saveJob(j)
+		}
+		jobs[j.ID] = j
+		if j.ID >= jobSeq.Load() {
+			jobSeq.Store(j.ID)
+		}
+	}
+	pruneJobs()
+	return nil
+}
+
+// saveJob is called with jobsMu held.
+func saveJob(j *Job) {
+	b, err := json.Marshal(j)
+	if err != nil {
+		PrintError("saveJob", err)
+		return
+	}
+	err = bgrdb.Update(func(txn *badger.Txn) error {
+		return txn.Set(jobKey(j.ID), b)
+	})
+	PrintError("saveJob", err)
+}
+
+// pruneJobs keeps the newest maxJobs finished jobs, called with jobsMu held.
+func pruneJobs() {
+	if len(jobs) <= maxJobs {
+		return
+	}
+	var ids []uint64
+	for id, j := range jobs {
+		if j.State != JobRunning {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(a, b int) bool { return ids[a] < ids[b] })
+	for _, id := range ids {
+		if len(jobs) <= maxJobs {
+			break
+		}
+		delete(jobs, id)
+		bgrdb.Update(func(txn *badger.Txn) error {
+			return txn.Delete(jobKey(id))
+		})
+	}
+}
+
+// StartJob runs fn in the background, fn updates the counters of j with
+// j.Add.
+func StartJob(kind string, params map[string]string, fn func(ctx context.Context, j *Job) error) *Job {
+	j := &Job{
+		ID:      jobSeq.Add(1),
+		Kind:    kind,
+		Params:  params,
+		State:   JobRunning,
+		Started: time.Now().UTC(),
+		done:    make(chan struct{}),
+	}
+
+	jobsMu.Lock()
+	jobs[j.ID] = j
+	saveJob(j)
+	pruneJobs()
+	jobsMu.Unlock()
+
+	DebugInfo("StartJob", kind, " #", j.ID)
+	GoBackground("job "+kind, func(ctx context.Context) {
+		defer close(j.done)
+		err := fn(ctx, j)
+
+		jobsMu.Lock()
+		defer jobsMu.Unlock()
+		j.Finished = time.Now().UTC()
+		switch {
+		case err == nil:
+			j.State = JobDone
+		case ctx.Err() != nil:
+			j.State = JobInterrupted
+			j.Error = err.Error()
+		default:
+			j.State = JobFailed
+			j.Error = err.Error()
+		}
+		saveJob(j)
+		if err != nil {
+			PrintError("job "+kind, err)
+		}
+	})
+	return j
+}
+
+// Add counts keys and bytes processed by the job.
+func (j *Job) Add(keys, bytes, rawBytes uint64) {
+	jobsMu.Lock()
+	j.Keys += keys
+	j.Bytes += bytes
+	j.RawBytes += rawBytes
+	jobsMu.Unlock()
+}
+
+// Wait waits up to d for the job to finish and returns a copy of it.
+func (j *Job) Wait(d time.Duration) Job {
+	select {
+	case <-j.done:
+	case <-time.After(d):
+	}
+	return GetJob(j.ID)
+}
+
+func GetJob(id uint64) Job {
+	jobsMu.Lock()
+	defer jobsMu.Unlock()
+	if j, ok := jobs[id]; ok {
+		return *j
+	}
+	return Job{}
+}
+
+// ListJobs returns the jobs, newest first.
+func ListJobs() []Job {
+	jobsMu.Lock()
+	defer jobsMu.Unlock()
+	list := make([]Job, 0, len(jobs))
+	for _, j := range jobs {
+		list = append(list, *j)
+	}
+	sort.Slice(list, func(a, b int) bool { return list[a].ID > list[b].ID })
+	return list
+}
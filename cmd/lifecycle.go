@@ -0,0 +1,168 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Exit codes of the server process.
+const (
+	ExitOK           = 0
+	ExitError        = 1
+	ExitDrainTimeout = 2
+)
+
+var (
+	ShutdownTimeout time.Duration
+
+	// appCtx is cancelled when the server starts shutting down, every
+	// background loop started with GoBackground watches it.
+	appCtx    context.Context
+	appCancel context.CancelFunc
+
+	bgWG       sync.WaitGroup
+	shutdownMu sync.Mutex
+	shutdownCh chan int
+	isStopping bool
+)
+
+func init() {
+	appCtx, appCancel = context.WithCancel(context.Background())
+	shutdownCh = make(chan int, 1)
+}
+
+// GoBackground runs f in a goroutine which Shutdown waits for,
+// f must return soon after ctx is done.
+func GoBackground(name string, f func(ctx context.Context)) {
+	bgWG.Add(1)
+	go func() {
+		defer bgWG.Done()
+		f(appCtx)
+		DebugInfo("GoBackground", name, " stopped")
+	}()
+}
+
+// IsStopping tells if Shutdown has been called.
+func IsStopping() bool {
+	shutdownMu.Lock()
+	defer shutdownMu.Unlock()
+	return isStopping
+}
+
+// Shutdown stops the server once: no new rpc is accepted, in-flight rpc,
+// backups and GC are drained within --shutdown-timeout, then the db is
+// closed and WaitShutdown returns the exit code.
+func Shutdown(reason string, code int) {
+	shutdownMu.Lock()
+	if isStopping {
+		shutdownMu.Unlock()
+		return
+	}
+	isStopping = true
+	shutdownMu.Unlock()
+
+	PrintlnInfo("zstdb", "shutting down: ", reason)
+	timeout := cfg().ShutdownTimeout
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	deadline := time.Now().Add(timeout)
+
+	appCancel()
+
+	if !drain("grpc", deadline, func() {
+		if rpcServer != nil {
+			rpcServer.GracefulStop()
+		}
+	}) {
+		if rpcServer != nil {
+			rpcServer.Stop()
+		}
+		code = ExitDrainTimeout
+	}
+
+	CloseAuditLog()
+
+	if !drain("cron", deadline, func() {
+		scheduleMu.Lock()
+		task := ScheduleTask
+		scheduleMu.Unlock()
+		if task != nil {
+			// waits for a running auto backup
+			<-task.Stop().Done()
+		}
+	}) {
+		code = ExitDrainTimeout
+	}
+
+	if !drain("background", deadline, bgWG.Wait) {
+		code = ExitDrainTimeout
+	}
+
+	if bgrdb != nil && code == ExitDrainTimeout {
+		// a handler, GC, backup or scrub may still use bgrdb, closing it
+		// under them can panic or corrupt; sync and let the next open
+		// replay the WAL instead
+		badgerSync()
+		PrintlnInfo("Shutdown", "drain timed out, exit without closing bgrdb")
+	} else if bgrdb != nil {
+		badgerSync()
+		if err := bgrdb.Close(); err != nil {
+			PrintError("Shutdown", err)
+			if code == ExitOK {
+				code = ExitError
+			}
+		}
+	}
+
+	if pidFile != "" {
+		RemoveFile(pidFile)
+	}
+	if rpcFile != "" {
+		RemoveFile(rpcFile)
+	}
+
+	StopFileLogging()
+	PrintlnInfo("zstdb", "Bye ... exit code: ", code)
+	shutdownCh <- code
+}
+
+// drain runs f and waits for it until deadline, false if it did not finish.
+func drain(name string, deadline time.Time, f func()) bool {
+	done := make(chan struct{})
+	go func() {
+		f()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		DebugInfo("Shutdown", name, " drained")
+		return true
+	case <-time.After(time.Until(deadline)):
+		DebugWarn("Shutdown", name, " did not drain before --shutdown-timeout")
+		return false
+	}
+}
+
+// WaitShutdown blocks until Shutdown has finished.
+func WaitShutdown() int {
+	return <-shutdownCh
+}
+
+func onExit() {
+	c := make(chan os.Signal, 2)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-c
+		go Shutdown(sig.String(), ExitOK)
+		// a second signal skips the drain
+		sig = <-c
+		PrintlnInfo("zstdb", "forced exit: ", sig.String())
+		os.Exit(ExitDrainTimeout)
+	}()
+}
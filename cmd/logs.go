@@ -1,53 +1,239 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
-	"log"
+	"io"
+	"log/slog"
+	"os"
 	"strings"
+	"sync"
+	"time"
+
+	pb "zstdb/pbs"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
 )
 
-func FatalError(prefix string, err error) {
+// Everything is logged through one slog.Logger: the console gets
+// --log-level (debug with --debug), the file in --log-dir gets
+// --log-file-level, both in --log-format.
+var (
+	LogFormat    string
+	LogLevel     string
+	LogFileLevel string
+
+	consoleLevel = new(slog.LevelVar)
+	fileLevel    = new(slog.LevelVar)
+
+	loggerMu sync.RWMutex
+	logger   *slog.Logger = slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: consoleLevel}))
+)
+
+type ctxKeyLogger struct{}
+
+// SetupLogging applies the log flags, it is called again on reload.
+func SetupLogging() {
+	lv, flv, _ := logLevels(cfg())
+	consoleLevel.Set(lv)
+	fileLevel.Set(flv)
+	buildLogger()
+}
+
+// logLevels are the console and file levels of s.
+func logLevels(s *Settings) (lv, flv slog.Level, err error) {
+	lv, err = parseLevel(s.LogLevel, slog.LevelInfo)
 	if err != nil {
-		log.Println(Red("ERROR:"), Red(prefix), err)
-		flog("FATAL", prefix, err.Error())
-		log.Fatal(err)
+		return lv, flv, err
 	}
+	if s.IsDebug {
+		lv = slog.LevelDebug
+	}
+	flv, err = parseLevel(s.LogFileLevel, slog.LevelWarn)
+	return lv, flv, err
 }
 
-func DebugInfo(prefix string, args ...any) {
-	if IsDebug {
-		var info []string
-		for _, arg := range args {
-			info = append(info, fmt.Sprintf("%v", arg))
+func parseLevel(s string, def slog.Level) (slog.Level, error) {
+	if s == "" {
+		return def, nil
+	}
+	var lv slog.Level
+	if err := lv.UnmarshalText([]byte(s)); err != nil {
+		return def, NewError("invalid log level: " + s)
+	}
+	return lv, nil
+}
+
+func newHandler(w io.Writer, level slog.Leveler) slog.Handler {
+	opts := &slog.HandlerOptions{Level: level}
+	if cfg().LogFormat == "json" {
+		return slog.NewJSONHandler(w, opts)
+	}
+	return slog.NewTextHandler(w, opts)
+}
+
+func buildLogger() {
+	handlers := []slog.Handler{newHandler(os.Stderr, consoleLevel)}
+	if w := fileLogWriter(); w != nil {
+		handlers = append(handlers, newHandler(w, fileLevel))
+	}
+
+	loggerMu.Lock()
+	logger = slog.New(multiHandler(handlers))
+	loggerMu.Unlock()
+}
+
+// Logger returns the logger of ctx, with the fields of the request, or the
+// default one.
+func Logger(ctx context.Context) *slog.Logger {
+	if l, ok := ctx.Value(ctxKeyLogger{}).(*slog.Logger); ok {
+		return l
+	}
+	return defaultLogger()
+}
+
+func defaultLogger() *slog.Logger {
+	loggerMu.RLock()
+	defer loggerMu.RUnlock()
+	return logger
+}
+
+// WithLogFields adds fields to every log line written with Logger(ctx).
+func WithLogFields(ctx context.Context, args ...any) context.Context {
+	return context.WithValue(ctx, ctxKeyLogger{}, Logger(ctx).With(args...))
+}
+
+// multiHandler sends each record to every handler which accepts its level.
+type multiHandler []slog.Handler
+
+func (m multiHandler) Enabled(ctx context.Context, lv slog.Level) bool {
+	for _, h := range m {
+		if h.Enabled(ctx, lv) {
+			return true
 		}
-		log.Printf("INFO: %v: %v\n", prefix, strings.Join(info, ""))
 	}
+	return false
 }
 
-func DebugWarn(prefix string, args ...any) {
-	if IsDebug {
-		var info []string
-		for _, arg := range args {
-			info = append(info, fmt.Sprintf("%v", arg))
+func (m multiHandler) Handle(ctx context.Context, r slog.Record) error {
+	var err error
+	for _, h := range m {
+		if h.Enabled(ctx, r.Level) {
+			if e := h.Handle(ctx, r.Clone()); e != nil {
+				err = e
+			}
 		}
-		log.Println(Yellow("WARN:"), Yellow(prefix+":"), Yellow(strings.Join(info, "")))
 	}
-	flog("WARN", prefix, args)
+	return err
 }
 
-func PrintError(prefix string, err error) {
+func (m multiHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	hs := make(multiHandler, len(m))
+	for i, h := range m {
+		hs[i] = h.WithAttrs(attrs)
+	}
+	return hs
+}
+
+func (m multiHandler) WithGroup(name string) slog.Handler {
+	hs := make(multiHandler, len(m))
+	for i, h := range m {
+		hs[i] = h.WithGroup(name)
+	}
+	return hs
+}
+
+// LogInterceptor gives each rpc a logger with its method, key and peer,
+// handlers log with Logger(ctx).
+func LogInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	method := info.FullMethod[strings.LastIndex(info.FullMethod, "/")+1:]
+	fields := []any{"method", method, "peer", PeerAddr(ctx)}
+	switch in := req.(type) {
+	case *pb.Item:
+		fields = append(fields, "key", string(in.Key))
+	case *pb.RangeRequest:
+		fields = append(fields, "key", string(in.Key))
+	case *pb.ListFilter:
+		fields = append(fields, "prefix", in.Prefix)
+	}
+	ctx = WithLogFields(ctx, fields...)
+
+	t := time.Now()
+	resp, err := handler(ctx, req)
 	if err != nil {
-		log.Println(Red("ERROR:"), Red(prefix), err)
-		flog("ERROR", prefix, err.Error())
+		Logger(ctx).Warn("rpc failed", "code", status.Code(err).String(), "err", err, "elapsed", time.Since(t))
+	} else {
+		Logger(ctx).Debug("rpc", "elapsed", time.Since(t))
 	}
+	return resp, err
 }
 
-func PrintlnInfo(prefix string, args ...any) {
+type loggedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *loggedStream) Context() context.Context {
+	return s.ctx
+}
+
+func StreamLogInterceptor(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	method := info.FullMethod[strings.LastIndex(info.FullMethod, "/")+1:]
+	ctx := WithLogFields(ss.Context(), "method", method, "peer", PeerAddr(ss.Context()))
+
+	t := time.Now()
+	err := handler(srv, &loggedStream{ServerStream: ss, ctx: ctx})
+	if err != nil {
+		Logger(ctx).Warn("rpc failed", "code", status.Code(err).String(), "err", err, "elapsed", time.Since(t))
+	} else {
+		Logger(ctx).Debug("rpc", "elapsed", time.Since(t))
+	}
+	return err
+}
+
+func joinArgs(args []any) string {
 	var info []string
 	for _, arg := range args {
 		info = append(info, fmt.Sprintf("%v", arg))
 	}
-	log.Printf("INFO: %v: %v\n", prefix, strings.Join(info, ""))
+	return strings.Join(info, "")
+}
+
+func FatalError(prefix string, err error) {
+	if err != nil {
+		defaultLogger().Error(err.Error(), "at", prefix, "fatal", true)
+		StopFileLogging()
+		os.Exit(ExitError)
+	}
+}
+
+// logArgs formats args only if some handler takes level, DebugInfo is
+// called on every request.
+func logArgs(level slog.Level, prefix string, args []any) {
+	l := defaultLogger()
+	if !l.Enabled(context.Background(), level) {
+		return
+	}
+	l.Log(context.Background(), level, joinArgs(args), "at", prefix)
+}
+
+func DebugInfo(prefix string, args ...any) {
+	logArgs(slog.LevelDebug, prefix, args)
+}
+
+func DebugWarn(prefix string, args ...any) {
+	logArgs(slog.LevelWarn, prefix, args)
+}
+
+func PrintError(prefix string, err error) {
+	if err != nil {
+		defaultLogger().Error(err.Error(), "at", prefix)
+	}
+}
+
+func PrintlnInfo(prefix string, args ...any) {
+	logArgs(slog.LevelInfo, prefix, args)
 }
 
 // -----color----
@@ -0,0 +1,586 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	badger "github.com/dgraph-io/badger/v4"
+)
+
+// Cold values can be moved to an S3-compatible store, see s3.go. The value
+// as stored (compressed, encrypted, or the file of a blob) becomes the object
+// <s3-prefix><blake3 of key>-<version>, and Badger keeps a stub:
+//
+//	[header, codec CodecS3][object size:8][object name]
+//
+// The header keeps raw length, xxhash, owner and mtime of the value, so
+// Exists and the usage counters do not need the object. Get fetches the
+// object; with --s3-rewarm the value is then written back locally. Deleting
+// a stub queues \x00zstdb/s3gc/<object name>, RunS3GC deletes the object.
+//
+// Moving a value writes it again, Badger gives it a new version. Clients keep
+// seeing the version they wrote: the moved entry has the metaMoved user meta
+// and \x00zstdb/movedver/<key> holds that version, see itemVersion. The
+// content does not change and Watch sees no event.
+//
+// A backup copies the objects of the stubs next to it, in s3/<object name>,
+// a restore uploads those the bucket does not have.
+var (
+	OffloadAfter     time.Duration
+	OffloadMinSizeKB int64
+	S3Rewarm         bool
+
+	// unix time of the last Get, in a slot per xxhash of the key: the memory
+	// stays the same however many keys are read, a key sharing the slot of
+	// a read key only stays local longer
+	lastAccess [1 << 20]atomic.Uint32
+	rewarming  sync.Map
+
+	// RLock while a backup copies objects, RunS3GC does not delete any then
+	s3CopyMu sync.RWMutex
+
+	// keeps the hourly offload from starting twice
+	offloadRunning atomic.Bool
+)
+
+// metaMoved is the Badger user meta of values swapped by offload or rewarm.
+const metaMoved byte = 1
+
+func movedVerKey(key []byte) []byte {
+	return InternalKey("movedver/" + string(key))
+}
+
+// itemVersion is the version of item as clients know it, the version of the
+// last write by a client.
+func itemVersion(txn *badger.Txn, item *badger.Item) (uint64, error) {
+	if item.UserMeta()&metaMoved == 0 {
+		return item.Version(), nil
+	}
+	vi, err := txn.Get(movedVerKey(item.Key()))
+	if err == badger.ErrKeyNotFound {
+		return item.Version(), nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	var ver uint64
+	err = vi.Value(func(v []byte) error {
+		if len(v) == 8 {
+			ver = binary.LittleEndian.Uint64(v)
+		}
+		return nil
+	})
+	if ver == 0 {
+		ver = item.Version()
+	}
+	return ver, err
+}
+
+func s3GCKey(name string) []byte {
+	return InternalKey("s3gc/" + name)
+}
+
+func s3ObjectName(key []byte, ver uint64) string {
+	return cfg().S3Prefix + string(SumBlake3(key)) + "-" + Uint64ToString(ver)
+}
+
+// parseS3Stub reads the payload of a CodecS3 value.
+func parseS3Stub(payload []byte) (size uint64, name string, ok bool) {
+	if len(payload) < 8+1 {
+		return 0, "", false
+	}
+	return binary.LittleEndian.Uint64(payload[:8]), string(payload[8:]), true
+}
+
+// storedS3 returns the object name if v is a stub.
+func storedS3(v []byte) (string, bool) {
+	h, payload, ok := parseValueHeader(v)
+	if !ok || h.Codec != CodecS3 {
+		return "", false
+	}
+	_, name, ok := parseS3Stub(payload)
+	return name, ok
+}
+
+// storedS3Stub tells if v is a stub.
+func storedS3Stub(v []byte) bool {
+	h, _, ok := parseValueHeader(v)
+	return ok && h.Codec == CodecS3
+}
+
+// loadS3 fetches the stored bytes of the object a stub refers to.
+func loadS3(ctx context.Context, payload []byte) ([]byte, error) {
+	size, name, ok := parseS3Stub(payload)
+	if !ok {
+		return nil, NewError("invalid s3 stub")
+	}
+	c, err := newS3Client()
+	if err != nil {
+		return nil, err
+	}
+	b, err := c.Get(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	// objects of values written before the header are bare zstd frames
+	h, _, ok := parseValueHeader(b)
+	if uint64(len(b)) != size || (ok && (h.Codec == CodecBlob || h.Codec == CodecS3)) {
+		return nil, NewError("invalid s3 object: " + name)
+	}
+	return b, nil
+}
+
+// fetchS3Stub returns the header and the object of a stub, isStub is false
+// for the other values.
+func fetchS3Stub(ctx context.Context, v []byte) (h valueHeader, obj []byte, isStub bool, err error) {
+	h, payload, ok := parseValueHeader(v)
+	if !ok || h.Codec != CodecS3 {
+		return h, nil, false, nil
+	}
+	obj, err = loadS3(ctx, payload)
+	return h, obj, true, err
+}
+
+// noteAccess records a Get, for the offload policy.
+func noteAccess(key []byte) {
+	if S3Enabled() {
+		lastAccess[GetXxhash(key)%uint64(len(lastAccess))].Store(uint32(time.Now().Unix()))
+	}
+}
+
+func accessedSince(key []byte, t time.Time) bool {
+	return int64(lastAccess[GetXxhash(key)%uint64(len(lastAccess))].Load()) >= t.Unix()
+}
+
+type offloadCandidate struct {
+	key []byte
+	ver uint64
+}
+
+// StartOffload moves the values under prefix written and read before
+// olderThan, and larger than --offload-min-size-kb, to S3.
+func StartOffload(prefix string, olderThan time.Duration, dryRun bool) (*Job, error) {
+	if _, err := newS3Client(); err != nil {
+		return nil, err
+	}
+
+	params := map[string]string{"prefix": prefix, "older_than": olderThan.String(), "dry_run": boolString(dryRun)}
+	return StartJob("offload", params, func(ctx context.Context, j *Job) error {
+		c, err := newS3Client()
+		if err != nil {
+			return err
+		}
+		before := time.Now().Add(-olderThan)
+
+		cursor := []byte(prefix)
+		p := []byte(prefix)
+		for {
+			var batch []offloadCandidate
+			var next []byte
+			err := bgrdb.View(func(txn *badger.Txn) error {
+				it := txn.NewIterator(badger.DefaultIteratorOptions)
+				defer it.Close()
+				for it.Seek(cursor); it.ValidForPrefix(p); it.Next() {
+					item := it.Item()
+					next = append(item.KeyCopy(nil), 0)
+					if IsInternalKey(item.Key()) || accessedSince(item.Key(), before) {
+						continue
+					}
+					if ctx.Err() != nil {
+						return ctx.Err()
+					}
+					err := item.Value(func(v []byte) error {
+						h, stored, raw := valueSizes(v)
+						if h.Codec == CodecS3 || h.Mtime >= before.Unix() || int64(stored) < cfg().OffloadMinSizeKB<<10 {
+							return nil
+						}
+						batch = append(batch, offloadCandidate{key: item.KeyCopy(nil), ver: item.Version()})
+						if dryRun {
+							j.Add(1, stored, raw)
+						}
+						return nil
+					})
+					if err != nil {
+						return err
+					}
+					if len(batch) >= 100 {
+						break
+					}
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			if !dryRun {
+				for _, k := range batch {
+					if err := offloadValue(ctx, c, k, j); err != nil {
+						return err
+					}
+				}
+			}
+			if len(batch) < 100 {
+				return nil
+			}
+			cursor = next
+		}
+	}), nil
+}
+
+// offloadValue uploads one value and swaps it for a stub, unless it changed
+// in between.
+func offloadValue(ctx context.Context, c *s3Client, k offloadCandidate, j *Job) error {
+	var v []byte
+	err := bgrdb.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(k.key)
+		if err != nil || item.Version() != k.ver {
+			return err
+		}
+		v, err = item.ValueCopy(nil)
+		return err
+	})
+	if err == badger.ErrKeyNotFound || v == nil {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	h, payload, _ := parseValueHeader(v)
+	obj := v
+	if h.Codec == CodecBlob {
+		if obj, err = loadBlob(payload); err != nil {
+			return err
+		}
+	}
+
+	name := s3ObjectName(k.key, k.ver)
+	if err = c.Put(ctx, name, obj); err != nil {
+		return err
+	}
+
+	stub := h
+	stub.Codec, stub.Flags, stub.DictID, stub.KeyID = CodecS3, flagMeta, 0, 0
+	if stub.RawLen == 0 {
+		// written before the header had the raw length
+		raw, err := UnZstdBytes(v)
+		if err != nil {
+			return err
+		}
+		stub.RawLen, stub.Sum64 = uint64(len(raw)), GetXxhash(raw)
+	}
+	sv := stub.AppendTo(nil)
+	sv = binary.LittleEndian.AppendUint64(sv, uint64(len(obj)))
+	sv = append(sv, name...)
+
+	swapped := false
+	err = badgerUpdate(func(txn *badger.Txn) error {
+		swapped = false
+		item, err := txn.Get(k.key)
+		if err == badger.ErrKeyNotFound || (err == nil && item.Version() != k.ver) {
+			return txn.Set(s3GCKey(name), nil)
+		}
+		if err != nil {
+			return err
+		}
+		if err = swapStored(txn, k.key, item, sv); err != nil {
+			return err
+		}
+		swapped = true
+		return nil
+	})
+	CacheInvalidate(k.key)
+	if err != nil {
+		return err
+	}
+	if swapped {
+		_, stored, raw := valueSizes(v)
+		j.Add(1, stored, raw)
+	}
+	return nil
+}
+
+// swapStored replaces the stored form of key by nv, the value stays the
+// same, so there is no change log entry and the version clients see is kept.
+func swapStored(txn *badger.Txn, key []byte, item *badger.Item, nv []byte) error {
+	var oldStored uint64
+	var oldBlob, oldS3 string
+	err := item.Value(func(v []byte) error {
+		_, oldStored, _ = valueSizes(v)
+		oldBlob, _ = storedBlob(v)
+		oldS3, _ = storedS3(v)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	h, newStored, _ := valueSizes(nv)
+	if err = usageDelta(txn, key, h.Owner, 0, int64(newStored)-int64(oldStored), 0); err != nil {
+		return err
+	}
+	if oldBlob != "" {
+		if err = blobRef(txn, oldBlob, -1); err != nil {
+			return err
+		}
+	}
+	if oldS3 != "" {
+		if err = txn.Set(s3GCKey(oldS3), nil); err != nil {
+			return err
+		}
+	}
+	if hash, ok := storedBlob(nv); ok {
+		if err = blobRef(txn, hash, 1); err != nil {
+			return err
+		}
+	}
+	return setMoved(txn, key, item, nv)
+}
+
+// setMoved writes nv over item, which keeps its version for clients.
+func setMoved(txn *badger.Txn, key []byte, item *badger.Item, nv []byte) error {
+	ver, err := itemVersion(txn, item)
+	if err != nil {
+		return err
+	}
+	if err = txn.Set(movedVerKey(key), binary.LittleEndian.AppendUint64(nil, ver)); err != nil {
+		return err
+	}
+	return txn.SetEntry(badger.NewEntry(key, nv).WithMeta(metaMoved))
+}
+
+// rewarm writes a value fetched from S3 back locally, in the background,
+// unless the disk watermarks block the write. stub is the header of its
+// stub.
+func rewarm(key []byte, ver uint64, stub valueHeader, obj, raw []byte) {
+	// the value stays in S3 while the disk is short of space
+	if diskWriteBlocked(int64(len(obj))) != "" {
+		return
+	}
+	if _, busy := rewarming.LoadOrStore(string(key), true); busy {
+		return
+	}
+	GoBackground("rewarm", func(ctx context.Context) {
+		defer rewarming.Delete(string(key))
+
+		nv := obj
+		if isBlobSize(len(raw)) {
+			h := stub
+			hash := blobHash(raw)
+			blobMu.RLock()
+			defer blobMu.RUnlock()
+			if _, err := storeBlobFile(hash, func() []byte { return obj }); err != nil {
+				PrintError("rewarm", err)
+				return
+			}
+			h.Codec = CodecBlob
+			nv = h.AppendTo(nil)
+			nv = binary.LittleEndian.AppendUint64(nv, uint64(len(obj)))
+			nv = append(nv, hash...)
+		}
+
+		err := badgerUpdate(func(txn *badger.Txn) error {
+			item, err := txn.Get(key)
+			if err == badger.ErrKeyNotFound || (err == nil && item.Version() != ver) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			return swapStored(txn, key, item, nv)
+		})
+		CacheInvalidate(key)
+		if err != nil {
+			DebugWarn("rewarm", string(key), ": ", err)
+		}
+	})
+}
+
+// RunS3GC deletes the objects of deleted stubs.
+func RunS3GC(ctx context.Context) {
+	ticker := time.NewTicker(10 * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if S3Enabled() {
+			PrintError("RunS3GC", deleteQueuedObjects(ctx))
+		}
+	}
+}
+
+func deleteQueuedObjects(ctx context.Context) error {
+	if !s3CopyMu.TryLock() {
+		// a backup is copying the objects, next round
+		return nil
+	}
+	defer s3CopyMu.Unlock()
+
+	var names []string
+	prefix := InternalKey("s3gc/")
+	err := bgrdb.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		opts.Prefix = prefix
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		for it.Rewind(); it.Valid() && len(names) < 100; it.Next() {
+			names = append(names, string(bytes.TrimPrefix(it.Item().Key(), prefix)))
+		}
+		return nil
+	})
+	if err != nil || len(names) == 0 {
+		return err
+	}
+
+	c, err := newS3Client()
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		if err = c.Delete(ctx, name); err != nil {
+			// kept for the next round
+			return err
+		}
+		err = bgrdb.Update(func(txn *badger.Txn) error {
+			return txn.Delete(s3GCKey(name))
+		})
+		if err != nil {
+			return err
+		}
+		DebugInfo("RunS3GC", "deleted ", name)
+	}
+	return nil
+}
+
+// copyS3Objects downloads to dst/<object name> the objects of the stubs,
+// and of the deleted stubs RunS3GC has not deleted yet, unless dst has them.
+// The caller holds s3CopyMu.RLock from before its snapshot of the db.
+func copyS3Objects(ctx context.Context, dst string) (n int, err error) {
+	var names []string
+	gcPrefix := s3GCKey("")
+	err = bgrdb.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			item := it.Item()
+			if bytes.HasPrefix(item.Key(), gcPrefix) {
+				names = append(names, string(item.Key()[len(gcPrefix):]))
+				continue
+			}
+			if item.UserMeta()&metaMoved == 0 || IsInternalKey(item.Key()) {
+				continue
+			}
+			err := item.Value(func(v []byte) error {
+				if name, ok := storedS3(v); ok {
+					names = append(names, name)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil || len(names) == 0 {
+		return 0, err
+	}
+
+	c, err := newS3Client()
+	if err != nil {
+		return 0, err
+	}
+	for _, name := range names {
+		target := filepath.Join(dst, filepath.FromSlash(name))
+		if _, err := os.Stat(target); err == nil {
+			continue
+		}
+		b, err := c.Get(ctx, name)
+		if err == errS3NotFound {
+			// queued by an offload which lost to a write, never referred to
+			continue
+		}
+		if err != nil {
+			return n, err
+		}
+		if err = writeFileSync(target, b); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+// restoreS3Objects uploads the objects copied by a backup to src which the
+// bucket does not have.
+func restoreS3Objects(ctx context.Context, src string) (n int, err error) {
+	var c *s3Client
+	err = filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() || strings.HasPrefix(d.Name(), ".tmp-") {
+			return nil
+		}
+		if c == nil {
+			if c, err = newS3Client(); err != nil {
+				return err
+			}
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+		if ok, err := c.Exists(ctx, name); ok || err != nil {
+			return err
+		}
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if err = c.Put(ctx, name, b); err != nil {
+			return err
+		}
+		n++
+		return nil
+	})
+	return n, err
+}
+
+// AutoOffload is run by cron when --offload-after is set.
+func AutoOffload() {
+	if cfg().OffloadAfter <= 0 || !S3Enabled() || !offloadRunning.CompareAndSwap(false, true) {
+		return
+	}
+	j, err := StartOffload("", cfg().OffloadAfter, false)
+	if err != nil {
+		offloadRunning.Store(false)
+		PrintError("AutoOffload", err)
+		return
+	}
+	GoBackground("AutoOffload", func(ctx context.Context) {
+		defer offloadRunning.Store(false)
+		select {
+		case <-j.done:
+		case <-ctx.Done():
+		}
+	})
+}
@@ -0,0 +1,122 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	badger "github.com/dgraph-io/badger/v4"
+	pb "zstdb/pbs"
+)
+
+func TestOffloadKeepsVersion(t *testing.T) {
+	var f *fakeS3
+	openTestDB(t, func(s *Settings) {
+		f = newFakeS3(t, s)
+		s.OffloadMinSizeKB = 0
+	})
+	IsAllowUserKey = true
+	t.Cleanup(func() { IsAllowUserKey = false })
+	ctx := context.Background()
+
+	key := []byte("k")
+	raw := bytes.Repeat([]byte("cold value "), 1000)
+	if _, err := badgerPut(key, raw, GetXxhash(raw), SaveOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	ver, _, _, _, _ := badgerExists(key, 1)
+	c, err := newS3Client()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = offloadValue(ctx, c, offloadCandidate{key: key, ver: ver}, &Job{}); err != nil {
+		t.Fatal(err)
+	}
+	if f.len() != 1 {
+		t.Fatalf("%d objects", f.len())
+	}
+
+	check := func(step string, codec int) {
+		t.Helper()
+		v, _, _, gotCodec, _ := badgerExists(key, 1)
+		if v != ver || gotCodec != codec {
+			t.Errorf("%s: exists ver %d codec %d, want %d %d", step, v, gotCodec, ver, codec)
+		}
+		val, v, _ := badgerGet(ctx, key)
+		if v != ver || !bytes.Equal(val, raw) {
+			t.Errorf("%s: get ver %d, %d bytes", step, v, len(val))
+		}
+		part, v, _, _, err := badgerGetRange(ctx, key, 11, 11)
+		if err != nil || v != ver || string(part) != "cold value " {
+			t.Errorf("%s: range ver %d %q: %v", step, v, part, err)
+		}
+		if keys := badgerList("k", 1); len(keys) != 1 || keys[0] != "k:"+Uint64ToString(ver) {
+			t.Errorf("%s: list %v", step, keys)
+		}
+		results, _, _, err := badgerTxn([]*pb.TxnOp{{Op: "check", Key: key, Ver64: ver}}, SaveOptions{})
+		if err != nil || results[0].Ver64 != ver {
+			t.Errorf("%s: txn check %v: %v", step, results, err)
+		}
+	}
+	check("offloaded", int(CodecS3))
+
+	// a backup copies the object, a restore uploads it again
+	dir := t.TempDir()
+	if n, err := copyS3Objects(ctx, dir); n != 1 || err != nil {
+		t.Fatalf("copied %d: %v", n, err)
+	}
+	f.mu.Lock()
+	clear(f.objects)
+	f.mu.Unlock()
+	if n, err := restoreS3Objects(ctx, dir); n != 1 || err != nil {
+		t.Fatalf("restored %d: %v", n, err)
+	}
+	if n, _ := restoreS3Objects(ctx, dir); n != 0 {
+		t.Errorf("restored %d objects the bucket has", n)
+	}
+
+	rewarmed := *cfg()
+	rewarmed.S3Rewarm = true
+	settings.Store(&rewarmed)
+	CacheInvalidate(key)
+	badgerGet(ctx, key)
+	for i := 0; i < 200; i++ {
+		if _, busy := rewarming.Load(string(key)); !busy {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	check("rewarmed", int(CodecZstd))
+	if err = deleteQueuedObjects(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if f.len() != 0 {
+		t.Errorf("%d objects left after rewarm", f.len())
+	}
+
+	if _, _, err = badgerDelete(key); err != nil {
+		t.Fatal(err)
+	}
+	err = bgrdb.View(func(txn *badger.Txn) error {
+		_, err := txn.Get(movedVerKey(key))
+		return err
+	})
+	if err != badger.ErrKeyNotFound {
+		t.Errorf("moved version left: %v", err)
+	}
+}
+
+func TestAccessSlots(t *testing.T) {
+	openTestDB(t, func(s *Settings) {
+		s.S3Endpoint, s.S3Bucket = "http://127.0.0.1:1", "bucket"
+	})
+	now := time.Now()
+	if accessedSince([]byte("never read"), now) {
+		t.Error("a key never read is recent")
+	}
+	noteAccess([]byte("read"))
+	if !accessedSince([]byte("read"), now.Add(-time.Second)) {
+		t.Error("a key read is not recent")
+	}
+}
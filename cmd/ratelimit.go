@@ -0,0 +1,243 @@
+package cmd
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+var (
+	AuthTokens     []string
+	RateLimitRPS   float64
+	RateLimitBurst int
+	RateLimitBPS   int64
+
+	limiterMu     sync.Mutex
+	limiters      map[string]*clientLimiter = make(map[string]*clientLimiter)
+	limiterPruned time.Time
+)
+
+// limiterIdle: clients idle that long are forgotten, unless a rate is set
+// below one per limiterIdle their buckets have refilled by then.
+const limiterIdle = 10 * time.Minute
+
+type ctxKeyClient struct{}
+
+// parseAuthTokens parses --auth-token name=token. With no tokens every
+// client is known by its peer address.
+func parseAuthTokens(list []string) (map[string]string, error) {
+	m := make(map[string]string)
+	for _, t := range list {
+		name, token, ok := strings.Cut(t, "=")
+		if !ok || name == "" || token == "" {
+			return nil, NewError("--auth-token must be name=token: " + t)
+		}
+		m[token] = name
+	}
+	return m, nil
+}
+
+// ClientID returns the identity set by the interceptors.
+func ClientID(ctx context.Context) string {
+	id, _ := ctx.Value(ctxKeyClient{}).(string)
+	return id
+}
+
+// identify returns the token name, or the peer address when tokens are
+// not configured.
+func identify(ctx context.Context) (string, error) {
+	if tokens := cfg().authTokens; len(tokens) > 0 {
+		token := incomingMeta(ctx, "x-zstdb-token")
+		name, ok := tokens[token]
+		if !ok {
+			return "", status.Error(codes.Unauthenticated, "missing or invalid x-zstdb-token")
+		}
+		return name, nil
+	}
+	return PeerAddr(ctx), nil
+}
+
+// PeerAddr is the client IP without port.
+func PeerAddr(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+	return host
+}
+
+// tokenBucket may go below zero, bytes sent in a reply are charged
+// afterwards and delay the next requests of the client.
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func (b *tokenBucket) take(n float64, now time.Time) bool {
+	if b.rate <= 0 {
+		return true
+	}
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+	if b.tokens < 0 || (n > 0 && b.tokens < n && b.tokens < b.burst) {
+		return false
+	}
+	b.tokens -= n
+	return true
+}
+
+type clientLimiter struct {
+	requests tokenBucket
+	bytes    tokenBucket
+	lastSeen time.Time
+}
+
+func getLimiter(id string, now time.Time) *clientLimiter {
+	if now.Sub(limiterPruned) > time.Minute {
+		pruneLimiters(now, limiterIdle)
+		limiterPruned = now
+	}
+	l, ok := limiters[id]
+	if !ok {
+		s := cfg()
+		burst := float64(s.RateLimitBurst)
+		if burst < 1 {
+			burst = s.RateLimitRPS
+		}
+		if burst < 1 {
+			burst = 1
+		}
+		bps := float64(s.RateLimitBPS)
+		l = &clientLimiter{
+			requests: tokenBucket{rate: s.RateLimitRPS, burst: burst, tokens: burst, last: now},
+			bytes:    tokenBucket{rate: bps, burst: bps, tokens: bps, last: now},
+		}
+		limiters[id] = l
+	}
+	l.lastSeen = now
+	return l
+}
+
+// allow charges one request and size bytes to the client.
+func allow(id string, size int) error {
+	if s := cfg(); s.RateLimitRPS <= 0 && s.RateLimitBPS <= 0 {
+		return nil
+	}
+	now := time.Now()
+	limiterMu.Lock()
+	defer limiterMu.Unlock()
+	l := getLimiter(id, now)
+	if !l.requests.take(1, now) {
+		return status.Error(codes.ResourceExhausted, "rate limit exceeded: requests per second")
+	}
+	if !l.bytes.take(float64(size), now) {
+		return status.Error(codes.ResourceExhausted, "rate limit exceeded: bytes per second")
+	}
+	return nil
+}
+
+// charge takes reply bytes from the client's bucket after the fact.
+func charge(id string, size int) {
+	if cfg().RateLimitBPS <= 0 || size <= 0 {
+		return
+	}
+	now := time.Now()
+	limiterMu.Lock()
+	defer limiterMu.Unlock()
+	l := getLimiter(id, now)
+	l.bytes.take(0, now)
+	l.bytes.tokens -= float64(size)
+}
+
+// ResetLimiters drops the buckets, after a reload or when clients are idle.
+func ResetLimiters(idle time.Duration) {
+	limiterMu.Lock()
+	defer limiterMu.Unlock()
+	pruneLimiters(time.Now(), idle)
+}
+
+// pruneLimiters drops the clients not seen for idle, all with 0.
+func pruneLimiters(now time.Time, idle time.Duration) {
+	for id, l := range limiters {
+		if idle == 0 || now.Sub(l.lastSeen) > idle {
+			delete(limiters, id)
+		}
+	}
+}
+
+// isAdminMethod: Admin has its own password and is never limited.
+func isAdminMethod(fullMethod string) bool {
+	return strings.HasSuffix(fullMethod, "/Admin")
+}
+
+func UnaryLimitInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	id, err := identify(ctx)
+	if err != nil && !isAdminMethod(info.FullMethod) {
+		return nil, err
+	}
+	ctx = context.WithValue(ctx, ctxKeyClient{}, id)
+
+	if isAdminMethod(info.FullMethod) {
+		return handler(ctx, req)
+	}
+	rpcCalls.Add(1)
+
+	size := 0
+	if m, ok := req.(proto.Message); ok {
+		size = proto.Size(m)
+	}
+	if err := allow(id, size); err != nil {
+		return nil, err
+	}
+
+	resp, err := handler(ctx, req)
+	if m, ok := resp.(proto.Message); ok && err == nil {
+		charge(id, proto.Size(m))
+	}
+	return resp, err
+}
+
+type identifiedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *identifiedStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *identifiedStream) SendMsg(m any) error {
+	if pm, ok := m.(proto.Message); ok {
+		charge(ClientID(s.ctx), proto.Size(pm))
+	}
+	return s.ServerStream.SendMsg(m)
+}
+
+func StreamLimitInterceptor(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	id, err := identify(ss.Context())
+	if err != nil {
+		return err
+	}
+	if err := allow(id, 0); err != nil {
+		return err
+	}
+	ctx := context.WithValue(ss.Context(), ctxKeyClient{}, id)
+	return handler(srv, &identifiedStream{ServerStream: ss, ctx: ctx})
+}
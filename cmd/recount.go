@@ -0,0 +1,394 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"strings"
+	"sync"
+
+	badger "github.com/dgraph-io/badger/v4"
+)
+
+// recountMu runs one recount at a time.
+var recountMu sync.Mutex
+
+// badgerCount answers from the usage counters for "" (all keys) and for
+// "<namespace>/", other prefixes are scanned. Before the first recount
+// finished every prefix is scanned.
+func badgerCount(prefix string) uint64 {
+	ns, rest, ok := strings.Cut(prefix, "/")
+	var k []byte
+	switch {
+	case prefix == "":
+		k = totalUsageKey()
+	case ok && rest == "" && usageScopes(cfg())&scopeNamespace != 0:
+		k = namespaceUsageKey(ns)
+	}
+
+	if k != nil {
+		var u Usage
+		var found bool
+		err := bgrdb.View(func(txn *badger.Txn) error {
+			_, scopes, _, err := readUsageGen(txn)
+			if err != nil || (!bytes.Equal(k, totalUsageKey()) && scopes&scopeNamespace == 0) {
+				return err
+			}
+			u, found, err = readCounter(txn, k)
+			return err
+		})
+		if err != nil && err != badger.ErrKeyNotFound {
+			PrintError("badgerCount", err)
+		}
+		if found && err == nil {
+			return u.Keys
+		}
+	}
+
+	counter := uint64(0)
+	bgrdb.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchSize = 0
+		opts.PrefetchValues = false
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		prefixByte := []byte(prefix)
+		for it.Seek(prefixByte); it.ValidForPrefix(prefixByte); it.Next() {
+			if IsInternalKey(it.Item().Key()) {
+				continue
+			}
+			counter++
+		}
+		return nil
+	})
+	return counter
+}
+
+// TotalUsage is the usage of all keys, ok is false before the first recount.
+func TotalUsage() (u Usage, ok bool) {
+	err := bgrdb.View(func(txn *badger.Txn) error {
+		var err error
+		u, ok, err = readCounter(txn, totalUsageKey())
+		return err
+	})
+	if err != nil {
+		PrintError("TotalUsage", err)
+	}
+	return u, ok
+}
+
+// StartRecountIfMissing starts a recount when the db has no counters yet,
+// e.g. the first start after an upgrade, or they were built for other
+// quotas than configured now.
+func StartRecountIfMissing() error {
+	var scopes byte
+	var ok bool
+	err := bgrdb.View(func(txn *badger.Txn) error {
+		var err error
+		if _, scopes, _, err = readUsageGen(txn); err != nil {
+			return err
+		}
+		_, ok, err = readCounter(txn, totalUsageKey())
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if ok && scopes == usageScopes(cfg()) {
+		return nil
+	}
+	PrintlnInfo("usage counters are missing, recounting")
+	StartRecount()
+	return nil
+}
+
+// StartRecount rebuilds every usage counter and blob reference from the
+// keys. It bumps usagegen first, so the writes after go to the shards of
+// the new generation. The keys are scanned in a snapshot, what the scan
+// counted that those shards hold as well becomes the base of the new
+// generation, the shards of the generations before are deleted. A
+// reference becomes what the scan counted plus what the writes after the
+// snapshot changed. The bases and references are written in batches, the
+// base of the total last: until then readers ignore the new bases. It
+// scans again if another recount came in between, usagegen tells.
+func StartRecount() *Job {
+	return StartJob("recount", nil, func(ctx context.Context, j *Job) error {
+		// the references a recount corrects must not move meanwhile
+		recountMu.Lock()
+		defer recountMu.Unlock()
+
+		var err error
+		for i := 0; i < 8; i++ {
+			var retry bool
+			retry, err = recount(ctx, j)
+			if !retry {
+				return err
+			}
+			DebugInfo("recount", "another recount came in between, again")
+		}
+		if err == nil {
+			err = NewError("recounts kept coming in between, recount later")
+		}
+		return err
+	})
+}
+
+func recount(ctx context.Context, j *Job) (retry bool, err error) {
+	scopes := usageScopes(cfg())
+
+	// the writes in flight read the generation before and conflict
+	var gen uint64
+	err = badgerUpdate(func(txn *badger.Txn) error {
+		cur, _, _, err := readUsageGen(txn)
+		if err != nil {
+			return err
+		}
+		gen = cur + 1
+		return writeUsageGen(txn, gen, scopes)
+	})
+	if err != nil {
+		return false, err
+	}
+
+	var total Usage
+	namespaces := make(map[string]*Usage)
+	owners := make(map[uint64]*Usage)
+	blobs := make(map[string]uint64)
+	// the references in the snapshot
+	refs := make(map[string]uint64)
+	// the shards of gen in the snapshot, counted by the scan as well
+	counted := make(map[string]*usageDiff)
+
+	err = bgrdb.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = InternalKey("usage/")
+		sit := txn.NewIterator(opts)
+		for sit.Rewind(); sit.Valid(); sit.Next() {
+			counter, g, shard, ok := parseUsageShardKey(sit.Item().Key())
+			if !ok || g != gen || shard == usageBaseShard {
+				continue
+			}
+			d := counted[string(counter)]
+			if d == nil {
+				d = &usageDiff{}
+				counted[string(counter)] = d
+			}
+			if err := sit.Item().Value(func(v []byte) error { d.add(v); return nil }); err != nil {
+				sit.Close()
+				return err
+			}
+		}
+		sit.Close()
+
+		ropts := badger.DefaultIteratorOptions
+		ropts.Prefix = InternalKey("blobref/")
+		rit := txn.NewIterator(ropts)
+		for rit.Rewind(); rit.Valid(); rit.Next() {
+			hash := strings.TrimPrefix(string(rit.Item().Key()), string(ropts.Prefix))
+			if err := rit.Item().Value(func(v []byte) error { refs[hash] = refCount(v); return nil }); err != nil {
+				rit.Close()
+				return err
+			}
+		}
+		rit.Close()
+
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			item := it.Item()
+			if IsInternalKey(item.Key()) {
+				continue
+			}
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			err := item.Value(func(v []byte) error {
+				h, stored, raw := valueSizes(v)
+				add := func(u *Usage) {
+					u.Keys++
+					u.Bytes += stored
+					u.RawBytes += raw
+				}
+				add(&total)
+				if scopes&scopeNamespace != 0 {
+					ns := KeyNamespace(item.Key())
+					if namespaces[ns] == nil {
+						namespaces[ns] = &Usage{}
+					}
+					add(namespaces[ns])
+				}
+				if hash, ok := storedBlob(v); ok {
+					blobs[hash]++
+				}
+				if h.Owner != 0 && scopes&scopeClient != 0 {
+					if owners[h.Owner] == nil {
+						owners[h.Owner] = &Usage{}
+					}
+					add(owners[h.Owner])
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+
+	bases := map[string]Usage{string(totalUsageKey()): total}
+	for ns, u := range namespaces {
+		bases[string(namespaceUsageKey(ns))] = *u
+	}
+	for owner, u := range owners {
+		bases[string(clientUsageKey(owner))] = *u
+	}
+	for counter := range counted {
+		if _, ok := bases[counter]; !ok {
+			bases[counter] = Usage{}
+		}
+	}
+
+	if err = writeBlobRefs(ctx, blobs, refs); err != nil {
+		return false, err
+	}
+
+	// the bases of gen but the total's, readers ignore them until it is
+	// written
+	wb := bgrdb.NewWriteBatch()
+	defer wb.Cancel()
+	for counter, u := range bases {
+		if counter == string(totalUsageKey()) {
+			continue
+		}
+		if err = wb.Set(usageShardKey([]byte(counter), gen, usageBaseShard), usageBase(u, counted[counter])); err != nil {
+			return false, err
+		}
+	}
+	if err = wb.Flush(); err != nil {
+		return false, err
+	}
+
+	err = bgrdb.Update(func(txn *badger.Txn) error {
+		// another recount since the bump; reading usagegen also makes a
+		// later one a conflict
+		if cur, _, _, err := readUsageGen(txn); err != nil || cur != gen {
+			if err == nil {
+				err = badger.ErrConflict
+			}
+			return err
+		}
+		k := string(totalUsageKey())
+		return txn.Set(usageShardKey([]byte(k), gen, usageBaseShard), usageBase(bases[k], counted[k]))
+	})
+	if err == badger.ErrConflict {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	j.Add(total.Keys, total.Bytes, total.RawBytes)
+	return false, dropUsageGens(gen)
+}
+
+// usageBase is what the scan counted, u, less what the shards c of the
+// same generation hold as well.
+func usageBase(u Usage, c *usageDiff) []byte {
+	d := usageDiff{Keys: int64(u.Keys), Bytes: int64(u.Bytes), RawBytes: int64(u.RawBytes)}
+	if c != nil {
+		d.Keys, d.Bytes, d.RawBytes = d.Keys-c.Keys, d.Bytes-c.Bytes, d.RawBytes-c.RawBytes
+	}
+	return d.encode()
+}
+
+func refCount(v []byte) uint64 {
+	if len(v) < 8 {
+		return 0
+	}
+	return binary.LittleEndian.Uint64(v)
+}
+
+// writeBlobRefs sets each reference the scan counted or the snapshot had
+// to the count of the scan plus what the writes after the snapshot changed,
+// 1000 per txn. A write in between makes the txn conflict and read again.
+// A release of a reference already 0 is lost, that count stays too high
+// and the file is kept. Files nobody points to any more are left to
+// SweepBlobs.
+func writeBlobRefs(ctx context.Context, blobs, refs map[string]uint64) error {
+	hashes := make([]string, 0, len(blobs)+len(refs))
+	for hash := range blobs {
+		hashes = append(hashes, hash)
+	}
+	for hash := range refs {
+		if _, ok := blobs[hash]; !ok {
+			hashes = append(hashes, hash)
+		}
+	}
+	for len(hashes) > 0 {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		batch := hashes[:min(len(hashes), 1000)]
+		hashes = hashes[len(batch):]
+		err := badgerUpdate(func(txn *badger.Txn) error {
+			for _, hash := range batch {
+				var cur uint64
+				item, err := txn.Get(blobRefKey(hash))
+				if err == nil {
+					err = item.Value(func(v []byte) error { cur = refCount(v); return nil })
+				}
+				if err != nil && err != badger.ErrKeyNotFound {
+					return err
+				}
+				n := addDelta(blobs[hash]+cur, -int64(refs[hash]))
+				if n == 0 {
+					err = txn.Delete(blobRefKey(hash))
+				} else {
+					err = txn.Set(blobRefKey(hash), binary.LittleEndian.AppendUint64(nil, n))
+				}
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dropUsageGens deletes the shards of the generations before gen, nobody
+// reads them once the recount of gen stored its base.
+func dropUsageGens(gen uint64) error {
+	var keys [][]byte
+	err := bgrdb.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		opts.Prefix = InternalKey("usage/")
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			if _, g, _, ok := parseUsageShardKey(it.Item().Key()); !ok || g < gen {
+				keys = append(keys, it.Item().KeyCopy(nil))
+			}
+		}
+		return nil
+	})
+	for len(keys) > 0 && err == nil {
+		batch := keys[:min(len(keys), 1000)]
+		keys = keys[len(batch):]
+		err = bgrdb.Update(func(txn *badger.Txn) error {
+			for _, k := range batch {
+				if err := txn.Delete(k); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+	return err
+}
@@ -4,10 +4,8 @@ Copyright © 2025 NAME HERE <EMAIL ADDRESS>
 package cmd
 
 import (
+	"context"
 	"os"
-	"os/signal"
-	"sync"
-	"syscall"
 	"time"
 
 	"github.com/spf13/cobra"
@@ -47,42 +45,39 @@ var rootCmd = &cobra.Command{
 		BeforeStart()
 	},
 	Run: func(cmd *cobra.Command, args []string) {
+		StartFileLogging()
 		SaveCurrentPID()
 		SaveCurrentAddr()
 		BeforeGrpcStart()
 		//
-		wg := sync.WaitGroup{}
-		wg.Add(6)
-
-		go func() {
-			BadgerRunValueLogGC()
-		}()
-
-		go func() {
-			StartCron()
-		}()
-
-		go func() {
-			StartFileLogging()
-		}()
-
-		go func() {
-			onExit()
-		}()
-
-		go func() {
-			StartGrpcServer()
-		}()
-
-		go func() {
+		onExit()
+		onReload()
+
+		GoBackground("RunValueLogGC", BadgerRunValueLogGC)
+		GoBackground("StartCron", StartCron)
+		GoBackground("RunWebhooks", RunWebhooks)
+		GoBackground("RunBlobGC", RunBlobGC)
+		GoBackground("RunS3GC", RunS3GC)
+		GoBackground("WatchDiskFreeSpace", func(ctx context.Context) {
+			WatchDiskFreeSpace()
 			ticker := time.NewTicker(15 * time.Second)
 			defer ticker.Stop()
-			for range ticker.C {
-				WatchDiskFreeSpace()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+					WatchDiskFreeSpace()
+				}
 			}
+		})
+
+		NewGrpcServer()
+		go func() {
+			StartGrpcServer()
 		}()
 
-		wg.Wait()
+		os.Exit(WaitShutdown())
 	},
 	PersistentPostRun: func(cmd *cobra.Command, args []string) {
 
@@ -100,34 +95,114 @@ func Execute() {
 }
 
 func init() {
+	rootCmd.PersistentFlags().StringVar(&ConfigFile, "config", "", "YAML config file, keys are the flag names, flags override it; reload by SIGHUP or rpc::admin reload")
 	rootCmd.PersistentFlags().BoolVar(&IsDebug, "debug", false, "if print debug info")
 	rootCmd.PersistentFlags().BoolVar(&IsAllowOverWrite, "allow-overwrite", false, "if overwrite when data exists")
 	rootCmd.PersistentFlags().BoolVar(&IsAllowUserKey, "allow-user-key", false, "if allow user-defined key")
 	rootCmd.PersistentFlags().BoolVar(&IsDisableDelete, "disable-delete", false, "if disable user to delete data")
 	rootCmd.PersistentFlags().BoolVar(&IsDisableSet, "disable-set", false, "if disable user to write data")
-	rootCmd.PersistentFlags().Int64Var(&MaxUploadSizeMB, "max-upload-size-mb", 16, "Max Upload Size(16~1024MB), default: 16")
+	rootCmd.PersistentFlags().Int64Var(&MaxUploadSizeMB, "max-upload-size-mb", 16, "Max Upload Size(16~1024MB, 2047MB with --blob-threshold-mb or --volume-min-size-kb), default: 16")
 	rootCmd.PersistentFlags().StringVar(&AltDataDir, "alt-data-dir", "", "replace the env var zstdb_data")
 	rootCmd.PersistentFlags().StringVar(&Host, "host", "0.0.0.0", "host, default: 0.0.0.0")
 	rootCmd.PersistentFlags().StringVar(&Port, "port", "8282", "port, default: 8282")
 
 	rootCmd.PersistentFlags().Uint64Var(&MinFreeDiskSpaceMB, "min-free-disk-space-mb", 4096,
-		"disable-set=true if free space is less than this value, minimum: 4096")
+		"hard watermark: refuse all writes if free space is less than this value, minimum: 512")
+	rootCmd.PersistentFlags().Uint64Var(&DiskSoftFreeMB, "disk-soft-free-mb", 0,
+		"soft watermark: below it run the gc and refuse uploads larger than --disk-soft-max-upload-mb, 0: twice --min-free-disk-space-mb")
+	rootCmd.PersistentFlags().Int64Var(&DiskSoftMaxUploadMB, "disk-soft-max-upload-mb", 4, "largest upload below the soft watermark, 0: no limit")
+	rootCmd.PersistentFlags().StringArrayVar(&Volumes, "volume", nil,
+		"another directory for blob files only (values larger than --blob-threshold-mb or --volume-min-size-kb), usually on another disk; the LSM and the value log stay in the data dir, format: \"name=path\", can be repeated")
+	rootCmd.PersistentFlags().StringVar(&VolumePlacement, "volume-placement", "free",
+		"volume of a new value: free (the most free space) or ring (key-hash ring of the content)")
+	rootCmd.PersistentFlags().Int64Var(&VolumeMinSizeKB, "volume-min-size-kb", 0,
+		"with --volume, values larger than this are blob files too, as with a lower --blob-threshold-mb, 0: --blob-threshold-mb only")
+	rootCmd.PersistentFlags().Uint64Var(&DiskReserveMB, "disk-reserve-mb", 0,
+		"space held in data-dir/reserve and released at the hard watermark, so deletes and compaction can run")
 	rootCmd.PersistentFlags().StringVar(&AdminPassword, "admin-password", "123", "password for rpc::admin")
 	rootCmd.PersistentFlags().StringVar(&AutoBackupDir, "auto-backup-dir", "", "if set, run autobackup every hour")
 	rootCmd.PersistentFlags().StringVar(&AutoBackupEvery, "auto-backup-every", "@every 1h",
 		"scheduler, format: \"@every 15m\", \"@every 1h\", \"@every 1h30m\"")
-	rootCmd.PersistentFlags().StringVar(&LogDir, "log-dir", "", "write errors(ONLY) into log-dir if not empty")
-	rootCmd.PersistentFlags().Int64Var(&LogMaxSizeMB, "log-max-size-mb", 2, "if log is oversized, remove it first")
-}
-
-func onExit() {
-	c := make(chan os.Signal, 2)
-	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
-	go func() {
-		<-c
-		StopGrpcServer()
-		PrintlnInfo("zstdb", "Bye ...")
-		time.Sleep(time.Second * 2)
-		os.Exit(0)
-	}()
+	rootCmd.PersistentFlags().StringVar(&CompressionDefault, "compression", "zstd",
+		"value codec: none, zstd, zstd:<1~22>, auto, auto:<1~22>; auto skips compression if the ratio is poor")
+	rootCmd.PersistentFlags().StringArrayVar(&CompressionPrefixes, "compression-prefix", nil,
+		"per-namespace codec, format: \"videos/=none\", can be repeated")
+	rootCmd.PersistentFlags().Float64Var(&CompressionMinRatio, "compression-min-ratio", 0.97,
+		"auto keeps the raw value if compressed/raw is greater than this value")
+	rootCmd.PersistentFlags().StringVar(&EncryptionKeyFile, "encryption-key-file", "",
+		"encrypt new values with this master key (32 bytes, hex or base64), or set the env var zstdb_encryption_key")
+	rootCmd.PersistentFlags().StringVar(&EncryptionRotateEvery, "encryption-rotate-every", "",
+		"create a new data key on this schedule, format: \"@every 720h\"")
+	rootCmd.PersistentFlags().StringArrayVar(&AuthTokens, "auth-token", nil,
+		"if set, clients must send grpc metadata x-zstdb-token, format: \"name=token\", can be repeated")
+	rootCmd.PersistentFlags().Float64Var(&RateLimitRPS, "rate-limit-rps", 0, "requests per second per client, 0: unlimited")
+	rootCmd.PersistentFlags().IntVar(&RateLimitBurst, "rate-limit-burst", 0, "burst of --rate-limit-rps, default: same as rps")
+	rootCmd.PersistentFlags().Int64Var(&RateLimitBPS, "rate-limit-bps", 0, "request+reply bytes per second per client, 0: unlimited")
+	rootCmd.PersistentFlags().StringArrayVar(&QuotaNamespaces, "quota-namespace", nil,
+		"stored bytes/keys per namespace (key before the first \"/\"), format: \"videos=500GiB:1000000\", 0 = unlimited")
+	rootCmd.PersistentFlags().StringArrayVar(&QuotaClients, "quota-client", nil,
+		"stored bytes/keys per client (--auth-token name or peer ip), format: \"alice=10GiB:0\"")
+	rootCmd.PersistentFlags().StringVar(&AuditDir, "audit-dir", "", "write the audit log of Set, Delete and Admin into audit-dir if not empty")
+	rootCmd.PersistentFlags().Int64Var(&AuditMaxSizeMB, "audit-max-size-mb", 64, "rotate the audit log when it is larger than this")
+	rootCmd.PersistentFlags().IntVar(&AuditKeep, "audit-keep", 30, "number of rotated audit logs to keep, 0: keep all")
+	rootCmd.PersistentFlags().DurationVar(&WatchRetention, "watch-retention", 0,
+		"keep Set/Delete events this long so rpc Watch can resume, 0: disable Watch and the change log")
+	rootCmd.PersistentFlags().IntVar(&WatchBuffer, "watch-buffer", 4096, "events a Watch client may fall behind before it is disconnected")
+	rootCmd.PersistentFlags().StringArrayVar(&Webhooks, "webhook", nil,
+		"POST set/delete/backup events to url, format: \"url[;prefix=videos/,images/][;events=set,delete,backup][;secret=s]\", can be repeated")
+	rootCmd.PersistentFlags().StringVar(&WebhookSecret, "webhook-secret", "", "sign webhook bodies with HMAC-SHA256, header X-Zstdb-Signature")
+	rootCmd.PersistentFlags().IntVar(&WebhookMaxAttempts, "webhook-max-attempts", 10, "move a delivery to the dead-letter queue after this many failures")
+	rootCmd.PersistentFlags().DurationVar(&WebhookTimeout, "webhook-timeout", 10*time.Second, "timeout of one webhook delivery")
+	rootCmd.PersistentFlags().Int64Var(&SeekableFrameKB, "seekable-frame-kb", 1024,
+		"compress values larger than this as independent zstd frames, so Get can read a range without decoding all, 0: never")
+	rootCmd.PersistentFlags().Int64Var(&BlobThresholdMB, "blob-threshold-mb", 0,
+		"save values larger than this as files under data-dir/blobs instead of the value log, 0: never")
+	rootCmd.PersistentFlags().StringVar(&S3Endpoint, "s3-endpoint", "", "S3-compatible store for cold values, e.g. https://s3.us-east-1.amazonaws.com or http://minio:9000")
+	rootCmd.PersistentFlags().StringVar(&S3Bucket, "s3-bucket", "", "bucket of --s3-endpoint")
+	rootCmd.PersistentFlags().StringVar(&S3Region, "s3-region", "us-east-1", "region used to sign s3 requests")
+	rootCmd.PersistentFlags().StringVar(&S3AccessKey, "s3-access-key", "", "access key id of --s3-endpoint")
+	rootCmd.PersistentFlags().StringVar(&S3SecretKey, "s3-secret-key", "", "secret access key of --s3-endpoint, or set the env var zstdb_s3_secret_key")
+	rootCmd.PersistentFlags().StringVar(&S3Prefix, "s3-prefix", "zstdb/", "prefix of the object names")
+	rootCmd.PersistentFlags().DurationVar(&S3Timeout, "s3-timeout", 5*time.Minute, "timeout of one s3 request")
+	rootCmd.PersistentFlags().DurationVar(&OffloadAfter, "offload-after", 0,
+		"every hour move values not written or read for this long to s3, 0: only by Admin offload")
+	rootCmd.PersistentFlags().Int64Var(&OffloadMinSizeKB, "offload-min-size-kb", 1024, "values smaller than this stay local")
+	rootCmd.PersistentFlags().BoolVar(&S3Rewarm, "s3-rewarm", false, "write a value read from s3 back locally")
+	rootCmd.PersistentFlags().StringVar(&ScrubEvery, "scrub-every", "", "check every stored value, e.g. \"@every 168h\", empty: only by Admin scrub")
+	rootCmd.PersistentFlags().Int64Var(&ScrubRateMB, "scrub-rate-mb", 64, "MB per second a scrub reads at most, 0: no limit")
+	rootCmd.PersistentFlags().StringVar(&ScrubAction, "scrub-action", "report",
+		"on corrupt values: report, repair (from the backups in --auto-backup-dir), quarantine (repair, else move away)")
+	rootCmd.PersistentFlags().StringVar(&Durability, "durability", "async",
+		"async: reply once committed, sync: fsync before the reply, group: sync with one fsync for the writers within --group-commit-window")
+	rootCmd.PersistentFlags().DurationVar(&GroupCommitWindow, "group-commit-window", 2*time.Millisecond, "how long the first writer waits for others to share its fsync")
+	rootCmd.PersistentFlags().DurationVar(&GCInterval, "gc-interval", 5*time.Minute, "run the value log gc this often, 0: only by Admin gc or on low disk space")
+	rootCmd.PersistentFlags().Float64Var(&GCDiscardRatio, "gc-discard-ratio", 0.5, "rewrite value log files with more stale data than this share")
+	rootCmd.PersistentFlags().Float64Var(&GCPressureDiscardRatio, "gc-pressure-discard-ratio", 0.25,
+		"discard ratio when the free space is below twice --min-free-disk-space-mb")
+	rootCmd.PersistentFlags().StringVar(&GCWindows, "gc-windows", "", "local times the scheduled gc may run, e.g. \"01:00-06:00,22:00-23:30\", empty: any time")
+	rootCmd.PersistentFlags().Float64Var(&GCBusyRPS, "gc-busy-rps", 200, "postpone or stop the scheduled gc above this many requests per second, 0: never")
+	rootCmd.PersistentFlags().StringVar(&BadgerPreset, "badger-preset", "", "durable, throughput or low-memory, fills the --badger-* settings not given")
+	rootCmd.PersistentFlags().Int64Var(&BadgerBaseTableSizeMB, "badger-base-table-size-mb", 256, "size of the LSM tables")
+	rootCmd.PersistentFlags().Int64Var(&BadgerValueThreshold, "badger-value-threshold", 32, "stored values larger than this go to the value log, the others into the LSM")
+	rootCmd.PersistentFlags().Int64Var(&BadgerValueLogFileSizeMB, "badger-value-log-file-size-mb", 1984, "size of the value log files, 1 to 2047")
+	rootCmd.PersistentFlags().BoolVar(&BadgerSyncWrites, "badger-sync-writes", false, "fsync every commit")
+	rootCmd.PersistentFlags().IntVar(&BadgerNumCompactors, "badger-num-compactors", 0, "0: number of cpus, 4 to 16")
+	// values are compressed by EncodeValue, compressing the tables again gains little
+	rootCmd.PersistentFlags().StringVar(&BadgerBlockCompression, "badger-block-compression", "none", "compression of the LSM blocks: none, snappy or zstd")
+	rootCmd.PersistentFlags().Int64Var(&BadgerBlockCacheMB, "badger-block-cache-mb", 256, "cache of LSM blocks")
+	rootCmd.PersistentFlags().Int64Var(&BadgerIndexCacheMB, "badger-index-cache-mb", 0, "cache of table indexes and bloom filters, 0: keep all in memory")
+	rootCmd.PersistentFlags().Int64Var(&BadgerMemTableSizeMB, "badger-memtable-size-mb", 64, "size of a memtable")
+	rootCmd.PersistentFlags().IntVar(&BadgerNumMemtables, "badger-num-memtables", 5, "memtables kept in memory")
+	rootCmd.PersistentFlags().Int64Var(&CacheSizeMB, "cache-size-mb", 0, "keep recently read values decompressed in memory up to this size, 0: no cache")
+	rootCmd.PersistentFlags().DurationVar(&ShutdownTimeout, "shutdown-timeout", 30*time.Second,
+		"on stop, wait this long for in-flight requests, backups and GC before exiting")
+	rootCmd.PersistentFlags().StringVar(&LogFormat, "log-format", "text", "log format: text, json")
+	rootCmd.PersistentFlags().StringVar(&LogLevel, "log-level", "info", "console log level: debug, info, warn, error; --debug means debug")
+	rootCmd.PersistentFlags().StringVar(&LogFileLevel, "log-file-level", "warn", "log level of the file in --log-dir")
+	rootCmd.PersistentFlags().StringVar(&LogDir, "log-dir", "", "write logs into log-dir if not empty")
+	rootCmd.PersistentFlags().Int64Var(&LogMaxSizeMB, "log-max-size-mb", 64, "rotate the log file when it is larger than this")
+	rootCmd.PersistentFlags().DurationVar(&LogRotateEvery, "log-rotate-every", 24*time.Hour, "rotate the log file when it is older than this, 0: never")
+	rootCmd.PersistentFlags().IntVar(&LogKeep, "log-keep", 10, "number of gzipped old log files to keep, 0: keep all")
+
+	settingsFlags = rootCmd.PersistentFlags()
 }
@@ -23,7 +23,8 @@ func SetGrpcClient(rpcAddr string) {
 }
 
 func gcAdminStop() error {
-	ctx, _ := context.WithTimeout(context.Background(), time.Second*15)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*15)
+	defer cancel()
 	r, err := gClient.Admin(ctx, &pb.Item{Key: []byte("stop"), Sum64: GetXxhash([]byte(stopRpcAdminPassword))})
 	if err != nil {
 		PrintError("gcAdminStop", err)
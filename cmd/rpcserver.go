@@ -2,16 +2,20 @@ package cmd
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"net"
-	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
 	pb "zstdb/pbs"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 )
 
 var rpcServer *grpc.Server
@@ -20,7 +24,7 @@ type server struct {
 	pb.UnimplementedBadgerServer
 }
 
-func (s *server) Get(_ context.Context, in *pb.Item) (*pb.ItemReply, error) {
+func (s *server) Get(ctx context.Context, in *pb.Item) (*pb.ItemReply, error) {
 	resp := &pb.ItemReply{
 		Errcode: 0,
 		Status:  nil,
@@ -30,13 +34,13 @@ func (s *server) Get(_ context.Context, in *pb.Item) (*pb.ItemReply, error) {
 		Sum64:   0,
 	}
 	if in.Key != nil {
-		val, ver := badgerGet(in.Key)
+		val, ver, sum64 := badgerGet(ctx, in.Key)
 		if val != nil {
 			resp.Errcode = 0
 			resp.Key = in.Key
 			resp.Data = val
 			resp.Ver64 = ver
-			resp.Sum64 = GetXxhash(val)
+			resp.Sum64 = sum64
 		} else {
 			resp.Errcode = 500
 			resp.Status = []byte("cannot get from bgrdb")
@@ -46,7 +50,7 @@ func (s *server) Get(_ context.Context, in *pb.Item) (*pb.ItemReply, error) {
 	return resp, nil
 }
 
-func (s *server) Set(_ context.Context, in *pb.Item) (*pb.ItemReply, error) {
+func (s *server) GetRange(ctx context.Context, in *pb.RangeRequest) (*pb.ItemReply, error) {
 	resp := &pb.ItemReply{
 		Errcode: 0,
 		Status:  nil,
@@ -55,13 +59,63 @@ func (s *server) Set(_ context.Context, in *pb.Item) (*pb.ItemReply, error) {
 		Ver64:   0,
 		Sum64:   0,
 	}
-	if IsDisableSet == true {
+	if in.Key == nil {
+		resp.Errcode = 400
+		resp.Status = []byte("key cannot be empty")
+		return resp, nil
+	}
+	val, ver, total, found, err := badgerGetRange(ctx, in.Key, in.Offset, in.Length)
+	switch {
+	case !found && err == nil:
+		resp.Errcode = 404
+		resp.Status = []byte("Not Found")
+	case err == ErrRangeNotSatisfiable:
+		resp.Errcode = 416
+		resp.Status = []byte("range not satisfiable, length " + Uint64ToString(total))
+		resp.Ver64 = ver
+	case err != nil:
+		PrintError("GetRange", err)
+		resp.Errcode = 500
+		resp.Status = []byte(err.Error())
+	default:
+		resp.Data = val
+		resp.Ver64 = ver
+		resp.Sum64 = GetXxhash(val)
+		// like a http Content-Range
+		resp.Status = []byte("bytes " + Uint64ToString(in.Offset) + "-" + Uint64ToString(in.Offset+uint64(len(val))-1) + "/" + Uint64ToString(total))
+	}
+	return resp, nil
+}
+
+func (s *server) Set(ctx context.Context, in *pb.Item) (*pb.ItemReply, error) {
+	resp := &pb.ItemReply{
+		Errcode: 0,
+		Status:  nil,
+		Key:     in.Key,
+		Data:    nil,
+		Ver64:   0,
+		Sum64:   0,
+	}
+	if cfg().IsDisableSet == true {
 		resp.Errcode = 501
 		resp.Status = []byte("server disabled the set action")
 		resp.Key = nil
 		resp.Data = nil
 		return resp, nil
 	}
+	if blocked := diskWriteBlocked(int64(len(in.Data))); blocked != "" {
+		resp.Errcode = 507
+		resp.Status = []byte(blocked)
+		resp.Key = nil
+		return resp, nil
+	}
+
+	durability, err := requestDurability(ctx)
+	if err != nil {
+		resp.Errcode = 400
+		resp.Status = []byte(err.Error())
+		return resp, nil
+	}
 
 	if in.Data != nil {
 		sum64 := GetXxhash(in.Data)
@@ -71,10 +125,36 @@ func (s *server) Set(_ context.Context, in *pb.Item) (*pb.ItemReply, error) {
 			return resp, nil
 		}
 
-		k := badgerSave(in.Key, in.Data)
+		k, created, err := badgerSave(in.Key, in.Data, sum64, SaveOptions{
+			Compression: incomingMeta(ctx, "x-zstdb-compression"),
+			Client:      ClientID(ctx),
+		})
+		if err == ErrQuotaExceeded {
+			return nil, status.Error(codes.ResourceExhausted, err.Error())
+		}
+		if err == ErrNoVolume {
+			resp.Errcode = 507
+			resp.Status = []byte(err.Error())
+			resp.Key = nil
+			return resp, nil
+		}
+		if k != nil && created {
+			if err = waitDurable(durability); err != nil {
+				Logger(ctx).Warn("saved but not synced", "err", err)
+				resp.Errcode = 500
+				resp.Status = []byte("saved but not synced: " + err.Error())
+				return resp, nil
+			}
+		}
 		if k != nil {
 			resp.Key = k
+			if created {
+				AuditNote(ctx, "created")
+			} else {
+				AuditNote(ctx, "deduplicated")
+			}
 		} else {
+			Logger(ctx).Warn("cannot save into bgrdb", "err", err)
 			resp.Errcode = 500
 			resp.Status = []byte("cannot save into bgrdb")
 			resp.Key = nil
@@ -84,7 +164,7 @@ func (s *server) Set(_ context.Context, in *pb.Item) (*pb.ItemReply, error) {
 	return resp, nil
 }
 
-func (s *server) Delete(_ context.Context, in *pb.Item) (*pb.ItemReply, error) {
+func (s *server) Delete(ctx context.Context, in *pb.Item) (*pb.ItemReply, error) {
 	resp := &pb.ItemReply{
 		Errcode: 0,
 		Status:  nil,
@@ -94,16 +174,33 @@ func (s *server) Delete(_ context.Context, in *pb.Item) (*pb.ItemReply, error) {
 		Sum64:   0,
 	}
 
-	if IsDisableDelete == true {
+	if cfg().IsDisableDelete == true {
 		resp.Errcode = 501
 		resp.Status = []byte("server disabled the delete action")
 		resp.Key = nil
 		resp.Data = nil
 		return resp, nil
 	}
+
+	durability, err := requestDurability(ctx)
+	if err != nil {
+		resp.Errcode = 400
+		resp.Status = []byte(err.Error())
+		return resp, nil
+	}
+
 	if in.Key != nil {
-		err := badgerDelete(in.Key)
+		_, found, err := badgerDelete(in.Key)
+		if err == nil && found {
+			err = waitDurable(durability)
+		}
+		if err == nil && found {
+			AuditNote(ctx, "deleted")
+		} else if err == nil {
+			AuditNote(ctx, "not_found")
+		}
 		if err != nil {
+			Logger(ctx).Warn("cannot delete from bgrdb", "err", err)
 			resp.Errcode = 500
 			resp.Status = []byte(err.Error())
 			resp.Key = nil
@@ -144,6 +241,8 @@ func (s *server) Exists(_ context.Context, in *pb.Item) (*pb.ItemReply, error) {
 	rData := make(map[string]int)
 	rData["exists"] = 0
 	rData["length"] = 0
+	rData["stored"] = 0
+	rData["codec"] = 0
 	rData["mode"] = 0
 
 	if in.Key != nil {
@@ -159,7 +258,7 @@ func (s *server) Exists(_ context.Context, in *pb.Item) (*pb.ItemReply, error) {
 		}
 		rData["mode"] = mode
 
-		verNum, dataLength, dataSum64 := badgerExists(in.Key, mode)
+		verNum, dataLength, dataStored, dataCodec, dataSum64 := badgerExists(in.Key, mode)
 
 		if verNum == 0 {
 			resp.Errcode = 404
@@ -173,6 +272,8 @@ func (s *server) Exists(_ context.Context, in *pb.Item) (*pb.ItemReply, error) {
 			resp.Sum64 = dataSum64
 			rData["exists"] = 1
 			rData["length"] = dataLength
+			rData["stored"] = dataStored
+			rData["codec"] = dataCodec
 		}
 
 	}
@@ -198,6 +299,13 @@ func (s *server) Ping(_ context.Context, in *pb.Item) (*pb.ItemReply, error) {
 		resp.Data = []byte("oos")
 	} else {
 		resp.Data = []byte("ok")
+		// reads still work, the write blocks are only reported
+		switch {
+		case DiskState() != DiskOK:
+			resp.Status = []byte("disk " + diskStateNames[DiskState()] + " watermark")
+		case cfg().IsDisableSet:
+			resp.Status = []byte("set disabled")
+		}
 	}
 
 	return resp, nil
@@ -207,13 +315,77 @@ func (s *server) List(_ context.Context, in *pb.ListFilter) (*pb.ListFilterReply
 	resp := &pb.ListFilterReply{}
 	prefix := in.Prefix
 	pagenum := int(in.Pagenum)
-	badgerSync()
 	resp.Keys = badgerList(prefix, pagenum)
 
 	return resp, nil
 }
 
-func (s *server) Admin(_ context.Context, in *pb.Item) (*pb.ItemReply, error) {
+func (s *server) Watch(in *pb.WatchRequest, stream pb.Badger_WatchServer) error {
+	return Watch(stream.Context(), in.Prefixes, in.Since, stream.Send)
+}
+
+func (s *server) Txn(ctx context.Context, in *pb.TxnRequest) (*pb.TxnReply, error) {
+	resp := &pb.TxnReply{
+		Errcode: 0,
+		Status:  nil,
+		Results: nil,
+		Ver64:   0,
+	}
+
+	durability, err := requestDurability(ctx)
+	if err != nil {
+		resp.Errcode = 400
+		resp.Status = []byte(err.Error())
+		return resp, nil
+	}
+
+	results, done, ver, err := badgerTxn(in.Ops, SaveOptions{
+		Compression: incomingMeta(ctx, "x-zstdb-compression"),
+		Client:      ClientID(ctx),
+	})
+	resp.Results = results
+	if err == ErrQuotaExceeded {
+		return nil, status.Error(codes.ResourceExhausted, err.Error())
+	}
+	if err == ErrNoVolume {
+		resp.Errcode = 507
+		resp.Status = []byte(err.Error())
+		return resp, nil
+	}
+	if f, ok := err.(*txnFailure); ok {
+		resp.Errcode = f.errcode
+		resp.Status = []byte(f.Error())
+		if f.index >= 0 && f.index < len(results) && results[f.index] != nil {
+			results[f.index].Errcode = f.errcode
+			results[f.index].Status = []byte(f.Error())
+		}
+		return resp, nil
+	}
+	if err != nil {
+		Logger(ctx).Warn("cannot commit txn", "err", err)
+		resp.Errcode = 500
+		resp.Status = []byte(err.Error())
+		return resp, nil
+	}
+
+	for _, r := range done {
+		if r.applied {
+			err = waitDurable(durability)
+			break
+		}
+	}
+	if err != nil {
+		Logger(ctx).Warn("committed txn is not synced", "err", err)
+		resp.Errcode = 500
+		resp.Status = []byte(err.Error())
+		return resp, nil
+	}
+
+	resp.Ver64 = ver
+	return resp, nil
+}
+
+func (s *server) Admin(ctx context.Context, in *pb.Item) (*pb.ItemReply, error) {
 	resp := &pb.ItemReply{
 		Errcode: 0,
 		Status:  nil,
@@ -223,26 +395,20 @@ func (s *server) Admin(_ context.Context, in *pb.Item) (*pb.ItemReply, error) {
 		Sum64:   0,
 	}
 
-	if in.Sum64 != GetXxhash([]byte(AdminPassword)) {
+	if in.Sum64 != GetXxhash([]byte(cfg().AdminPassword)) {
 		resp.Errcode = 403
 		resp.Status = []byte("incorrect  password")
 		return resp, nil
 	}
 
-	badgerSync()
-
 	if in.Key != nil {
 		inKey := strings.ToLower(string(in.Key))
 		resp.Key = []byte(inKey)
 
 		if inKey == "stop" {
 			rDataStop := make(map[string]int)
-			go func() {
-				time.Sleep(2 * time.Second)
-				StopGrpcServer()
-				time.Sleep(2 * time.Second)
-				os.Exit(0)
-			}()
+			// GracefulStop lets this reply reach the client first
+			go Shutdown("rpc::admin stop", ExitOK)
 			rDataStop["done"] = 1
 			resp.Data = MapInt2JSON(rDataStop)
 
@@ -250,19 +416,98 @@ func (s *server) Admin(_ context.Context, in *pb.Item) (*pb.ItemReply, error) {
 		}
 
 		if inKey == "gc" {
+			rDataIn := make(map[string]string)
+			JSON2Map(in.Data, rDataIn)
+			ratio := cfg().GCDiscardRatio
+			if rDataIn["discard_ratio"] != "" {
+				r, err := strconv.ParseFloat(rDataIn["discard_ratio"], 64)
+				if err != nil || r <= 0 || r >= 1 {
+					resp.Errcode = 400
+					resp.Status = []byte("discard_ratio must be between 0 and 1")
+					return resp, nil
+				}
+				ratio = r
+			}
+			files := 1
+			if rDataIn["files"] != "" {
+				files = Str2Int(rDataIn["files"])
+			}
+
 			rDataGC := make(map[string]int)
-			err := bgrdb.RunValueLogGC(0.5)
+			run, err := RunGC(ctx, GCAdmin, ratio, files)
 			if err != nil {
 				resp.Status = []byte(err.Error())
-				rDataGC["done"] = 0
-			} else {
-				rDataGC["done"] = 1
 			}
+			rDataGC["done"] = min(run.Files, 1)
+			rDataGC["files"] = run.Files
+			rDataGC["reclaimed"] = int(run.Reclaimed)
 
 			resp.Data = MapInt2JSON(rDataGC)
 			return resp, nil
 		}
 
+		if inKey == "metrics" {
+			resp.Data = []byte(diskMetrics() + volumeMetrics())
+			return resp, nil
+		}
+
+		if inKey == "volumes" {
+			var lines []byte
+			for _, v := range ListVolumes() {
+				b, _ := json.Marshal(v)
+				lines = append(append(lines, b...), '\n')
+			}
+			resp.Data = lines
+			return resp, nil
+		}
+
+		if inKey == "volume-set" {
+			rDataVolume := make(map[string]string)
+			JSON2Map(in.Data, rDataVolume)
+
+			if err := SetVolumeState(rDataVolume["name"], rDataVolume["state"]); err != nil {
+				resp.Errcode = 400
+				resp.Status = []byte(err.Error())
+				return resp, nil
+			}
+			resp.Data = []byte("ok")
+			return resp, nil
+		}
+
+		if inKey == "volume-drain" {
+			rDataVolume := make(map[string]string)
+			JSON2Map(in.Data, rDataVolume)
+
+			job, err := StartVolumeDrain(rDataVolume["name"])
+			if err != nil {
+				resp.Errcode = 400
+				resp.Status = []byte(err.Error())
+				return resp, nil
+			}
+			j := job.Wait(2 * time.Second)
+			resp.Data, _ = json.Marshal(j)
+			return resp, nil
+		}
+
+		if inKey == "gc-runs" {
+			rDataIn := make(map[string]string)
+			JSON2Map(in.Data, rDataIn)
+
+			list, err := ListGCRuns(Str2Int(rDataIn["limit"]))
+			if err != nil {
+				resp.Errcode = 500
+				resp.Status = []byte(err.Error())
+				return resp, nil
+			}
+			var lines []byte
+			for _, run := range list {
+				b, _ := json.Marshal(run)
+				lines = append(append(lines, b...), '\n')
+			}
+			resp.Data = lines
+			return resp, nil
+		}
+
 		if inKey == "sync" {
 			rDataSync := make(map[string]int)
 			err := badgerSync()
@@ -289,13 +534,280 @@ func (s *server) Admin(_ context.Context, in *pb.Item) (*pb.ItemReply, error) {
 			lsm_size, vlog_size := bgrdb.Size()
 			rDataStatus["max_version"] = Uint64ToString(bgrdb.MaxVersion())
 			rDataStatus["key_count"] = Uint64ToString(keyCount)
+			for k, v := range CacheStats() {
+				rDataStatus[k] = v
+			}
+			if total, ok := TotalUsage(); ok {
+				rDataStatus["stored_bytes"] = Uint64ToString(total.Bytes)
+				rDataStatus["raw_bytes"] = Uint64ToString(total.RawBytes)
+			}
 			rDataStatus["lsm_size"] = Int64ToString(lsm_size)
 			rDataStatus["vlog_size"] = Int64ToString(vlog_size)
 			rDataStatus["elapse_ms"] = Int64ToString(tElapse)
 
+			encEnabled, encCurrent, _ := EncryptionStatus()
+			rDataStatus["encryption"] = strconv.FormatBool(encEnabled)
+			rDataStatus["encryption_key_id"] = Uint64ToString(uint64(encCurrent))
+
+			for k, v := range EffectiveConfig() {
+				rDataStatus["config."+k] = v
+			}
+			for k, v := range DurabilityStats() {
+				rDataStatus[k] = v
+			}
+			for k, v := range GCStats() {
+				rDataStatus[k] = v
+			}
+			for k, v := range DiskStats() {
+				rDataStatus[k] = v
+			}
+			for k, v := range VolumeStats() {
+				rDataStatus[k] = v
+			}
+			for k, v := range BadgerOptionsReport(bgrdb.Opts()) {
+				rDataStatus[k] = v
+			}
+
 			resp.Data = Map2JSON(rDataStatus)
 		}
 
+		if inKey == "usage" {
+			resp.Data = Map2JSON(UsageReport())
+			return resp, nil
+		}
+
+		if inKey == "audit" {
+			rDataAudit := make(map[string]string)
+			JSON2Map(in.Data, rDataAudit)
+
+			since, err := ParseAuditTime(rDataAudit["since"])
+			if err == nil {
+				var until time.Time
+				until, err = ParseAuditTime(rDataAudit["until"])
+				if err == nil {
+					var entries []AuditEntry
+					entries, err = QueryAudit(since, until, Str2Int(rDataAudit["limit"]), rDataAudit["op"], rDataAudit["prefix"])
+					var lines []byte
+					for _, e := range entries {
+						b, _ := json.Marshal(e)
+						lines = append(append(lines, b...), '\n')
+					}
+					resp.Data = lines
+				}
+			}
+			if err != nil {
+				resp.Errcode = 500
+				resp.Status = []byte(err.Error())
+			}
+			return resp, nil
+		}
+
+		if inKey == "delete-prefix" || inKey == "delete-range" {
+			rDataDel := make(map[string]string)
+			JSON2Map(in.Data, rDataDel)
+			dryRun := rDataDel["dry_run"] == "true" || rDataDel["dry_run"] == "1"
+
+			var job *Job
+			var err error
+			if inKey == "delete-prefix" {
+				job, err = StartDeletePrefix(rDataDel["prefix"], dryRun)
+			} else {
+				job, err = StartDeleteRange(rDataDel["start"], rDataDel["end"], dryRun)
+			}
+			if err != nil {
+				resp.Errcode = 501
+				resp.Status = []byte(err.Error())
+				return resp, nil
+			}
+
+			// small jobs answer at once, see Admin jobs for the others
+			j := job.Wait(2 * time.Second)
+			resp.Data, _ = json.Marshal(j)
+			return resp, nil
+		}
+
+		if inKey == "offload" {
+			rDataOffload := make(map[string]string)
+			JSON2Map(in.Data, rDataOffload)
+			dryRun := rDataOffload["dry_run"] == "true" || rDataOffload["dry_run"] == "1"
+
+			olderThan := cfg().OffloadAfter
+			if s := rDataOffload["older_than"]; s != "" {
+				d, err := time.ParseDuration(s)
+				if err != nil {
+					resp.Errcode = 400
+					resp.Status = []byte(err.Error())
+					return resp, nil
+				}
+				olderThan = d
+			}
+			job, err := StartOffload(rDataOffload["prefix"], olderThan, dryRun)
+			if err != nil {
+				resp.Errcode = 501
+				resp.Status = []byte(err.Error())
+				return resp, nil
+			}
+			j := job.Wait(2 * time.Second)
+			resp.Data, _ = json.Marshal(j)
+			return resp, nil
+		}
+
+		if inKey == "scrub" {
+			rDataScrub := make(map[string]string)
+			JSON2Map(in.Data, rDataScrub)
+
+			job, err := StartScrub(rDataScrub["prefix"], rDataScrub["action"], rDataScrub["backup"])
+			if err != nil {
+				resp.Errcode = 400
+				resp.Status = []byte(err.Error())
+				return resp, nil
+			}
+			j := job.Wait(2 * time.Second)
+			resp.Data, _ = json.Marshal(j)
+			return resp, nil
+		}
+
+		if inKey == "scrub-results" {
+			rDataScrub := make(map[string]string)
+			JSON2Map(in.Data, rDataScrub)
+
+			list, err := ListScrubPasses()
+			if err != nil {
+				resp.Errcode = 500
+				resp.Status = []byte(err.Error())
+				return resp, nil
+			}
+			var lines []byte
+			for _, r := range list {
+				if rDataScrub["id"] != "" && Uint64ToString(r.ID) != rDataScrub["id"] {
+					continue
+				}
+				b, _ := json.Marshal(r)
+				lines = append(append(lines, b...), '\n')
+			}
+			resp.Data = lines
+			return resp, nil
+		}
+
+		if inKey == "recount" {
+			j := StartRecount().Wait(2 * time.Second)
+			resp.Data, _ = json.Marshal(j)
+			return resp, nil
+		}
+
+		if inKey == "jobs" {
+			rDataJobs := make(map[string]string)
+			JSON2Map(in.Data, rDataJobs)
+
+			var lines []byte
+			for _, j := range ListJobs() {
+				if rDataJobs["id"] != "" && Uint64ToString(j.ID) != rDataJobs["id"] {
+					continue
+				}
+				b, _ := json.Marshal(j)
+				lines = append(append(lines, b...), '\n')
+			}
+			resp.Data = lines
+			return resp, nil
+		}
+
+		if inKey == "webhook-dlq" {
+			rDataDLQ := make(map[string]string)
+			JSON2Map(in.Data, rDataDLQ)
+
+			var err error
+			if rDataDLQ["retry"] != "" {
+				var n int
+				id := Str2Uint64(rDataDLQ["retry"])
+				if rDataDLQ["retry"] == "all" {
+					id = 0
+				}
+				n, err = RetryWebhookDLQ(id)
+				resp.Data = Map2JSON(map[string]string{"retried": Int2Str(n)})
+			} else {
+				var jobs []WebhookJob
+				jobs, err = WebhookDLQ(Str2Int(rDataDLQ["limit"]))
+				var lines []byte
+				for _, job := range jobs {
+					b, _ := json.Marshal(job)
+					lines = append(append(lines, b...), '\n')
+				}
+				resp.Data = lines
+			}
+			if err != nil {
+				resp.Errcode = 500
+				resp.Status = []byte(err.Error())
+			}
+			return resp, nil
+		}
+
+		if inKey == "reload" {
+			rDataReload := make(map[string]string)
+			changed, err := ReloadConfig()
+			if err != nil {
+				resp.Errcode = 500
+				resp.Status = []byte(err.Error())
+			}
+			rDataReload["config"] = ConfigFile
+			rDataReload["changed"] = strings.Join(changed, ",")
+			resp.Data = Map2JSON(rDataReload)
+			return resp, nil
+		}
+
+		if inKey == "dict-train" {
+			rDataDict := make(map[string]string)
+			err := JSON2Map(in.Data, rDataDict)
+			if err != nil {
+				resp.Errcode = 500
+				resp.Status = []byte(err.Error())
+				return resp, nil
+			}
+
+			id, samples, err := TrainDict(rDataDict["prefix"], Str2Int(rDataDict["samples"]), Str2Int(rDataDict["size"]))
+			if err != nil {
+				resp.Errcode = 500
+				resp.Status = []byte(err.Error())
+			}
+			rDataDict["id"] = Uint64ToString(uint64(id))
+			rDataDict["samples"] = Int2Str(samples)
+			resp.Data = Map2JSON(rDataDict)
+			return resp, nil
+		}
+
+		if inKey == "rotate-key" {
+			rDataKey := make(map[string]string)
+			JSON2Map(in.Data, rDataKey)
+
+			var err error
+			if rDataKey["new_key_file"] != "" {
+				var nk []byte
+				nk, err = ReadMasterKey(rDataKey["new_key_file"])
+				if err == nil && nk == nil {
+					err = NewError("new_key_file is empty")
+				}
+				if err == nil {
+					err = RewrapDataKeys(nk)
+				}
+			} else {
+				_, err = RotateDataKey()
+			}
+			if err != nil {
+				resp.Errcode = 500
+				resp.Status = []byte(err.Error())
+			}
+
+			_, current, keys := EncryptionStatus()
+			rDataKey["current_key_id"] = Uint64ToString(uint64(current))
+			rDataKey["keys"] = Int2Str(keys)
+			resp.Data = Map2JSON(rDataKey)
+			return resp, nil
+		}
+
+		if inKey == "dict-list" {
+			resp.Data = Map2JSON(DictList())
+			return resp, nil
+		}
+
 		if inKey == "backup" || inKey == "restore" {
 			resp.Key = []byte(inKey)
 			inData := in.Data
@@ -368,49 +880,46 @@ func (s *server) Admin(_ context.Context, in *pb.Item) (*pb.ItemReply, error) {
 	return resp, nil
 }
 
-func StartGrpcServer() {
-	addr := fmt.Sprintf("%v:%v", Host, Port)
-	lis, err := net.Listen("tcp", addr)
-	FatalError("StartGrpcServer", err)
-	//
+// incomingMeta returns the first value of a request metadata key, or "".
+func incomingMeta(ctx context.Context, k string) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+	v := md.Get(k)
+	if len(v) == 0 {
+		return ""
+	}
+	return v[0]
+}
+
+// NewGrpcServer creates rpcServer, it is served by StartGrpcServer.
+func NewGrpcServer() {
 	opts := []grpc.ServerOption{
 		grpc.MaxRecvMsgSize(4096 * 1024 * 1024),
 		grpc.MaxSendMsgSize(4096 * 1024 * 1024),
 	}
 
-	primaryIP := GetPrimaryIP()
+	opts = append(opts,
+		grpc.ChainUnaryInterceptor(LogInterceptor, AuditInterceptor, UnaryLimitInterceptor),
+		grpc.ChainStreamInterceptor(StreamLogInterceptor, StreamLimitInterceptor),
+	)
 
 	rpcServer = grpc.NewServer(opts...)
 	pb.RegisterBadgerServer(rpcServer, &server{})
+}
+
+func StartGrpcServer() {
+	addr := fmt.Sprintf("%v:%v", Host, Port)
+	lis, err := net.Listen("tcp", addr)
+	FatalError("StartGrpcServer", err)
+	//
+	primaryIP := GetPrimaryIP()
+
 	DebugInfo("StartGrpcServer", "GRPC ADDRESS: ", addr)
 	DebugInfo("StartGrpcServer", "GRPC(remote): ", primaryIP, ":", Port)
 	DebugInfo("StartGrpcServer", "GRPC(local): ", "127.0.0.1:", Port)
-	if err := rpcServer.Serve(lis); err != nil {
+	if err := rpcServer.Serve(lis); err != nil && !IsStopping() {
 		FatalError("StartGrpcServer", err)
 	}
 }
-
-func StopGrpcServer() {
-	DebugInfo("StopGrpcServer", "Stopping ...")
-	ScheduleTask.Stop()
-	rpcServer.GracefulStop()
-	badgerSync()
-	bgrdb.Close()
-
-	if pidFile != "" {
-		_, err := os.Stat(pidFile)
-		if err == nil {
-			RemoveFile(pidFile)
-		}
-	}
-
-	if rpcFile != "" {
-		_, err := os.Stat(rpcFile)
-		if err == nil {
-			RemoveFile(rpcFile)
-		}
-	}
-
-	StopFileLogging()
-	DebugInfo("StopGrpcServer", "Done")
-}
@@ -0,0 +1,201 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// A minimal client of the S3 API (PutObject, GetObject, HeadObject,
+// DeleteObject) with path-style urls and AWS signature version 4, it works
+// with AWS S3, MinIO, Ceph RGW and the like.
+var (
+	S3Endpoint  string
+	S3Bucket    string
+	S3Region    string
+	S3AccessKey string
+	S3SecretKey string
+	S3Prefix    string
+	S3Timeout   time.Duration
+)
+
+// errS3NotFound is returned for objects which do not exist.
+var errS3NotFound = NewError("s3 object not found")
+
+type s3Client struct {
+	endpoint  *url.URL
+	bucket    string
+	region    string
+	accessKey string
+	secretKey string
+	http      *http.Client
+	now       func() time.Time
+}
+
+// S3Enabled tells if --s3-endpoint and --s3-bucket are set.
+func S3Enabled() bool {
+	s := cfg()
+	return s.S3Endpoint != "" && s.S3Bucket != ""
+}
+
+func newS3Client() (*s3Client, error) {
+	if !S3Enabled() {
+		return nil, NewError("s3 is not configured, see --s3-endpoint and --s3-bucket")
+	}
+	s := cfg()
+	u, err := url.Parse(strings.TrimRight(s.S3Endpoint, "/"))
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, NewError("--s3-endpoint must be http(s)://host[:port]: " + s.S3Endpoint)
+	}
+	region := s.S3Region
+	if region == "" {
+		region = "us-east-1"
+	}
+	secretKey := s.S3SecretKey
+	if secretKey == "" {
+		secretKey = os.Getenv("zstdb_s3_secret_key")
+	}
+	return &s3Client{
+		endpoint:  u,
+		bucket:    s.S3Bucket,
+		region:    region,
+		accessKey: s.S3AccessKey,
+		secretKey: secretKey,
+		http:      &http.Client{Timeout: s.S3Timeout},
+		now:       time.Now,
+	}, nil
+}
+
+func (c *s3Client) Put(ctx context.Context, name string, body []byte) error {
+	_, err := c.do(ctx, http.MethodPut, name, body)
+	return err
+}
+
+func (c *s3Client) Get(ctx context.Context, name string) ([]byte, error) {
+	return c.do(ctx, http.MethodGet, name, nil)
+}
+
+// Exists tells if the bucket has the object name.
+func (c *s3Client) Exists(ctx context.Context, name string) (bool, error) {
+	_, err := c.do(ctx, http.MethodHead, name, nil)
+	if err == errS3NotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Delete succeeds for objects which do not exist.
+func (c *s3Client) Delete(ctx context.Context, name string) error {
+	_, err := c.do(ctx, http.MethodDelete, name, nil)
+	if err == errS3NotFound {
+		return nil
+	}
+	return err
+}
+
+func (c *s3Client) do(ctx context.Context, method, name string, body []byte) ([]byte, error) {
+	u := *c.endpoint
+	u.Path = strings.TrimRight(u.Path, "/") + "/" + c.bucket + "/" + name
+	u.RawPath = s3EscapePath(u.Path)
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = int64(len(body))
+	c.sign(req, body)
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, errS3NotFound
+	}
+	if resp.StatusCode/100 != 2 {
+		msg := string(b)
+		if len(msg) > 256 {
+			msg = msg[:256]
+		}
+		return nil, NewError("s3 " + method + " " + name + ": " + resp.Status + " " + msg)
+	}
+	return b, nil
+}
+
+// sign adds the headers of AWS signature version 4.
+func (c *s3Client) sign(req *http.Request, body []byte) {
+	t := c.now().UTC()
+	amzDate := t.Format("20060102T150405Z")
+	day := t.Format("20060102")
+	payloadHash := sha256Hex(body)
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+	canonical := strings.Join([]string{
+		req.Method,
+		s3EscapePath(req.URL.Path),
+		req.URL.Query().Encode(),
+		"host:" + req.URL.Host,
+		"x-amz-content-sha256:" + payloadHash,
+		"x-amz-date:" + amzDate,
+		"",
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := day + "/" + c.region + "/s3/aws4_request"
+	toSign := strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, scope, sha256Hex([]byte(canonical))}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+c.secretKey), day)
+	key = hmacSHA256(key, c.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, toSign))
+
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+c.accessKey+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+// s3EscapePath escapes every byte but the unreserved ones and "/".
+func s3EscapePath(p string) string {
+	var b strings.Builder
+	for i := 0; i < len(p); i++ {
+		ch := p[i]
+		if ch == '/' || ch == '-' || ch == '_' || ch == '.' || ch == '~' ||
+			('A' <= ch && ch <= 'Z') || ('a' <= ch && ch <= 'z') || ('0' <= ch && ch <= '9') {
+			b.WriteByte(ch)
+			continue
+		}
+		b.WriteString("%" + strings.ToUpper(hex.EncodeToString([]byte{ch})))
+	}
+	return b.String()
+}
+
+func sha256Hex(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, s string) []byte {
+	m := hmac.New(sha256.New, key)
+	m.Write([]byte(s))
+	return m.Sum(nil)
+}
@@ -0,0 +1,620 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	badger "github.com/dgraph-io/badger/v4"
+	"github.com/dgraph-io/badger/v4/pb"
+	"google.golang.org/protobuf/proto"
+)
+
+// The scrubber reads every value back and checks it: Badger can read it,
+// it decodes, and the result has the raw length and xxhash of its header.
+// Values written before the header had the xxhash are checked against their
+// key if it is a content key (the blake3 of the value). Offloaded values are
+// not fetched from S3.
+//
+// Each pass is a job; its corrupt keys are saved under
+// \x00zstdb/scrub/<job id:8>. With --scrub-action=repair a corrupt value is
+// replaced by a copy from the backups which has the same content, with
+// quarantine a value that cannot be repaired is moved to
+// \x00zstdb/quarantine/<key>.
+var (
+	ScrubEvery  string
+	ScrubRateMB int64
+	ScrubAction string
+
+	scrubRunning atomic.Bool
+)
+
+const (
+	ScrubReport     = "report"
+	ScrubRepair     = "repair"
+	ScrubQuarantine = "quarantine"
+
+	maxScrubPasses = 20
+	maxScrubFaults = 1000
+)
+
+type ScrubFault struct {
+	Key    string `json:"key"`
+	Ver    uint64 `json:"ver"`
+	Error  string `json:"error"`
+	Action string `json:"action,omitempty"`
+
+	// what the value must decode to, for repair
+	sum64  uint64
+	blake3 bool
+}
+
+type ScrubPass struct {
+	Skipped     uint64       `json:"skipped"`
+	Corrupt     uint64       `json:"corrupt"`
+	Repaired    uint64       `json:"repaired"`
+	Quarantined uint64       `json:"quarantined"`
+	Faults      []ScrubFault `json:"faults,omitempty"`
+}
+
+// ScrubResult is a pass with its job, as Admin scrub-results lists it.
+type ScrubResult struct {
+	Job
+	ScrubPass
+}
+
+func scrubKey(id uint64) []byte {
+	return binary.BigEndian.AppendUint64(InternalKey("scrub/"), id)
+}
+
+func quarantineKey(key []byte) []byte {
+	return append(InternalKey("quarantine/"), key...)
+}
+
+// isContentKey tells if key has the form of SumBlake3.
+func isContentKey(key []byte) bool {
+	if len(key) != 64 {
+		return false
+	}
+	for _, c := range key {
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// checkValue verifies the stored value v of key and returns what its content
+// must match, skipped is true for offloaded values.
+func checkValue(key, v []byte) (f ScrubFault, skipped bool, err error) {
+	h, payload, ok := parseValueHeader(v)
+	if ok && h.Codec == CodecS3 {
+		if _, _, ok := parseS3Stub(payload); !ok {
+			return f, false, NewError("invalid s3 stub")
+		}
+		return f, true, nil
+	}
+	if ok && h.Flags&flagMeta != 0 {
+		f.sum64 = h.Sum64
+	}
+	// with --allow-user-key a key of 64 hex digits may be chosen by a client
+	f.blake3 = f.sum64 == 0 && isContentKey(key) && !IsAllowUserKey
+
+	raw, err := UnZstdBytes(v)
+	if err != nil {
+		return f, false, err
+	}
+	if ok && h.Flags&flagMeta != 0 && h.RawLen != uint64(len(raw)) {
+		return f, false, NewError("length " + Uint64ToString(uint64(len(raw))) + " != " + Uint64ToString(h.RawLen))
+	}
+	if !f.matches(key, raw) {
+		return f, false, NewError("content does not match its hash")
+	}
+	return f, false, nil
+}
+
+// matches tells if raw is the content the value of key must have, false if
+// there is nothing to compare to.
+func (f *ScrubFault) matches(key, raw []byte) bool {
+	switch {
+	case f.sum64 != 0:
+		return GetXxhash(raw) == f.sum64
+	case f.blake3:
+		return bytes.Equal(SumBlake3(raw), key)
+	}
+	return true
+}
+
+func (f *ScrubFault) verifiable() bool {
+	return f.sum64 != 0 || f.blake3
+}
+
+func checkScrubAction(action string) error {
+	if action != "" && action != ScrubReport && action != ScrubRepair && action != ScrubQuarantine {
+		return NewError("action must be report, repair or quarantine")
+	}
+	return nil
+}
+
+// StartScrub checks the values under prefix in the background, backup is a
+// backup file or directory for repair, --auto-backup-dir if empty.
+func StartScrub(prefix, action, backup string) (*Job, error) {
+	if action == "" {
+		action = ScrubReport
+	}
+	if err := checkScrubAction(action); err != nil {
+		return nil, err
+	}
+	if backup == "" {
+		backup = cfg().AutoBackupDir
+	}
+	if !scrubRunning.CompareAndSwap(false, true) {
+		return nil, NewError("a scrub is running")
+	}
+
+	params := map[string]string{"prefix": prefix, "action": action}
+	if action != ScrubReport {
+		params["backup"] = backup
+	}
+	return StartJob("scrub", params, func(ctx context.Context, j *Job) error {
+		defer scrubRunning.Store(false)
+
+		var pass ScrubPass
+		err := scrub(ctx, j, prefix, &pass)
+		if err == nil && len(pass.Faults) > 0 && action != ScrubReport {
+			err = repairFaults(ctx, &pass, action, backup)
+		}
+		if pass.Corrupt > 0 {
+			DebugWarn("scrub", "#", j.ID, " corrupt keys: ", pass.Corrupt, ", repaired: ", pass.Repaired, ", quarantined: ", pass.Quarantined)
+		}
+		PrintError("scrub", saveScrubPass(j.ID, pass))
+		return err
+	}), nil
+}
+
+func scrub(ctx context.Context, j *Job, prefix string, pass *ScrubPass) error {
+	p := []byte(prefix)
+	cursor := p
+	var limit scrubThrottle
+	for {
+		var read uint64
+		var next []byte
+		err := bgrdb.View(func(txn *badger.Txn) error {
+			it := txn.NewIterator(badger.IteratorOptions{PrefetchValues: false})
+			defer it.Close()
+			for it.Seek(cursor); it.ValidForPrefix(p); it.Next() {
+				item := it.Item()
+				if IsInternalKey(item.Key()) {
+					continue
+				}
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				// a batch ends after 64MB, so the throttle does not hold the txn
+				if read >= 64<<20 {
+					next = item.KeyCopy(nil)
+					return nil
+				}
+
+				var stored, raw uint64
+				var f ScrubFault
+				var skipped bool
+				err := item.Value(func(v []byte) error {
+					_, stored, raw = valueSizes(v)
+					var err error
+					f, skipped, err = checkValue(item.Key(), v)
+					return err
+				})
+				read += stored
+				j.Add(1, stored, raw)
+				if skipped {
+					pass.Skipped++
+				}
+				if err != nil {
+					PrintError("scrub "+string(item.Key()), err)
+					if !f.verifiable() {
+						// Badger could not read it, a content key still tells the content
+						f.blake3 = isContentKey(item.Key()) && !IsAllowUserKey
+					}
+					pass.Corrupt++
+					if len(pass.Faults) < maxScrubFaults {
+						f.Key, f.Ver, f.Error = string(item.Key()), item.Version(), err.Error()
+						pass.Faults = append(pass.Faults, f)
+					}
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if err = limit.wait(ctx, read); err != nil || next == nil {
+			return err
+		}
+		cursor = next
+	}
+}
+
+// scrubThrottle keeps the reads under --scrub-rate-mb per second.
+type scrubThrottle struct {
+	start time.Time
+	rate  int64
+	read  uint64
+}
+
+func (t *scrubThrottle) wait(ctx context.Context, n uint64) error {
+	rate := cfg().ScrubRateMB << 20
+	if rate <= 0 {
+		return nil
+	}
+	if rate != t.rate {
+		// changed by a reload
+		*t = scrubThrottle{start: time.Now(), rate: rate}
+	}
+	t.read += n
+	d := time.Duration(float64(t.read)/float64(rate)*float64(time.Second)) - time.Since(t.start)
+	if d <= 0 {
+		return nil
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(d):
+		return nil
+	}
+}
+
+// repairFaults replaces the corrupt values by good copies from the backups,
+// with quarantine the others are moved away.
+func repairFaults(ctx context.Context, pass *ScrubPass, action, backup string) error {
+	wanted := make(map[string]*ScrubFault)
+	for i := range pass.Faults {
+		if pass.Faults[i].verifiable() {
+			wanted[pass.Faults[i].Key] = &pass.Faults[i]
+		}
+	}
+	var found map[string]backupCopy
+	if backup != "" && len(wanted) > 0 {
+		var err error
+		if found, err = findBackupCopies(ctx, backup, wanted); err != nil {
+			return err
+		}
+	}
+
+	recount := false
+	for i := range pass.Faults {
+		f := &pass.Faults[i]
+		if c, ok := found[f.Key]; ok {
+			unreadable, err := restoreCopy(f, c)
+			if err != nil {
+				return err
+			}
+			recount = recount || unreadable
+			if f.Action != "" {
+				pass.Repaired++
+				continue
+			}
+		}
+		if action == ScrubQuarantine {
+			unreadable, err := quarantineValue(f)
+			if err != nil {
+				return err
+			}
+			recount = recount || unreadable
+			if f.Action != "" {
+				pass.Quarantined++
+			}
+		}
+	}
+	if recount {
+		// the usage of values Badger could not read is unknown
+		StartRecount()
+	}
+	return nil
+}
+
+type backupCopy struct {
+	ver  uint64
+	v    []byte
+	blob []byte // the file of a blob pointer
+}
+
+// findBackupCopies reads the backups, newest first, and returns for each key
+// of wanted the newest copy which decodes to the content it must have.
+func findBackupCopies(ctx context.Context, backup string, wanted map[string]*ScrubFault) (map[string]backupCopy, error) {
+	files, err := backupFiles(backup)
+	if err != nil {
+		return nil, err
+	}
+	found := make(map[string]backupCopy)
+	for _, fpath := range files {
+		blobDir := ToUnixSlash(filepath.Join(filepath.Dir(fpath), "blobs"))
+		err := readBackup(fpath, func(kv *pb.KV) error {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			f, ok := wanted[string(kv.Key)]
+			if !ok || len(kv.Meta) > 0 && kv.Meta[0]&bitDelete != 0 || kv.Version <= found[f.Key].ver {
+				return nil
+			}
+			raw, blob, err := decodeBackupValue(kv.Value, blobDir)
+			if err != nil || !f.matches(kv.Key, raw) {
+				return nil
+			}
+			found[f.Key] = backupCopy{ver: kv.Version, v: kv.Value, blob: blob}
+			return nil
+		})
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		// a damaged backup still may have the copy in another one
+		PrintError("scrub, backup "+fpath, err)
+	}
+	return found, nil
+}
+
+// bitDelete is Badger's meta bit of a deleted key in a backup.
+const bitDelete byte = 1 << 0
+
+// backupFiles lists the backup file fpath, or the backups in the directory
+// fpath, newest first.
+func backupFiles(fpath string) ([]string, error) {
+	fi, err := os.Stat(fpath)
+	if err != nil {
+		return nil, err
+	}
+	if !fi.IsDir() {
+		return []string{fpath}, nil
+	}
+	entries, err := os.ReadDir(fpath)
+	if err != nil {
+		return nil, err
+	}
+	type file struct {
+		path string
+		mod  time.Time
+	}
+	var list []file
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || name == "ver" || strings.HasSuffix(name, ".ing") || strings.HasSuffix(name, ".done") || strings.HasSuffix(name, ".error") {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		list = append(list, file{ToUnixSlash(filepath.Join(fpath, name)), info.ModTime()})
+	}
+	sort.Slice(list, func(a, b int) bool { return list[a].mod.After(list[b].mod) })
+	files := make([]string, len(list))
+	for i, f := range list {
+		files[i] = f.path
+	}
+	return files, nil
+}
+
+// readBackup calls fn for each key of a file written by bgrdb.Backup, the
+// format bgrdb.Load reads.
+func readBackup(fpath string, fn func(kv *pb.KV) error) error {
+	fp, err := os.Open(fpath)
+	if err != nil {
+		return err
+	}
+	defer fp.Close()
+
+	br := bufio.NewReaderSize(fp, 16<<10)
+	var buf []byte
+	for {
+		var sz uint64
+		err := binary.Read(br, binary.LittleEndian, &sz)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if sz > 4<<30 {
+			return NewError("invalid backup: " + fpath)
+		}
+		if uint64(cap(buf)) < sz {
+			buf = make([]byte, sz)
+		}
+		if _, err = io.ReadFull(br, buf[:sz]); err != nil {
+			return err
+		}
+		list := &pb.KVList{}
+		if err = proto.Unmarshal(buf[:sz], list); err != nil {
+			return err
+		}
+		for _, kv := range list.Kv {
+			if err = fn(kv); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// decodeBackupValue decodes a value of a backup, a blob pointer is followed
+// into blobDir, next to the backup, and its file returned.
+func decodeBackupValue(v []byte, blobDir string) (raw, blob []byte, err error) {
+	h, payload, ok := parseValueHeader(v)
+	if ok && h.Codec == CodecS3 {
+		return nil, nil, NewError("offloaded")
+	}
+	if ok && h.Codec == CodecBlob {
+		_, hash, ok := parseBlobPointer(payload)
+		if !ok {
+			return nil, nil, NewError("invalid blob pointer")
+		}
+		if blob, err = os.ReadFile(blobPath(blobDir, hash)); err != nil {
+			return nil, nil, err
+		}
+		if h, _, ok := parseValueHeader(blob); !ok || h.Codec == CodecBlob || h.Codec == CodecS3 {
+			return nil, nil, NewError("invalid blob file: " + hash)
+		}
+		raw, err = UnZstdBytes(blob)
+		return raw, blob, err
+	}
+	raw, err = UnZstdBytes(v)
+	return raw, nil, err
+}
+
+// restoreCopy writes the copy c over the corrupt value of f, unless the key
+// changed since the scan. unreadable is true if Badger could not read the
+// value it replaced.
+func restoreCopy(f *ScrubFault, c backupCopy) (unreadable bool, err error) {
+	key := []byte(f.Key)
+	if hash, ok := storedBlob(c.v); ok {
+		blobMu.RLock()
+		defer blobMu.RUnlock()
+		// over the corrupt file, wherever it is
+		path, ok := blobFile(hash)
+		if !ok {
+			v, err := placeBlob(hash)
+			if err != nil {
+				return false, err
+			}
+			path = blobPath(v.blobDir(), hash)
+		}
+		if err = writeFileSync(path, c.blob); err != nil {
+			return false, err
+		}
+	}
+
+	err = badgerUpdate(func(txn *badger.Txn) error {
+		unreadable = false
+		item, err := txn.Get(key)
+		if err == badger.ErrKeyNotFound || (err == nil && item.Version() != f.Ver) {
+			f.Action = ""
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		f.Action = "repaired"
+		if _, err := item.ValueCopy(nil); err != nil {
+			unreadable = true
+			return setMoved(txn, key, item, c.v)
+		}
+		return swapStored(txn, key, item, c.v)
+	})
+	CacheInvalidate(key)
+	return unreadable, err
+}
+
+// quarantineValue moves the corrupt value of f to \x00zstdb/quarantine/,
+// the key is deleted. The file of a blob pointer is removed with its last
+// pointer.
+func quarantineValue(f *ScrubFault) (unreadable bool, err error) {
+	key := []byte(f.Key)
+	err = badgerUpdate(func(txn *badger.Txn) error {
+		unreadable = false
+		item, err := txn.Get(key)
+		if err == badger.ErrKeyNotFound || (err == nil && item.Version() != f.Ver) {
+			f.Action = ""
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		f.Action = "quarantined"
+		v, err := item.ValueCopy(nil)
+		if err != nil {
+			unreadable = true
+			if err = txn.Set(quarantineKey(key), nil); err != nil {
+				return err
+			}
+			if err = cdcAppend(txn, cdcDelete, key, 0, 0); err != nil {
+				return err
+			}
+			if err = txn.Delete(movedVerKey(key)); err != nil {
+				return err
+			}
+			return txn.Delete(key)
+		}
+		if err = txn.Set(quarantineKey(key), v); err != nil {
+			return err
+		}
+		_, _, err = txnDelete(txn, key)
+		return err
+	})
+	CacheInvalidate(key)
+	return unreadable, err
+}
+
+func saveScrubPass(id uint64, pass ScrubPass) error {
+	b, err := json.Marshal(pass)
+	if err != nil {
+		return err
+	}
+	return bgrdb.Update(func(txn *badger.Txn) error {
+		if err := txn.Set(scrubKey(id), b); err != nil {
+			return err
+		}
+		// keep the newest maxScrubPasses
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		opts.Prefix = InternalKey("scrub/")
+		opts.Reverse = true
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		var old [][]byte
+		n := 0
+		for it.Seek(append(InternalKey("scrub/"), 0xff)); it.Valid(); it.Next() {
+			if n++; n > maxScrubPasses {
+				old = append(old, it.Item().KeyCopy(nil))
+			}
+		}
+		for _, k := range old {
+			if err := txn.Delete(k); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// ListScrubPasses returns the saved passes, newest first.
+func ListScrubPasses() ([]ScrubResult, error) {
+	var list []ScrubResult
+	err := bgrdb.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = InternalKey("scrub/")
+		opts.Reverse = true
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		for it.Seek(append(InternalKey("scrub/"), 0xff)); it.Valid(); it.Next() {
+			item := it.Item()
+			var r ScrubResult
+			err := item.Value(func(v []byte) error {
+				return json.Unmarshal(v, &r.ScrubPass)
+			})
+			if err != nil {
+				return err
+			}
+			id := binary.BigEndian.Uint64(item.Key()[len(opts.Prefix):])
+			if r.Job = GetJob(id); r.Job.ID == 0 {
+				r.Job = Job{ID: id, Kind: "scrub"}
+			}
+			list = append(list, r)
+		}
+		return nil
+	})
+	return list, err
+}
+
+// AutoScrub is run by cron with --scrub-every.
+func AutoScrub() {
+	_, err := StartScrub("", cfg().ScrubAction, "")
+	PrintError("AutoScrub", err)
+}
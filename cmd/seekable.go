@@ -0,0 +1,256 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/binary"
+	"sort"
+)
+
+// Values larger than --seekable-frame-kb are compressed as independent zstd
+// frames followed by a seek table, in the zstd seekable format:
+//
+//	[frame]...[skippable frame: magic 0x184D2A5E][size:4]
+//	          [compressed size:4][raw size:4][checksum:4]... [frames:4][descriptor:1][0x8F92EAB1]
+//
+// The seek table is a skippable frame, so a plain zstd decoder still reads
+// the whole value; ReadRange decodes only the frames the range touches and
+// checks each against the low 32 bits of its xxhash. Tables written before
+// had no checksums (descriptor bit 7 unset).
+var SeekableFrameKB int64
+
+const (
+	seekTableMagic     uint32 = 0x184D2A5E
+	seekableMagic      uint32 = 0x8F92EAB1
+	seekTableFooter           = 9
+	seekTableEntry            = 8
+	seekTableEntrySum         = 12
+	seekTableChecksums byte   = 0x80
+	skippableHeadSize         = 8
+)
+
+type seekFrame struct {
+	rawOffset uint64
+	rawSize   uint64
+	zOffset   uint64
+	zSize     uint64
+	checksum  uint32
+}
+
+func seekableFrameSize(n int) int {
+	size := int(cfg().SeekableFrameKB << 10)
+	if size <= 0 || n <= size {
+		return 0
+	}
+	return size
+}
+
+// zstdSeekable compresses raw in frames of frameSize, it returns the
+// dictionary used like zstdBytesDict.
+func zstdSeekable(raw []byte, level int, dictID uint32, frameSize int) ([]byte, uint32) {
+	// one encoder, so all frames use the same dictionary
+	enc, dictID := zstdEncoderFor(level, dictID)
+	out := make([]byte, 0, len(raw)/2+64)
+	var table []byte
+	frames := 0
+	for off := 0; off < len(raw); off += frameSize {
+		chunk := raw[off:min(off+frameSize, len(raw))]
+		n := len(out)
+		out = enc.EncodeAll(chunk, out)
+		table = binary.LittleEndian.AppendUint32(table, uint32(len(out)-n))
+		table = binary.LittleEndian.AppendUint32(table, uint32(len(chunk)))
+		table = binary.LittleEndian.AppendUint32(table, uint32(GetXxhash(chunk)))
+		frames++
+	}
+
+	out = binary.LittleEndian.AppendUint32(out, seekTableMagic)
+	out = binary.LittleEndian.AppendUint32(out, uint32(len(table)+seekTableFooter))
+	out = append(out, table...)
+	out = binary.LittleEndian.AppendUint32(out, uint32(frames))
+	out = append(out, seekTableChecksums)
+	return binary.LittleEndian.AppendUint32(out, seekableMagic), dictID
+}
+
+// seekTableLen reads the footer of a seek table, it returns the number of
+// frames and the length of the table without its skippable frame header.
+func seekTableLen(footer []byte) (n, tableLen int, sums bool, err error) {
+	bad := NewError("invalid seek table")
+	if len(footer) != seekTableFooter || binary.LittleEndian.Uint32(footer[5:9]) != seekableMagic || footer[4]&^seekTableChecksums != 0 {
+		return 0, 0, false, bad
+	}
+	sums = footer[4]&seekTableChecksums != 0
+	entrySize := seekTableEntry
+	if sums {
+		entrySize = seekTableEntrySum
+	}
+	n = int(binary.LittleEndian.Uint32(footer[0:4]))
+	if n <= 0 || n > 1<<24 {
+		return 0, 0, false, bad
+	}
+	return n, n*entrySize + seekTableFooter, sums, nil
+}
+
+// parseSeekTable returns the frames of a seekable payload of size bytes,
+// tail is the end of it holding at least the seek table. sums is false for
+// a table without checksums.
+func parseSeekTable(tail []byte, size uint64) (frames []seekFrame, sums bool, err error) {
+	bad := NewError("invalid seek table")
+	if len(tail) < seekTableFooter || uint64(len(tail)) > size {
+		return nil, false, bad
+	}
+	n, tableLen, sums, err := seekTableLen(tail[len(tail)-seekTableFooter:])
+	if err != nil {
+		return nil, false, err
+	}
+	if tableLen > len(tail) || uint64(tableLen+skippableHeadSize) > size {
+		return nil, false, bad
+	}
+	entrySize := (tableLen - seekTableFooter) / n
+	entries := tail[len(tail)-tableLen:]
+
+	frames = make([]seekFrame, n)
+	var raw, z uint64
+	for i := range frames {
+		e := entries[i*entrySize:]
+		frames[i] = seekFrame{
+			rawOffset: raw,
+			rawSize:   uint64(binary.LittleEndian.Uint32(e[4:8])),
+			zOffset:   z,
+			zSize:     uint64(binary.LittleEndian.Uint32(e[0:4])),
+		}
+		if sums {
+			frames[i].checksum = binary.LittleEndian.Uint32(e[8:12])
+		}
+		raw += frames[i].rawSize
+		z += frames[i].zSize
+	}
+	if z+uint64(tableLen+skippableHeadSize) != size {
+		return nil, false, bad
+	}
+	return frames, sums, nil
+}
+
+// readSeekTable reads the seek table of a seekable payload of size bytes,
+// read returns n bytes of the payload at off.
+func readSeekTable(size uint64, read func(off, n uint64) ([]byte, error)) ([]seekFrame, bool, error) {
+	if size < skippableHeadSize+seekTableFooter {
+		return nil, false, NewError("invalid seek table")
+	}
+	footer, err := read(size-seekTableFooter, seekTableFooter)
+	if err != nil {
+		return nil, false, err
+	}
+	_, tableLen, _, err := seekTableLen(footer)
+	if err != nil {
+		return nil, false, err
+	}
+	if uint64(tableLen) > size {
+		return nil, false, NewError("invalid seek table")
+	}
+	tail, err := read(size-uint64(tableLen), uint64(tableLen))
+	if err != nil {
+		return nil, false, err
+	}
+	return parseSeekTable(tail, size)
+}
+
+// readFrames decodes the frames holding [offset, offset+length) and checks
+// them, read returns n compressed bytes at off. It returns the range and
+// the length of the whole value.
+func readFrames(dictID uint32, frames []seekFrame, sums bool, offset, length uint64, read func(off, n uint64) ([]byte, error)) ([]byte, uint64, error) {
+	last := frames[len(frames)-1]
+	total := last.rawOffset + last.rawSize
+	end, err := rangeEnd(offset, length, total)
+	if err != nil {
+		return nil, total, err
+	}
+
+	dec, err := getZstdDecoder(dictID)
+	if err != nil {
+		return nil, total, err
+	}
+	// first frame ending after offset, and the one after the last needed
+	i := sort.Search(len(frames), func(i int) bool {
+		return frames[i].rawOffset+frames[i].rawSize > offset
+	})
+	j := i
+	for j < len(frames) && frames[j].rawOffset < end {
+		j++
+	}
+	z0 := frames[i].zOffset
+	z, err := read(z0, frames[j-1].zOffset+frames[j-1].zSize-z0)
+	if err != nil {
+		return nil, total, err
+	}
+
+	start := frames[i].rawOffset
+	buf := make([]byte, 0, end-start)
+	for ; i < j; i++ {
+		f := frames[i]
+		n := len(buf)
+		buf, err = dec.DecodeAll(z[f.zOffset-z0:f.zOffset-z0+f.zSize], buf)
+		if err != nil {
+			return nil, total, err
+		}
+		if uint64(len(buf)-n) != f.rawSize || (sums && uint32(GetXxhash(buf[n:])) != f.checksum) {
+			return nil, total, NewError("seekable frame " + Int2Str(i) + " is corrupt")
+		}
+	}
+	return buf[offset-start : end-start], total, nil
+}
+
+// ReadRange returns up to length bytes of a stored value from offset,
+// length 0 means to the end, and the length of the whole value. Seekable
+// values and values stored without compression are not decoded in full,
+// nor read in full from the file of a blob.
+func ReadRange(stored []byte, offset, length uint64) (out []byte, total uint64, err error) {
+	h, payload, ok, err := openValue(stored)
+	if err != nil {
+		return nil, 0, err
+	}
+	if ok && h.Codec == CodecBlob {
+		return readBlobRange(payload, offset, length)
+	}
+	if ok && h.Codec == CodecS3 {
+		b, err := loadS3(appCtx, payload)
+		if err != nil {
+			return nil, 0, err
+		}
+		return ReadRange(b, offset, length)
+	}
+
+	if ok && h.Codec == CodecZstd && h.Flags&flagSeekable != 0 {
+		frames, sums, err := parseSeekTable(payload, uint64(len(payload)))
+		if err != nil {
+			return nil, 0, err
+		}
+		return readFrames(h.DictID, frames, sums, offset, length, func(off, n uint64) ([]byte, error) {
+			return payload[off : off+n], nil
+		})
+	}
+
+	var raw []byte
+	if ok && h.Codec == CodecNone {
+		raw = payload
+	} else if raw, err = UnZstdBytes(stored); err != nil {
+		return nil, 0, err
+	}
+	total = uint64(len(raw))
+	end, err := rangeEnd(offset, length, total)
+	if err != nil {
+		return nil, total, err
+	}
+	// raw may point into badger's buffer
+	return bytes.Clone(raw[offset:end]), total, nil
+}
+
+var ErrRangeNotSatisfiable = NewError("range not satisfiable")
+
+func rangeEnd(offset, length, total uint64) (uint64, error) {
+	if offset >= total {
+		return 0, ErrRangeNotSatisfiable
+	}
+	if length == 0 || length > total-offset {
+		return total, nil
+	}
+	return offset + length, nil
+}
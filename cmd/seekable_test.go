@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+func TestReadRange(t *testing.T) {
+	openTestDB(t, func(s *Settings) {
+		s.SeekableFrameKB = 4
+	})
+	raw := []byte(fmt.Sprintf("%0100000d", 42))
+	for i := 0; i < len(raw); i += 7 {
+		raw[i] = byte('a' + i%26)
+	}
+
+	values := []struct {
+		name   string
+		policy CompressionPolicy
+	}{
+		{"none", CompressionPolicy{Codec: CodecNone}},
+		{"seekable", CompressionPolicy{Codec: CodecZstd}},
+	}
+	ranges := []struct {
+		offset, length uint64
+		err            error
+	}{
+		{0, 0, nil},
+		{0, 10, nil},
+		{4090, 20, nil},
+		{8192, 4096, nil},
+		{99990, 100, nil},
+		{uint64(len(raw)), 1, ErrRangeNotSatisfiable},
+	}
+	for _, v := range values {
+		stored := EncodeValue(raw, v.policy)
+		h, _, _ := parseValueHeader(stored)
+		if seekable := h.Flags&flagSeekable != 0; seekable != (v.policy.Codec == CodecZstd) {
+			t.Fatalf("%s: seekable is %v", v.name, seekable)
+		}
+		for _, r := range ranges {
+			t.Run(fmt.Sprintf("%s/%d+%d", v.name, r.offset, r.length), func(t *testing.T) {
+				got, total, err := ReadRange(stored, r.offset, r.length)
+				if err != r.err {
+					t.Fatalf("err %v, want %v", err, r.err)
+				}
+				if total != uint64(len(raw)) {
+					t.Errorf("total %d, want %d", total, len(raw))
+				}
+				if err != nil {
+					return
+				}
+				end, _ := rangeEnd(r.offset, r.length, total)
+				if !bytes.Equal(got, raw[r.offset:end]) {
+					t.Errorf("got %d bytes, not the range", len(got))
+				}
+			})
+		}
+	}
+}
+
+func TestReadRangeChecksum(t *testing.T) {
+	openTestDB(t, func(s *Settings) {
+		s.SeekableFrameKB = 4
+	})
+	raw := bytes.Repeat([]byte("0123456789abcdef"), 1024)
+	stored := EncodeValue(raw, CompressionPolicy{Codec: CodecZstd})
+	_, payload, _ := parseValueHeader(stored)
+	frames, sums, err := parseSeekTable(payload, uint64(len(payload)))
+	if err != nil || !sums || len(frames) != 4 {
+		t.Fatalf("%d frames, checksums %v: %v", len(frames), sums, err)
+	}
+
+	// the checksum is the last 4 bytes of an entry
+	table := len(payload) - seekTableFooter - len(frames)*seekTableEntrySum
+	payload[table+seekTableEntrySum+8] ^= 0xff
+	if _, _, err := ReadRange(stored, 0, 100); err != nil {
+		t.Errorf("frame 0: %v", err)
+	}
+	if _, _, err := ReadRange(stored, 5000, 100); err == nil {
+		t.Error("frame 1 read with a wrong checksum")
+	}
+}
@@ -0,0 +1,152 @@
+package cmd
+
+import (
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+
+	badger "github.com/dgraph-io/badger/v4"
+	badgeroptions "github.com/dgraph-io/badger/v4/options"
+)
+
+// Badger's options are settings (--badger-*), --badger-preset fills the
+// ones not given on the command line or in the config file. They need a
+// restart.
+var (
+	BadgerPreset             string
+	BadgerBaseTableSizeMB    int64
+	BadgerValueThreshold     int64
+	BadgerValueLogFileSizeMB int64
+	BadgerSyncWrites         bool
+	BadgerNumCompactors      int
+	BadgerBlockCompression   string
+	BadgerBlockCacheMB       int64
+	BadgerIndexCacheMB       int64
+	BadgerMemTableSizeMB     int64
+	BadgerNumMemtables       int
+)
+
+// badgerPresets by workload:
+//
+//	durable     small metadata: every commit synced, values up to 4KB in the LSM
+//	throughput  bulk files: large tables, memtables and block cache
+//	low-memory  small memtables and caches, for small machines
+var badgerPresets = map[string]map[string]string{
+	"durable": {
+		"badger-sync-writes":            "true",
+		"badger-value-threshold":        "4096",
+		"badger-base-table-size-mb":     "64",
+		"badger-value-log-file-size-mb": "1024",
+	},
+	"throughput": {
+		"badger-sync-writes":            "false",
+		"badger-value-threshold":        "32",
+		"badger-base-table-size-mb":     "256",
+		"badger-value-log-file-size-mb": "1984",
+		"badger-memtable-size-mb":       "128",
+		"badger-block-cache-mb":         "512",
+	},
+	"low-memory": {
+		"badger-base-table-size-mb":     "16",
+		"badger-value-log-file-size-mb": "256",
+		"badger-memtable-size-mb":       "16",
+		"badger-num-memtables":          "2",
+		"badger-block-cache-mb":         "16",
+		"badger-index-cache-mb":         "16",
+		"badger-num-compactors":         "2",
+	},
+}
+
+// ApplyBadgerPreset sets the values of --badger-preset and checks the
+// result, it is called once the config file is read.
+func ApplyBadgerPreset() error {
+	if BadgerPreset != "" {
+		preset, ok := badgerPresets[BadgerPreset]
+		if !ok {
+			names := make([]string, 0, len(badgerPresets))
+			for name := range badgerPresets {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			return NewError("--badger-preset must be one of " + strings.Join(names, ", "))
+		}
+		for name, v := range preset {
+			if isSettingSet(name) {
+				continue
+			}
+			if err := setFlagValue(settingsFlags.Lookup(name), v); err != nil {
+				return NewError(name + ": " + err.Error())
+			}
+		}
+	}
+	return checkBadgerOptions(badgerOptions(badgerDir()))
+}
+
+// checkBadgerOptions reports what badger.Open would refuse, or panic on.
+func checkBadgerOptions(opts badger.Options) error {
+	switch {
+	case opts.BaseTableSize <= 0:
+		return NewError("--badger-base-table-size-mb must be positive")
+	case opts.MemTableSize <= 0 || opts.NumMemtables <= 0:
+		return NewError("--badger-memtable-size-mb and --badger-num-memtables must be positive")
+	case opts.ValueThreshold < 0 || opts.ValueThreshold > 1<<20:
+		return NewError("--badger-value-threshold must be between 0 and 1048576")
+	case opts.ValueThreshold > opts.MemTableSize*15/100:
+		return NewError("--badger-value-threshold must be below 15% of --badger-memtable-size-mb")
+	case opts.ValueLogFileSize < 1<<20 || opts.ValueLogFileSize >= 2<<30:
+		return NewError("--badger-value-log-file-size-mb must be between 1 and 2047")
+	case opts.NumCompactors == 1 || opts.NumCompactors < 0:
+		return NewError("--badger-num-compactors must be 0 (auto) or at least 2")
+	case opts.BlockCacheSize < 0 || opts.IndexCacheSize < 0:
+		return NewError("--badger-block-cache-mb and --badger-index-cache-mb cannot be negative")
+	case opts.Compression != badgeroptions.None && opts.BlockCacheSize == 0:
+		return NewError("--badger-block-compression needs --badger-block-cache-mb")
+	}
+	_, err := parseBlockCompression(BadgerBlockCompression)
+	return err
+}
+
+func parseBlockCompression(s string) (badgeroptions.CompressionType, error) {
+	switch s {
+	case "", "none":
+		return badgeroptions.None, nil
+	case "snappy":
+		return badgeroptions.Snappy, nil
+	case "zstd":
+		return badgeroptions.ZSTD, nil
+	}
+	return badgeroptions.None, NewError("--badger-block-compression must be none, snappy or zstd")
+}
+
+func numCompactors() int {
+	if BadgerNumCompactors != 0 {
+		return BadgerNumCompactors
+	}
+	n := runtime.NumCPU()
+	return min(max(n, 4), 16)
+}
+
+// BadgerOptionsReport lists the options Badger runs with.
+func BadgerOptionsReport(opts badger.Options) map[string]string {
+	compression := "none"
+	switch opts.Compression {
+	case badgeroptions.Snappy:
+		compression = "snappy"
+	case badgeroptions.ZSTD:
+		compression = "zstd"
+	}
+	return map[string]string{
+		"badger.preset":              BadgerPreset,
+		"badger.base_table_size":     Int64ToString(opts.BaseTableSize),
+		"badger.value_threshold":     Int64ToString(opts.ValueThreshold),
+		"badger.value_log_file_size": Int64ToString(opts.ValueLogFileSize),
+		"badger.sync_writes":         strconv.FormatBool(opts.SyncWrites),
+		"badger.num_compactors":      Int2Str(opts.NumCompactors),
+		"badger.block_compression":   compression,
+		"badger.block_cache_size":    Int64ToString(opts.BlockCacheSize),
+		"badger.index_cache_size":    Int64ToString(opts.IndexCacheSize),
+		"badger.memtable_size":       Int64ToString(opts.MemTableSize),
+		"badger.num_memtables":       Int2Str(opts.NumMemtables),
+	}
+}
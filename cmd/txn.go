@@ -0,0 +1,217 @@
+package cmd
+
+import (
+	"encoding/binary"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	pb "zstdb/pbs"
+
+	badger "github.com/dgraph-io/badger/v4"
+)
+
+// txnVersionSeq names the marker of a Txn, see txnVersionKey.
+var txnVersionSeq atomic.Uint64
+
+func init() {
+	txnVersionSeq.Store(uint64(time.Now().UnixNano()))
+}
+
+// txnVersionKey is a key of its own written by a Txn, with a short TTL:
+// read after the commit its version is the commit version of the Txn,
+// which Badger does not return.
+func txnVersionKey() []byte {
+	return binary.BigEndian.AppendUint64(InternalKey("txnver/"), txnVersionSeq.Add(1))
+}
+
+// txnFailure stops a Txn, nothing of it is written.
+type txnFailure struct {
+	index   int
+	errcode int32
+	status  string
+}
+
+func (f *txnFailure) Error() string {
+	return f.status
+}
+
+// txnResult is what the rpc handler needs after the commit.
+type txnResult struct {
+	op      *pb.TxnOp
+	key     []byte
+	applied bool
+}
+
+// badgerTxn runs every op in one transaction, with the same checks as
+// Set and Delete for each of them. A *txnFailure tells which op failed.
+func badgerTxn(ops []*pb.TxnOp, so SaveOptions) ([]*pb.TxnOpResult, []txnResult, uint64, error) {
+	if len(ops) == 0 {
+		return nil, nil, 0, &txnFailure{index: -1, errcode: 400, status: "no ops"}
+	}
+
+	results := make([]*pb.TxnOpResult, len(ops))
+	done := make([]txnResult, len(ops))
+	policies := make([]CompressionPolicy, len(ops))
+	var total int64
+
+	for i, op := range ops {
+		op.Op = strings.ToLower(op.Op)
+		key := op.Key
+		fail := func(code int32, msg string) error {
+			return &txnFailure{index: i, errcode: code, status: msg}
+		}
+
+		switch op.Op {
+		case "put":
+			if cfg().IsDisableSet {
+				return nil, nil, 0, fail(501, "server disabled the set action")
+			}
+			if blocked := diskWriteBlocked(int64(len(op.Data))); blocked != "" {
+				return nil, nil, 0, fail(507, blocked)
+			}
+			if op.Data == nil {
+				return nil, nil, 0, fail(400, "val cannot be empty")
+			}
+			if int64(len(op.Data)) > cfg().MaxUploadSize {
+				return nil, nil, 0, fail(413, "val is oversized")
+			}
+			total += int64(len(op.Data))
+			if op.Sum64 != GetXxhash(op.Data) {
+				return nil, nil, 0, fail(400, "data sum64 does not match")
+			}
+			if !IsAllowUserKey {
+				key = SumBlake3(op.Data)
+			}
+			p, err := CompressionFor(key, so.Compression)
+			if err != nil {
+				return nil, nil, 0, fail(400, err.Error())
+			}
+			policies[i] = p
+		case "delete":
+			if cfg().IsDisableDelete {
+				return nil, nil, 0, fail(501, "server disabled the delete action")
+			}
+		case "check":
+		default:
+			return nil, nil, 0, fail(400, "op must be put, delete or check: "+op.Op)
+		}
+
+		if len(key) == 0 {
+			return nil, nil, 0, fail(400, "key cannot be empty")
+		}
+		if IsInternalKey(key) {
+			return nil, nil, 0, fail(400, "key is reserved")
+		}
+		done[i] = txnResult{op: op, key: key}
+		results[i] = &pb.TxnOpResult{Key: key}
+	}
+
+	// the whole txn must fit in one message anyway
+	if total > cfg().MaxUploadSize*4 {
+		return nil, nil, 0, &txnFailure{index: -1, errcode: 413, status: "txn is oversized"}
+	}
+
+	owner := OwnerID(so.Client)
+	if total > 0 && isBlobSize(int(total)) {
+		// see badgerPut
+		blobMu.RLock()
+		defer blobMu.RUnlock()
+	}
+	marker := txnVersionKey()
+	err := bgrdb.Update(func(txn *badger.Txn) error {
+		for i, op := range ops {
+			r := &done[i]
+			r.applied = false
+			switch op.Op {
+			case "check":
+				var ver uint64
+				item, err := txn.Get(r.key)
+				if err == nil {
+					ver, err = itemVersion(txn, item)
+				}
+				if err != nil && err != badger.ErrKeyNotFound {
+					return err
+				}
+				results[i].Ver64 = ver
+				if op.Exists > 0 && ver == 0 {
+					return &txnFailure{index: i, errcode: 412, status: "check failed: key does not exist"}
+				}
+				if op.Exists < 0 && ver != 0 {
+					return &txnFailure{index: i, errcode: 412, status: "check failed: key exists"}
+				}
+				if op.Ver64 != 0 && op.Ver64 != ver {
+					return &txnFailure{index: i, errcode: 412, status: "check failed: version is " + Uint64ToString(ver)}
+				}
+				results[i].Status = []byte("ok")
+			case "put":
+				sum64 := op.Sum64
+				created, err := txnPut(txn, r.key, op.Data, sum64, owner, func() ([]byte, error) {
+					return encodeStored(op.Data, policies[i], sum64, owner)
+				})
+				if err != nil {
+					return err
+				}
+				r.applied = created
+				if created {
+					results[i].Status = []byte("created")
+				} else {
+					results[i].Status = []byte("deduplicated")
+				}
+			case "delete":
+				_, found, err := txnDelete(txn, r.key)
+				if err != nil {
+					return err
+				}
+				r.applied = found
+				if found {
+					results[i].Status = []byte("deleted")
+				} else {
+					results[i].Status = []byte("not_found")
+				}
+			}
+		}
+		for _, r := range done {
+			if r.applied {
+				return txn.SetEntry(badger.NewEntry(marker, nil).WithTTL(time.Minute))
+			}
+		}
+		return nil
+	})
+	for _, r := range done {
+		if r.key != nil && r.op.Op != "check" {
+			CacheInvalidate(r.key)
+		}
+	}
+
+	switch err {
+	case nil:
+		wakeWebhooks()
+	case badger.ErrConflict:
+		return results, nil, 0, &txnFailure{index: -1, errcode: 409, status: "conflict with another write, retry the txn"}
+	case badger.ErrTxnTooBig:
+		return results, nil, 0, &txnFailure{index: -1, errcode: 413, status: "txn is too big"}
+	default:
+		return results, nil, 0, err
+	}
+
+	var ver uint64
+	for i, r := range done {
+		if !r.applied {
+			continue
+		}
+		if ver == 0 {
+			err = bgrdb.View(func(txn *badger.Txn) error {
+				item, err := txn.Get(marker)
+				if err == nil {
+					ver = item.Version()
+				}
+				return err
+			})
+			// committed anyway, only the version is missing
+			PrintError("badgerTxn", err)
+		}
+		results[i].Ver64 = ver
+	}
+	return results, done, ver, nil
+}
@@ -0,0 +1,46 @@
+package cmd
+
+import (
+	"testing"
+
+	pb "zstdb/pbs"
+)
+
+func TestTxnVersion(t *testing.T) {
+	openTestDB(t, func(s *Settings) {
+		s.IsAllowOverWrite = true
+	})
+	IsAllowUserKey = true
+	t.Cleanup(func() { IsAllowUserKey = false })
+
+	put := func(key, val string) *pb.TxnOp {
+		return &pb.TxnOp{Op: "put", Key: []byte(key), Data: []byte(val), Sum64: GetXxhash([]byte(val))}
+	}
+	tests := []struct {
+		name string
+		ops  []*pb.TxnOp
+	}{
+		{"put", []*pb.TxnOp{put("k1", "a"), put("k2", "b")}},
+		{"check and overwrite", []*pb.TxnOp{{Op: "check", Key: []byte("k1"), Exists: 1}, put("k1", "c")}},
+		{"delete", []*pb.TxnOp{{Op: "delete", Key: []byte("k2")}, put("k3", "d")}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results, _, ver, err := badgerTxn(tt.ops, SaveOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ver == 0 {
+				t.Fatal("no version")
+			}
+			for i, op := range tt.ops {
+				if op.Op == "put" {
+					if got := keyVersion(t, string(op.Key)); got != ver || results[i].Ver64 != ver {
+						t.Errorf("%s: key at %d, result %d, txn %d", op.Key, got, results[i].Ver64, ver)
+					}
+				}
+			}
+		})
+	}
+
+}
@@ -0,0 +1,458 @@
+package cmd
+
+import (
+	"encoding/binary"
+	"strings"
+
+	badger "github.com/dgraph-io/badger/v4"
+	humanize "github.com/dustin/go-humanize"
+)
+
+// Keys, stored bytes and raw bytes are counted in total, in the same
+// transaction as the Set/Delete. While --quota-namespace is set they are
+// also counted per namespace (the key up to its first "/"), while
+// --quota-client is set per client:
+//
+//	\x00zstdb/usage/total
+//	\x00zstdb/usage/ns/<namespace>
+//	\x00zstdb/usage/client/<client>
+//
+// A write reading and writing one key per counter would conflict with all
+// other writes, so each counter is split in usageShards keys and a write
+// changes the shard its key hashes to. Readers sum the shards:
+//
+//	<counter><generation:8><shard:1> => keys:8 stored bytes:8 raw bytes:8, signed
+//
+// \x00zstdb/usagegen => generation:8 scopes:1 is bumped by each Admin
+// recount, which rebuilds the counters from the keys, see recount.go. The
+// writes after the bump go to the shards of the new generation, the recount
+// stores what they did not count in shard usageBaseShard, the total's
+// last. Until it does, readers also add the generations before.
+// A shard is still read and written back in the txn of the write: two
+// writes whose keys hash to the same shard conflict, and a txn of many keys
+// (Txn, delete-prefix) touches many shards and is likely to conflict
+// under load. badgerUpdate retries, a Txn reports the conflict.
+// The owner of a value is recorded in its header, so Delete can give the
+// bytes back to the right client.
+var (
+	QuotaNamespaces []string
+	QuotaClients    []string
+
+	ErrQuotaExceeded = NewError("quota exceeded")
+)
+
+const (
+	usageShards    = 64
+	usageBaseShard = 0xff
+)
+
+// the counters kept besides the total, recorded by a recount in usagegen
+const (
+	scopeNamespace byte = 1 << iota
+	scopeClient
+)
+
+type Quota struct {
+	MaxBytes uint64
+	MaxKeys  uint64
+}
+
+type Usage struct {
+	Keys     uint64
+	Bytes    uint64
+	RawBytes uint64
+}
+
+// parseQuotas parses --quota-namespace and --quota-client, "name=10GiB:100000",
+// 0 for bytes or keys means unlimited.
+func parseQuotas(rules []string) (map[string]Quota, error) {
+	m := make(map[string]Quota)
+	for _, rule := range rules {
+		name, spec, ok := strings.Cut(rule, "=")
+		if !ok {
+			return nil, NewError("quota must be name=bytes[:keys]: " + rule)
+		}
+		sBytes, sKeys, _ := strings.Cut(spec, ":")
+		q := Quota{}
+		if sBytes != "" && sBytes != "0" {
+			b, err := humanize.ParseBytes(sBytes)
+			if err != nil {
+				return nil, NewError("quota bytes invalid: " + rule)
+			}
+			q.MaxBytes = b
+		}
+		if sKeys != "" {
+			q.MaxKeys = Str2Uint64(sKeys)
+		}
+		m[name] = q
+	}
+	return m, nil
+}
+
+// KeyNamespace is the part of key before the first "/", "" for keys
+// without one (e.g. content addressed keys).
+func KeyNamespace(key []byte) string {
+	ns, _, ok := strings.Cut(string(key), "/")
+	if !ok {
+		return ""
+	}
+	return ns
+}
+
+// OwnerID is stored in the value header instead of the client name.
+func OwnerID(client string) uint64 {
+	if client == "" {
+		return 0
+	}
+	return GetXxhash([]byte(client))
+}
+
+func usageScopes(s *Settings) byte {
+	var scopes byte
+	if len(s.namespaceQuotas) > 0 {
+		scopes |= scopeNamespace
+	}
+	if len(s.clientQuotas) > 0 {
+		scopes |= scopeClient
+	}
+	return scopes
+}
+
+func totalUsageKey() []byte {
+	return InternalKey("usage/total")
+}
+
+func namespaceUsageKey(ns string) []byte {
+	return InternalKey("usage/ns/" + ns)
+}
+
+func clientUsageKey(owner uint64) []byte {
+	return InternalKey("usage/client/" + Uint64ToString(owner))
+}
+
+func usageGenKey() []byte {
+	return InternalKey("usagegen")
+}
+
+func usageShardKey(counter []byte, gen uint64, shard byte) []byte {
+	k := binary.BigEndian.AppendUint64(append([]byte{}, counter...), gen)
+	return append(k, shard)
+}
+
+func parseUsageShardKey(k []byte) (counter []byte, gen uint64, shard byte, ok bool) {
+	if len(k) < 9 {
+		return nil, 0, 0, false
+	}
+	n := len(k) - 9
+	return k[:n], binary.BigEndian.Uint64(k[n : n+8]), k[n+8], true
+}
+
+// usageShard is the shard the writes of key go to, a Set and the Delete of
+// the value it overwrites change the same one.
+func usageShard(key []byte) byte {
+	return byte(GetXxhash(key) % usageShards)
+}
+
+// readUsageGen returns the generation and the scopes of the last recount,
+// ok is false before the first one.
+func readUsageGen(txn *badger.Txn) (gen uint64, scopes byte, ok bool, err error) {
+	item, err := txn.Get(usageGenKey())
+	if err == badger.ErrKeyNotFound {
+		return 0, 0, false, nil
+	}
+	if err != nil {
+		return 0, 0, false, err
+	}
+	err = item.Value(func(v []byte) error {
+		if len(v) >= 9 {
+			gen, scopes = binary.LittleEndian.Uint64(v[0:8]), v[8]
+		}
+		return nil
+	})
+	return gen, scopes, err == nil, err
+}
+
+func writeUsageGen(txn *badger.Txn, gen uint64, scopes byte) error {
+	return txn.Set(usageGenKey(), append(binary.LittleEndian.AppendUint64(nil, gen), scopes))
+}
+
+// usageDiff is a signed change of a counter, as stored in a shard.
+type usageDiff struct {
+	Keys, Bytes, RawBytes int64
+}
+
+func (d *usageDiff) add(v []byte) {
+	if len(v) >= 24 {
+		d.Keys += int64(binary.LittleEndian.Uint64(v[0:8]))
+		d.Bytes += int64(binary.LittleEndian.Uint64(v[8:16]))
+		d.RawBytes += int64(binary.LittleEndian.Uint64(v[16:24]))
+	}
+}
+
+func (d usageDiff) encode() []byte {
+	b := binary.LittleEndian.AppendUint64(nil, uint64(d.Keys))
+	b = binary.LittleEndian.AppendUint64(b, uint64(d.Bytes))
+	return binary.LittleEndian.AppendUint64(b, uint64(d.RawBytes))
+}
+
+func (d usageDiff) usage() Usage {
+	return addUsage(Usage{}, d.Keys, d.Bytes, d.RawBytes)
+}
+
+// readDiff adds the shard at k to d, a missing one is zero.
+func readDiff(txn *badger.Txn, k []byte, d *usageDiff) error {
+	item, err := txn.Get(k)
+	if err == badger.ErrKeyNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return item.Value(func(v []byte) error {
+		d.add(v)
+		return nil
+	})
+}
+
+// usageGenDone tells if the recount that started generation gen stored its
+// base, the total has one then.
+func usageGenDone(txn *badger.Txn, gen uint64) (bool, error) {
+	_, err := txn.Get(usageShardKey(totalUsageKey(), gen, usageBaseShard))
+	if err == badger.ErrKeyNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// sumCounter adds the shards of counter k from generation gen back to the
+// one whose recount finished, leaving out shard skip of gen (-1 for none).
+// ok is false when no recount finished, the writes before the first one
+// are in generation 0.
+func sumCounter(txn *badger.Txn, k []byte, gen uint64, skip int) (d usageDiff, ok bool, err error) {
+	for g := gen; ; g-- {
+		for shard := 0; shard < usageShards; shard++ {
+			if g == gen && shard == skip {
+				continue
+			}
+			if err = readDiff(txn, usageShardKey(k, g, byte(shard)), &d); err != nil {
+				return d, false, err
+			}
+		}
+		// the recount writes the bases of the other counters first
+		if ok, err = usageGenDone(txn, g); ok && err == nil {
+			err = readDiff(txn, usageShardKey(k, g, usageBaseShard), &d)
+		}
+		if ok || err != nil || g == 0 {
+			return d, ok, err
+		}
+	}
+}
+
+// readCounter is counter k, ok is false before the first recount finished.
+func readCounter(txn *badger.Txn, k []byte) (Usage, bool, error) {
+	gen, _, _, err := readUsageGen(txn)
+	if err != nil {
+		return Usage{}, false, err
+	}
+	d, ok, err := sumCounter(txn, k, gen, -1)
+	return d.usage(), ok, err
+}
+
+// readCounters reads every counter, by the name after "usage/".
+func readCounters(txn *badger.Txn) (map[string]Usage, error) {
+	m := make(map[string]Usage)
+	gen, _, _, err := readUsageGen(txn)
+	if err != nil {
+		return m, err
+	}
+	first := gen
+	for ; first > 0; first-- {
+		done, err := usageGenDone(txn, first)
+		if err != nil {
+			return m, err
+		}
+		if done {
+			break
+		}
+	}
+
+	diffs := make(map[string]*usageDiff)
+	prefix := InternalKey("usage/")
+	opts := badger.DefaultIteratorOptions
+	opts.Prefix = prefix
+	it := txn.NewIterator(opts)
+	defer it.Close()
+	for it.Rewind(); it.Valid(); it.Next() {
+		counter, g, shard, ok := parseUsageShardKey(it.Item().Key())
+		if !ok || g < first || g > gen || len(counter) < len(prefix) || (shard == usageBaseShard && g != first) {
+			continue
+		}
+		name := string(counter[len(prefix):])
+		if diffs[name] == nil {
+			diffs[name] = &usageDiff{}
+		}
+		if err := it.Item().Value(func(v []byte) error { diffs[name].add(v); return nil }); err != nil {
+			return m, err
+		}
+	}
+	for name, d := range diffs {
+		m[name] = d.usage()
+	}
+	return m, nil
+}
+
+// addUsageShard adds a change to shard of counter k in generation gen.
+func addUsageShard(txn *badger.Txn, k []byte, gen uint64, shard byte, dKeys, dBytes, dRaw int64) error {
+	sk := usageShardKey(k, gen, shard)
+	var d usageDiff
+	if err := readDiff(txn, sk, &d); err != nil {
+		return err
+	}
+	d.Keys += dKeys
+	d.Bytes += dBytes
+	d.RawBytes += dRaw
+	return txn.Set(sk, d.encode())
+}
+
+func addUsage(u Usage, dKeys, dBytes, dRaw int64) Usage {
+	u.Keys = addDelta(u.Keys, dKeys)
+	u.Bytes = addDelta(u.Bytes, dBytes)
+	u.RawBytes = addDelta(u.RawBytes, dRaw)
+	return u
+}
+
+// valueSizes returns the header, the stored and the raw length of a stored
+// value, values written before the header had the raw length are counted
+// as stored. The file of a blob is part of its stored length, a value moved
+// to S3 counts the object only.
+func valueSizes(v []byte) (h valueHeader, stored, raw uint64) {
+	h, payload, _ := parseValueHeader(v)
+	stored, raw = uint64(len(v)), h.RawLen
+	switch h.Codec {
+	case CodecBlob:
+		size, _, _ := parseBlobPointer(payload)
+		stored += size
+	case CodecS3:
+		stored, _, _ = parseS3Stub(payload)
+	}
+	if raw == 0 {
+		raw = stored
+	}
+	return h, stored, raw
+}
+
+func addDelta(v uint64, d int64) uint64 {
+	if d < 0 && uint64(-d) > v {
+		return 0
+	}
+	return uint64(int64(v) + d)
+}
+
+// usageDelta applies a change of keys/bytes to the total, and with quotas
+// to the namespace of key and the owner, checking the quotas when they
+// grow. It runs inside txn; the generation it reads makes a recount in
+// between a conflict.
+func usageDelta(txn *badger.Txn, key []byte, owner uint64, dKeys, dBytes, dRaw int64) error {
+	s := cfg()
+	gen, _, _, err := readUsageGen(txn)
+	if err != nil {
+		return err
+	}
+	shard := usageShard(key)
+
+	if err = addUsageShard(txn, totalUsageKey(), gen, shard, dKeys, dBytes, dRaw); err != nil {
+		return err
+	}
+
+	grows := dKeys > 0 || dBytes > 0
+	if len(s.namespaceQuotas) > 0 {
+		ns := KeyNamespace(key)
+		k := namespaceUsageKey(ns)
+		if err = addUsageShard(txn, k, gen, shard, dKeys, dBytes, dRaw); err != nil {
+			return err
+		}
+		if q, ok := s.namespaceQuotas[ns]; ok && grows {
+			if err = checkQuota(txn, k, gen, shard, q); err != nil {
+				return err
+			}
+		}
+	}
+
+	if owner == 0 || len(s.clientQuotas) == 0 {
+		return nil
+	}
+	k := clientUsageKey(owner)
+	if err = addUsageShard(txn, k, gen, shard, dKeys, dBytes, dRaw); err != nil {
+		return err
+	}
+	for name, q := range s.clientQuotas {
+		if OwnerID(name) == owner && grows {
+			return checkQuota(txn, k, gen, shard, q)
+		}
+	}
+	return nil
+}
+
+// checkQuota reads the shard of this write from txn, with the delta just
+// added, and the other shards of counter k from a snapshot of their own:
+// reading them in txn would make all writes to a namespace conflict.
+// Writes not committed yet are not seen, concurrent ones can go a little
+// over.
+func checkQuota(txn *badger.Txn, k []byte, gen uint64, shard byte, q Quota) error {
+	var d usageDiff
+	if err := readDiff(txn, usageShardKey(k, gen, shard), &d); err != nil {
+		return err
+	}
+	err := bgrdb.View(func(view *badger.Txn) error {
+		others, _, err := sumCounter(view, k, gen, int(shard))
+		d.Keys += others.Keys
+		d.Bytes += others.Bytes
+		d.RawBytes += others.RawBytes
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if q.isExceeded(d.usage()) {
+		return ErrQuotaExceeded
+	}
+	return nil
+}
+
+func (q Quota) isExceeded(u Usage) bool {
+	return (q.MaxBytes > 0 && u.Bytes > q.MaxBytes) || (q.MaxKeys > 0 && u.Keys > q.MaxKeys)
+}
+
+// UsageReport lists namespace and client usage with their quotas, for Admin usage.
+func UsageReport() map[string]string {
+	m := make(map[string]string)
+	s := cfg()
+	names := make(map[uint64]string)
+	for name := range s.clientQuotas {
+		names[OwnerID(name)] = name
+	}
+
+	err := bgrdb.View(func(txn *badger.Txn) error {
+		counters, err := readCounters(txn)
+		for k, u := range counters {
+			if strings.HasPrefix(k, "client/") {
+				if name, ok := names[Str2Uint64(strings.TrimPrefix(k, "client/"))]; ok {
+					k = "client/" + name
+				}
+			}
+			m[k] = strings.Join([]string{Uint64ToString(u.Keys), Uint64ToString(u.Bytes), Uint64ToString(u.RawBytes)}, ":")
+		}
+		return err
+	})
+	if err != nil {
+		PrintError("UsageReport", err)
+	}
+
+	for name, q := range s.namespaceQuotas {
+		m["quota/ns/"+name] = strings.Join([]string{Uint64ToString(q.MaxKeys), Uint64ToString(q.MaxBytes)}, ":")
+	}
+	for name, q := range s.clientQuotas {
+		m["quota/client/"+name] = strings.Join([]string{Uint64ToString(q.MaxKeys), Uint64ToString(q.MaxBytes)}, ":")
+	}
+	return m
+}
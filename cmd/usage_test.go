@@ -0,0 +1,297 @@
+package cmd
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	badger "github.com/dgraph-io/badger/v4"
+)
+
+func TestUsageCountersConcurrent(t *testing.T) {
+	openTestDB(t, func(s *Settings) {
+		s.IsAllowOverWrite = true
+		s.namespaceQuotas = map[string]Quota{"a": {MaxKeys: 1 << 20}}
+		s.clientQuotas = map[string]Quota{"c1": {}}
+	})
+
+	const workers, perWorker = 32, 100
+	var wg sync.WaitGroup
+	errs := make(chan error, workers*perWorker)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < perWorker; i++ {
+				val := []byte(fmt.Sprintf("value %d/%d", w, i))
+				ns := []string{"a", "b"}[i%2]
+				key := []byte(fmt.Sprintf("%s/%d/%d", ns, w, i))
+				if _, err := badgerPut(key, val, GetXxhash(val), SaveOptions{Client: "c1"}); err != nil {
+					errs <- err
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+
+	if u := readTestCounter(t, totalUsageKey()); u.Keys != workers*perWorker {
+		t.Errorf("total has %d keys", u.Keys)
+	}
+	if u := readTestCounter(t, namespaceUsageKey("a")); u.Keys != workers*perWorker/2 {
+		t.Errorf("ns/a has %d keys", u.Keys)
+	}
+	if u := readTestCounter(t, clientUsageKey(OwnerID("c1"))); u.Keys != workers*perWorker {
+		t.Errorf("client has %d keys", u.Keys)
+	}
+}
+
+// Writes and deletes to one namespace, their shards conflict and are
+// retried.
+func TestUsageOneNamespace(t *testing.T) {
+	openTestDB(t, func(s *Settings) {
+		s.namespaceQuotas = map[string]Quota{"a": {MaxKeys: 1 << 20}}
+	})
+
+	const workers, perWorker = 32, 100
+	var wg sync.WaitGroup
+	errs := make(chan error, workers*perWorker)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < perWorker; i++ {
+				key := []byte(fmt.Sprintf("a/%d/%d", w, i))
+				val := []byte(fmt.Sprintf("value %d/%d", w, i))
+				if _, err := badgerPut(key, val, GetXxhash(val), SaveOptions{}); err != nil {
+					errs <- err
+				}
+				if i%4 != 0 {
+					continue
+				}
+				if _, _, err := badgerDelete(key); err != nil {
+					errs <- err
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+
+	const want = workers * perWorker * 3 / 4
+	if u := readTestCounter(t, namespaceUsageKey("a")); u.Keys != want {
+		t.Errorf("ns/a has %d keys, want %d", u.Keys, want)
+	}
+	if n := badgerCount("a/"); n != want {
+		t.Errorf("Count is %d, want %d", n, want)
+	}
+}
+
+func TestRecountWithWrites(t *testing.T) {
+	openTestDB(t, func(s *Settings) {
+		s.namespaceQuotas = map[string]Quota{"a": {}}
+	})
+	put := func(key string) {
+		val := []byte(key)
+		if _, err := badgerPut([]byte(key), val, GetXxhash(val), SaveOptions{}); err != nil {
+			t.Error(err)
+		}
+	}
+	for i := 0; i < 500; i++ {
+		put(fmt.Sprintf("a/%d", i))
+	}
+	// counters written wrong on purpose, the recount replaces them
+	err := bgrdb.Update(func(txn *badger.Txn) error {
+		return addUsageShard(txn, totalUsageKey(), 0, 0, 12345, 0, 0)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	written := 500
+	go func() {
+		defer wg.Done()
+		for ; ; written++ {
+			select {
+			case <-stop:
+				return
+			default:
+				put(fmt.Sprintf("a/%d", written))
+			}
+		}
+	}()
+	done := StartRecount().Wait(time.Minute)
+	close(stop)
+	wg.Wait()
+	if done.State != JobDone {
+		t.Fatalf("recount %s: %s", done.State, done.Error)
+	}
+
+	total, ok := TotalUsage()
+	if !ok || total.Keys != uint64(written) {
+		t.Errorf("total has %d keys (ok=%v), %d were written", total.Keys, ok, written)
+	}
+	if u := readTestCounter(t, namespaceUsageKey("a")); u.Keys != uint64(written) {
+		t.Errorf("ns/a has %d keys, %d were written", u.Keys, written)
+	}
+	if n := badgerCount(""); n != uint64(written) {
+		t.Errorf("Count is %d, %d were written", n, written)
+	}
+}
+
+// More bases and references than one txn holds.
+func TestRecountManyKeys(t *testing.T) {
+	openTestDB(t, func(s *Settings) {
+		s.namespaceQuotas = map[string]Quota{"n0": {}}
+	})
+	db, err := badger.Open(badger.DefaultOptions("").WithInMemory(true).WithLogger(nil).
+		WithMemTableSize(1 << 20).WithValueThreshold(1 << 10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	prevDB := bgrdb
+	bgrdb = db
+	t.Cleanup(func() {
+		db.Close()
+		bgrdb = prevDB
+	})
+
+	// each key in a namespace of its own, pointing to a blob of its own
+	const n = 20000
+	wb := db.NewWriteBatch()
+	for i := 0; i < n; i++ {
+		hash := fmt.Sprintf("%064x", i)
+		h := valueHeader{Codec: CodecBlob, Flags: flagMeta, RawLen: 1 << 20}
+		v := binary.LittleEndian.AppendUint64(h.AppendTo(nil), 1<<20)
+		if err = wb.Set([]byte(fmt.Sprintf("n%d/k", i)), append(v, hash...)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = wb.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	err = db.Update(func(txn *badger.Txn) error {
+		for i := 0; i < n; i++ {
+			if err := txn.Set([]byte(fmt.Sprintf("x%d", i)), nil); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != badger.ErrTxnTooBig {
+		t.Fatalf("a txn of %d keys: %v", n, err)
+	}
+
+	done := StartRecount().Wait(time.Minute)
+	if done.State != JobDone || done.Keys != n {
+		t.Fatalf("recount %s with %d keys: %s", done.State, done.Keys, done.Error)
+	}
+	if total, ok := TotalUsage(); !ok || total.Keys != n {
+		t.Errorf("total has %d keys (ok=%v)", total.Keys, ok)
+	}
+	if u := readTestCounter(t, namespaceUsageKey("n123")); u.Keys != 1 {
+		t.Errorf("ns/n123 has %d keys", u.Keys)
+	}
+	var refs int
+	err = db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.IteratorOptions{Prefix: InternalKey("blobref/")})
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			if err := it.Item().Value(func(v []byte) error {
+				if binary.LittleEndian.Uint64(v) == 1 {
+					refs++
+				}
+				return nil
+			}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if refs != n {
+		t.Errorf("%d references of 1, want %d", refs, n)
+	}
+}
+
+func TestUsageQuota(t *testing.T) {
+	tests := []struct {
+		name   string
+		quota  Quota
+		writes int
+		want   int
+	}{
+		{"keys", Quota{MaxKeys: 3}, 5, 3},
+		{"bytes", Quota{MaxBytes: 300}, 5, 2},
+		{"unlimited", Quota{}, 5, 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			openTestDB(t, func(s *Settings) {
+				s.namespaceQuotas = map[string]Quota{"q": tt.quota}
+			})
+			ok := 0
+			for i := 0; i < tt.writes; i++ {
+				val := []byte(fmt.Sprintf("%080d", i))
+				_, err := badgerPut([]byte(fmt.Sprintf("q/%d", i)), val, GetXxhash(val), SaveOptions{Compression: "none"})
+				switch err {
+				case nil:
+					ok++
+				case ErrQuotaExceeded:
+				default:
+					t.Fatal(err)
+				}
+			}
+			if ok != tt.want {
+				t.Errorf("%d writes passed, want %d", ok, tt.want)
+			}
+		})
+	}
+}
+
+func TestUsageScopes(t *testing.T) {
+	openTestDB(t, nil)
+	val := []byte("v")
+	if _, err := badgerPut([]byte("a/1"), val, GetXxhash(val), SaveOptions{Client: "c1"}); err != nil {
+		t.Fatal(err)
+	}
+	err := bgrdb.View(func(txn *badger.Txn) error {
+		counters, err := readCounters(txn)
+		for name := range counters {
+			if name != "total" {
+				t.Errorf("counter %s without quotas", name)
+			}
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readTestCounter(t *testing.T, k []byte) Usage {
+	t.Helper()
+	var u Usage
+	err := bgrdb.View(func(txn *badger.Txn) error {
+		var err error
+		u, _, err = readCounter(txn, k)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
@@ -15,7 +15,6 @@ import (
 	"time"
 
 	"github.com/cespare/xxhash/v2"
-	"github.com/klauspost/compress/zstd"
 	"github.com/zeebo/blake3"
 )
 
@@ -36,13 +35,75 @@ func UnixFormat(t int64, format string) string {
 }
 
 func ZstdBytes(rawin []byte) []byte {
-	enc, _ := zstd.NewWriter(nil)
-	return enc.EncodeAll(rawin, nil)
+	return ZstdBytesLevel(rawin, 0)
 }
 
+// ZstdBytesLevel compresses with a zstd level (1~22), 0 means the default level.
+func ZstdBytesLevel(rawin []byte, level int) []byte {
+	return ZstdBytesDict(rawin, level, 0)
+}
+
+// ZstdBytesDict compresses with a trained dictionary, see TrainDict.
+func ZstdBytesDict(rawin []byte, level int, dictID uint32) []byte {
+	z, _ := zstdBytesDict(rawin, level, dictID)
+	return z
+}
+
+// zstdBytesDict is ZstdBytesDict which also returns the dictionary used, 0
+// if dictID is not loaded and rawin was compressed without one.
+func zstdBytesDict(rawin []byte, level int, dictID uint32) ([]byte, uint32) {
+	enc, dictID := zstdEncoderFor(level, dictID)
+	return enc.EncodeAll(rawin, make([]byte, 0, len(rawin)/2+64)), dictID
+}
+
+// UnZstdBytes decodes a stored value, the header written by EncodeValue
+// tells how; values without a header are plain zstd frames.
 func UnZstdBytes(zin []byte) (out []byte, err error) {
-	dec, _ := zstd.NewReader(nil)
-	out, err = dec.DecodeAll(zin, nil)
+	var dictID uint32
+	var dst []byte
+	h, payload, ok, err := openValue(zin)
+	if err != nil {
+		PrintError("UnZstdBytes", err)
+		return nil, err
+	}
+	if ok {
+		switch h.Codec {
+		case CodecNone:
+			return payload, nil
+		case CodecBlob:
+			b, err := loadBlob(payload)
+			if err != nil {
+				PrintError("UnZstdBytes", err)
+				return nil, err
+			}
+			return UnZstdBytes(b)
+		case CodecS3:
+			b, err := loadS3(appCtx, payload)
+			if err != nil {
+				PrintError("UnZstdBytes", err)
+				return nil, err
+			}
+			return UnZstdBytes(b)
+		case CodecZstd:
+			zin = payload
+			dictID = h.DictID
+			// the header is not trusted with more than an upload can be
+			if h.Flags&flagMeta != 0 && h.RawLen <= uint64(cfg().MaxUploadSize) {
+				dst = make([]byte, 0, h.RawLen)
+			}
+		default:
+			err = NewError("unknown codec: " + Int2Str(int(h.Codec)))
+			PrintError("UnZstdBytes", err)
+			return nil, err
+		}
+	}
+
+	dec, err := getZstdDecoder(dictID)
+	if err != nil {
+		PrintError("UnZstdBytes", err)
+		return nil, err
+	}
+	out, err = dec.DecodeAll(zin, dst)
 	if err != nil {
 		PrintError("UnZstdBytes:DecodeAll", err)
 		return nil, err
@@ -293,7 +354,7 @@ func SaveCurrentAddr() {
 }
 
 func AutoBackup() error {
-	curFile := filepath.ToSlash(filepath.Join(AutoBackupDir, "ver"))
+	curFile := filepath.ToSlash(filepath.Join(cfg().AutoBackupDir, "ver"))
 	lastVersion := uint64(0)
 
 	t := ReadFile(curFile)
@@ -312,7 +373,7 @@ func AutoBackup() error {
 	}
 
 	bName := strings.Join([]string{"backup_", time.Now().Format("2006-01-02")}, "")
-	backFile := filepath.ToSlash(filepath.Join(AutoBackupDir, bName))
+	backFile := filepath.ToSlash(filepath.Join(cfg().AutoBackupDir, bName))
 
 	DebugInfo("AutoBackup", "start autobackup", backFile)
 
@@ -333,38 +394,3 @@ func RemoveFile(fpath string) error {
 	}
 	return nil
 }
-
-func WatchDiskFreeSpace() error {
-	var cmdMinFreeDiskSpaceMB uint64 = MinFreeDiskSpaceMB
-	if cmdMinFreeDiskSpaceMB < 512 {
-		cmdMinFreeDiskSpaceMB = 512
-	}
-
-	var minFreeSpace uint64 = cmdMinFreeDiskSpaceMB << 20
-
-	freeSpace := uint64(0)
-	absDataDir, err := filepath.Abs(DataDir)
-	if err != nil {
-		DebugInfo("WatchDiskFreeSpace: ERROR", err)
-		return err
-	}
-	absDataDir = filepath.ToSlash(absDataDir)
-	if absDataDir != "" {
-		freeSpace = DiskFree(absDataDir)
-		//DebugInfo("Current freespace(MB)", (freeSpace >> 20), ", (≈", (freeSpace >> 30), "GB)")
-		//DebugInfo("Current threshold(MB)", (minFreeSpace >> 20))
-	}
-
-	if freeSpace > 0 && freeSpace < minFreeSpace {
-		IsDisableSet = true
-		DebugInfo("Current IsDisableSet", IsDisableSet)
-	} else {
-		IsDisableSet = false
-	}
-
-	if IsDisableSet == true {
-		DebugInfo("zstdb [SET] action had been DISABLED, new data cannot be saved.")
-		DebugInfo("Because of the Free Disk Space < ", minFreeSpace)
-	}
-	return nil
-}
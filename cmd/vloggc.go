@@ -0,0 +1,332 @@
+package cmd
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	badger "github.com/dgraph-io/badger/v4"
+)
+
+// The value log GC rewrites value log files whose share of stale data is
+// above --gc-discard-ratio. It runs every --gc-interval, only within
+// --gc-windows and not while the server handles more than --gc-busy-rps
+// requests. When the free space falls below the soft watermark it runs
+// every minute, with --gc-pressure-discard-ratio, at any time.
+var (
+	GCInterval             time.Duration
+	GCDiscardRatio         float64
+	GCPressureDiscardRatio float64
+	GCWindows              string
+	GCBusyRPS              float64
+
+	gcRunning atomic.Bool
+	rpcCalls  atomic.Uint64
+)
+
+const (
+	maxGCRuns = 100
+
+	GCSchedule = "schedule"
+	GCPressure = "pressure"
+	GCAdmin    = "admin"
+)
+
+// GCRun is one run of the value log GC, as Admin gc-runs lists it.
+// Reclaimed is the size of the value log files the run rewrote, a file
+// Badger keeps for an open iterator until after the run is not counted.
+type GCRun struct {
+	Started      time.Time `json:"started"`
+	Trigger      string    `json:"trigger"`
+	DiscardRatio float64   `json:"discard_ratio"`
+	Files        int       `json:"files"`
+	Reclaimed    int64     `json:"reclaimed"`
+	Duration     string    `json:"duration"`
+	Stopped      string    `json:"stopped,omitempty"`
+	Error        string    `json:"error,omitempty"`
+}
+
+type gcWindow struct {
+	from, to int // minutes of the day
+}
+
+func gcRunKey(t time.Time) []byte {
+	return binary.BigEndian.AppendUint64(InternalKey("gc/"), uint64(t.UnixNano()))
+}
+
+// checkGCSettings returns the parsed --gc-windows.
+func checkGCSettings(ratio, pressureRatio float64, windows string) ([]gcWindow, error) {
+	if ratio <= 0 || ratio >= 1 || pressureRatio <= 0 || pressureRatio >= 1 {
+		return nil, NewError("--gc-discard-ratio and --gc-pressure-discard-ratio must be between 0 and 1")
+	}
+	return parseGCWindows(windows)
+}
+
+// parseGCWindows reads "01:00-06:00,22:30-23:30", a window may pass midnight.
+func parseGCWindows(s string) ([]gcWindow, error) {
+	var windows []gcWindow
+	for _, w := range strings.Split(s, ",") {
+		w = strings.TrimSpace(w)
+		if w == "" {
+			continue
+		}
+		from, to, ok := strings.Cut(w, "-")
+		f, errFrom := parseClock(from)
+		t, errTo := parseClock(to)
+		if !ok || errFrom != nil || errTo != nil {
+			return nil, NewError("--gc-windows must be like 01:00-06:00,22:30-23:30: " + w)
+		}
+		windows = append(windows, gcWindow{f, t})
+	}
+	return windows, nil
+}
+
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, err
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// inGCWindow reports whether now is in one of --gc-windows, always if there
+// are none.
+func inGCWindow(now time.Time) bool {
+	windows := cfg().gcWindows
+	if len(windows) == 0 {
+		return true
+	}
+	m := now.Hour()*60 + now.Minute()
+	for _, w := range windows {
+		if w.from <= w.to && m >= w.from && m < w.to {
+			return true
+		}
+		if w.from > w.to && (m >= w.from || m < w.to) {
+			return true
+		}
+	}
+	return false
+}
+
+// diskPressure reports whether the free space is below the soft watermark.
+func diskPressure() bool {
+	return DiskState() != DiskOK
+}
+
+// rpcRate is the requests per second since the last sample.
+type rpcRate struct {
+	calls uint64
+	at    time.Time
+}
+
+func newRPCRate() *rpcRate {
+	return &rpcRate{rpcCalls.Load(), time.Now()}
+}
+
+func (r *rpcRate) next() float64 {
+	calls, now := rpcCalls.Load(), time.Now()
+	rps := float64(calls-r.calls) / max(now.Sub(r.at).Seconds(), 1)
+	r.calls, r.at = calls, now
+	return rps
+}
+
+func BadgerRunValueLogGC(ctx context.Context) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	last := time.Now()
+	rate := newRPCRate()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		s := cfg()
+		rps := rate.next()
+		now := time.Now()
+		trigger := GCSchedule
+		switch {
+		case diskPressure():
+			trigger = GCPressure
+		case s.GCInterval <= 0 || now.Sub(last) < s.GCInterval:
+			continue
+		case !inGCWindow(now):
+			continue
+		case s.GCBusyRPS > 0 && rps > s.GCBusyRPS:
+			DebugInfo("RunValueLogGC: busy, postponed, rps", rps)
+			continue
+		}
+
+		last = now
+		ratio := s.GCDiscardRatio
+		if trigger == GCPressure {
+			ratio = s.GCPressureDiscardRatio
+		}
+		if _, err := RunGC(ctx, trigger, ratio, 0); err != nil {
+			DebugInfo("RunValueLogGC", err)
+		}
+	}
+}
+
+// RunGC rewrites up to maxFiles value log files (0: all it finds), a
+// scheduled run stops once the server gets busy or the window ends. Runs
+// which rewrote a file, failed, or came from Admin are saved.
+func RunGC(ctx context.Context, trigger string, ratio float64, maxFiles int) (GCRun, error) {
+	if !gcRunning.CompareAndSwap(false, true) {
+		return GCRun{}, NewError("a value log gc is running")
+	}
+	defer gcRunning.Store(false)
+
+	run := GCRun{Started: time.Now(), Trigger: trigger, DiscardRatio: ratio}
+	// the files seen before each step, a rewritten file is removed
+	seen := make(map[string]int64)
+	rate := newRPCRate()
+	var err error
+	for {
+		for name, size := range vlogFiles() {
+			if _, ok := seen[name]; !ok {
+				seen[name] = size
+			}
+		}
+		DebugInfo("RunValueLogGC", ratio)
+		err = bgrdb.RunValueLogGC(ratio)
+		if err != nil {
+			break
+		}
+		run.Files++
+		if maxFiles > 0 && run.Files >= maxFiles {
+			break
+		}
+
+		pause := 3 * time.Second
+		if trigger == GCPressure {
+			pause = time.Second
+		}
+		select {
+		case <-ctx.Done():
+			err = ctx.Err()
+		case <-time.After(pause):
+		}
+		if err != nil {
+			break
+		}
+		if trigger == GCSchedule {
+			if rps, busy := rate.next(), cfg().GCBusyRPS; busy > 0 && rps > busy {
+				run.Stopped = "busy"
+				break
+			}
+			if !inGCWindow(time.Now()) {
+				run.Stopped = "window"
+				break
+			}
+		}
+	}
+	// no file with enough stale data is the normal end of a run
+	if errors.Is(err, badger.ErrNoRewrite) {
+		err = nil
+	}
+	if err != nil {
+		run.Error = err.Error()
+	}
+	left := vlogFiles()
+	for name, size := range seen {
+		if _, ok := left[name]; !ok {
+			run.Reclaimed += size
+		}
+	}
+	run.Duration = time.Since(run.Started).Round(time.Millisecond).String()
+
+	if run.Files > 0 || err != nil || trigger == GCAdmin {
+		PrintError("RunGC", saveGCRun(run))
+	}
+	DebugInfo("RunValueLogGC: done", run)
+	return run, err
+}
+
+// vlogFiles are the sizes of the value log files by name.
+func vlogFiles() map[string]int64 {
+	sizes := make(map[string]int64)
+	files, _ := filepath.Glob(filepath.Join(badgerDir(), "*.vlog"))
+	for _, f := range files {
+		if fi, err := os.Stat(f); err == nil {
+			sizes[filepath.Base(f)] = fi.Size()
+		}
+	}
+	return sizes
+}
+
+func saveGCRun(run GCRun) error {
+	b, err := json.Marshal(run)
+	if err != nil {
+		return err
+	}
+	return bgrdb.Update(func(txn *badger.Txn) error {
+		if err := txn.Set(gcRunKey(run.Started), b); err != nil {
+			return err
+		}
+		// keep the newest maxGCRuns
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		opts.Prefix = InternalKey("gc/")
+		opts.Reverse = true
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		var old [][]byte
+		n := 0
+		for it.Seek(append(InternalKey("gc/"), 0xff)); it.Valid(); it.Next() {
+			if n++; n > maxGCRuns {
+				old = append(old, it.Item().KeyCopy(nil))
+			}
+		}
+		for _, k := range old {
+			if err := txn.Delete(k); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// ListGCRuns lists the saved runs, the newest first.
+func ListGCRuns(limit int) ([]GCRun, error) {
+	var list []GCRun
+	err := bgrdb.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = InternalKey("gc/")
+		opts.Reverse = true
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		for it.Seek(append(InternalKey("gc/"), 0xff)); it.Valid(); it.Next() {
+			if limit > 0 && len(list) >= limit {
+				break
+			}
+			var run GCRun
+			err := it.Item().Value(func(v []byte) error {
+				return json.Unmarshal(v, &run)
+			})
+			if err != nil {
+				return err
+			}
+			list = append(list, run)
+		}
+		return nil
+	})
+	return list, err
+}
+
+// GCStats is reported by Admin status.
+func GCStats() map[string]string {
+	return map[string]string{
+		"gc_running":   strconv.FormatBool(gcRunning.Load()),
+		"gc_pressure":  strconv.FormatBool(diskPressure()),
+		"gc_in_window": strconv.FormatBool(inGCWindow(time.Now())),
+	}
+}
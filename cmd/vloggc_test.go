@@ -0,0 +1,115 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	badger "github.com/dgraph-io/badger/v4"
+)
+
+func TestGCWindows(t *testing.T) {
+	tests := []struct {
+		windows string
+		err     bool
+		in      []string
+		out     []string
+	}{
+		{"", false, []string{"00:00", "12:34", "23:59"}, nil},
+		{"01:00-06:00", false, []string{"01:00", "05:59"}, []string{"00:59", "06:00", "23:00"}},
+		{"22:30-02:00, 12:00-12:30", false, []string{"22:30", "23:59", "00:00", "01:59", "12:15"}, []string{"02:00", "22:29", "12:30"}},
+		{"01:00", true, nil, nil},
+		{"25:00-06:00", true, nil, nil},
+		{"1-6", true, nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.windows, func(t *testing.T) {
+			windows, err := parseGCWindows(tt.windows)
+			if (err != nil) != tt.err {
+				t.Fatalf("err %v", err)
+			}
+			openTestDB(t, func(s *Settings) {
+				s.gcWindows = windows
+			})
+			for _, clock := range append(tt.in, tt.out...) {
+				m, _ := parseClock(clock)
+				now := time.Date(2026, 1, 1, m/60, m%60, 30, 0, time.Local)
+				want := !slices.Contains(tt.out, clock)
+				if got := inGCWindow(now); got != want {
+					t.Errorf("%s: in window %v, want %v", clock, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestRunGCReclaimed(t *testing.T) {
+	openTestDB(t, nil)
+	opts := badger.DefaultOptions(badgerDir()).WithLogger(nil).
+		WithValueThreshold(1 << 10).WithValueLogFileSize(1 << 20).WithMemTableSize(1 << 20).WithBaseTableSize(1 << 20).
+		WithNumLevelZeroTables(1)
+	db, err := badger.Open(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the writes and the deletes in two tables, a close flushes the memtable
+	val := bytes.Repeat([]byte("stale"), 2000)
+	for _, del := range []bool{false, true} {
+		if del {
+			if err = db.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if db, err = badger.Open(opts); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for i := 0; i < 500; i++ {
+			err := db.Update(func(txn *badger.Txn) error {
+				k := []byte(fmt.Sprintf("k%04d", i))
+				if del {
+					return txn.Delete(k)
+				}
+				return txn.Set(k, val)
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	// the compaction of the two tables drops the deleted values and counts
+	// them as discarded
+	if err = db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if db, err = badger.Open(opts); err != nil {
+		t.Fatal(err)
+	}
+	bgrdb = db
+	t.Cleanup(func() { db.Close() })
+	if err = db.Flatten(1); err != nil {
+		t.Fatal(err)
+	}
+	before := vlogFiles()
+
+	run, err := RunGC(context.Background(), GCAdmin, 0.5, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	after := vlogFiles()
+	var removed int64
+	for name, size := range before {
+		if _, ok := after[name]; !ok {
+			removed += size
+		}
+	}
+	if run.Files != 1 || run.Reclaimed == 0 || run.Reclaimed != removed {
+		t.Errorf("%d files, reclaimed %d, removed %d", run.Files, run.Reclaimed, removed)
+	}
+	if runs, err := ListGCRuns(1); err != nil || len(runs) != 1 || runs[0].Reclaimed != run.Reclaimed {
+		t.Errorf("saved runs %+v: %v", runs, err)
+	}
+}
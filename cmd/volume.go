@@ -0,0 +1,528 @@
+package cmd
+
+import (
+	"context"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	badger "github.com/dgraph-io/badger/v4"
+)
+
+// Volumes are directories on other disks which hold blob files, and only
+// them: the LSM, the value log and the values stored in Badger stay in the
+// data dir, so its hard watermark still blocks all writes. The watermarks
+// of the volumes decide if a value stored as a blob file can be written,
+// see diskWriteBlocked. Which values are blob files is set by
+// --blob-threshold-mb, or --volume-min-size-kb which lowers it when there
+// are volumes. The data dir is the volume "data", --volume adds more. A new
+// file goes to the writable volume with the most free space, or the first
+// of the key-hash ring (rendezvous hashing of the blake3) with
+// --volume-placement=ring. Blob pointers do not name the volume, a file is
+// looked up along the ring, so files can move between volumes without
+// rewriting their keys.
+//
+// The state of a volume is set by Admin: rw, ro (no new files), draining
+// (its files are moving to the others, resumed after a restart) and drained
+// (empty, it can be removed from the config). Each volume is also watched
+// against the disk watermarks, no new files go to one below the hard
+// watermark.
+var (
+	Volumes         []string
+	VolumePlacement string
+	VolumeMinSizeKB int64
+
+	volumesMu sync.RWMutex
+	volumes   []*Volume
+
+	ErrNoVolume = NewError("no volume has space for the value")
+)
+
+const (
+	VolumeRW       = "rw"
+	VolumeRO       = "ro"
+	VolumeDraining = "draining"
+	VolumeDrained  = "drained"
+
+	PlacementFree = "free"
+	PlacementRing = "ring"
+)
+
+type Volume struct {
+	Name string
+	Path string
+
+	state string // under volumesMu
+	free  atomic.Uint64
+	level atomic.Int32
+}
+
+// VolumeInfo is a volume as Admin volumes lists it.
+type VolumeInfo struct {
+	Name  string `json:"name"`
+	Path  string `json:"path"`
+	State string `json:"state"`
+	Disk  string `json:"disk"`
+	Free  uint64 `json:"free"`
+	Files uint64 `json:"files"`
+	Bytes uint64 `json:"bytes"`
+}
+
+func volumeKey(name string) []byte {
+	return InternalKey("volume/" + name)
+}
+
+func (v *Volume) blobDir() string {
+	return ToUnixSlash(filepath.Join(v.Path, "blobs"))
+}
+
+func (v *Volume) State() string {
+	volumesMu.RLock()
+	defer volumesMu.RUnlock()
+	return v.state
+}
+
+func checkVolumePlacement(p string) error {
+	if p != PlacementFree && p != PlacementRing {
+		return NewError("--volume-placement must be free or ring")
+	}
+	return nil
+}
+
+// LoadVolumes parses --volume and reads the states saved by Admin, it is
+// called once the db is open.
+func LoadVolumes() error {
+	list := []*Volume{{Name: "data", Path: DataDir, state: VolumeRW}}
+	paths := map[string]bool{filepath.Clean(DataDir): true}
+	for _, s := range Volumes {
+		name, path, ok := strings.Cut(s, "=")
+		if !ok || name == "" || path == "" || strings.ContainsAny(name, "/\\") {
+			return NewError("--volume must be name=path: " + s)
+		}
+		for _, v := range list {
+			if v.Name == name {
+				return NewError("--volume: duplicate name " + name)
+			}
+		}
+		if paths[filepath.Clean(path)] {
+			return NewError("--volume: duplicate path " + path)
+		}
+		paths[filepath.Clean(path)] = true
+		list = append(list, &Volume{Name: name, Path: filepath.ToSlash(path), state: VolumeRW})
+	}
+
+	saved := make(map[string]string)
+	prefix := InternalKey("volume/")
+	err := bgrdb.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = prefix
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			v, err := it.Item().ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+			saved[strings.TrimPrefix(string(it.Item().Key()), string(prefix))] = string(v)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, v := range list {
+		if err = os.MkdirAll(v.blobDir(), 0700); err != nil {
+			return err
+		}
+		if s, ok := saved[v.Name]; ok {
+			v.state = s
+			delete(saved, v.Name)
+		}
+	}
+	for name, s := range saved {
+		if s != VolumeDrained {
+			DebugWarn("LoadVolumes", "volume ", name, " is ", s, " but not in --volume, its files cannot be read")
+		}
+	}
+
+	volumesMu.Lock()
+	volumes = list
+	volumesMu.Unlock()
+	watchVolumes()
+	return nil
+}
+
+func volumeList() []*Volume {
+	volumesMu.RLock()
+	defer volumesMu.RUnlock()
+	if len(volumes) == 0 {
+		// before LoadVolumes, e.g. offline
+		return []*Volume{{Name: "data", Path: DataDir, state: VolumeRW}}
+	}
+	return volumes
+}
+
+func findVolume(name string) *Volume {
+	for _, v := range volumeList() {
+		if v.Name == name {
+			return v
+		}
+	}
+	return nil
+}
+
+// ringOrder is the volumes by their rendezvous score for hash, highest
+// first.
+func ringOrder(hash string) []*Volume {
+	list := append([]*Volume(nil), volumeList()...)
+	score := make(map[*Volume]uint64, len(list))
+	for _, v := range list {
+		score[v] = GetXxhash([]byte(v.Name + "/" + hash))
+	}
+	sort.Slice(list, func(i, j int) bool { return score[list[i]] > score[list[j]] })
+	return list
+}
+
+// blobFile is the path of the file of hash, on whichever volume holds it.
+func blobFile(hash string) (string, bool) {
+	for _, v := range ringOrder(hash) {
+		path := blobPath(v.blobDir(), hash)
+		if _, err := os.Stat(path); err == nil {
+			return path, true
+		}
+	}
+	return "", false
+}
+
+// placeBlob chooses the volume for a new file of hash: a writable one,
+// above the soft watermark if there is one.
+func placeBlob(hash string) (*Volume, error) {
+	var best *Volume
+	for _, v := range ringOrder(hash) {
+		if v.State() != VolumeRW || v.level.Load() == DiskHard {
+			continue
+		}
+		switch {
+		case best == nil:
+			best = v
+		case best.level.Load() == DiskSoft && v.level.Load() == DiskOK:
+			best = v
+		case cfg().VolumePlacement == PlacementFree && best.level.Load() == v.level.Load() && v.free.Load() > best.free.Load():
+			best = v
+		}
+	}
+	if best == nil {
+		return nil, ErrNoVolume
+	}
+	return best, nil
+}
+
+// blobVolumeLevel is the disk state of the writable volume placeBlob would
+// pick first, DiskHard if there is none.
+func blobVolumeLevel() int32 {
+	level := DiskHard
+	for _, v := range volumeList() {
+		if v.State() == VolumeRW {
+			level = min(level, v.level.Load())
+		}
+	}
+	return level
+}
+
+// storeBlobFile returns the size of the file of hash, writing it with the
+// bytes of encode on a placed volume unless it exists.
+func storeBlobFile(hash string, encode func() []byte) (int64, error) {
+	path, ok := blobFile(hash)
+	if !ok {
+		v, err := placeBlob(hash)
+		if err != nil {
+			return 0, err
+		}
+		path = blobPath(v.blobDir(), hash)
+		if err = writeFileSync(path, encode()); err != nil {
+			return 0, err
+		}
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		return 0, err
+	}
+	return fi.Size(), nil
+}
+
+// openBlobFile opens the file of hash, once more if a drain moved it
+// between the lookup and the open.
+func openBlobFile(hash string) (*os.File, error) {
+	var err error
+	for i := 0; i < 2; i++ {
+		path, ok := blobFile(hash)
+		if !ok {
+			return nil, &fs.PathError{Op: "open", Path: "blob " + hash, Err: fs.ErrNotExist}
+		}
+		var fp *os.File
+		if fp, err = os.Open(path); err == nil || !os.IsNotExist(err) {
+			return fp, err
+		}
+	}
+	return nil, err
+}
+
+// readBlobFile reads the whole file of hash.
+func readBlobFile(hash string) ([]byte, error) {
+	fp, err := openBlobFile(hash)
+	if err != nil {
+		return nil, err
+	}
+	defer fp.Close()
+	fi, err := fp.Stat()
+	if err != nil {
+		return nil, err
+	}
+	b := make([]byte, fi.Size())
+	_, err = io.ReadFull(fp, b)
+	return b, err
+}
+
+// removeBlobFiles removes the file of hash from every volume.
+func removeBlobFiles(hash string) error {
+	for _, v := range volumeList() {
+		err := os.Remove(blobPath(v.blobDir(), hash))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// restoreBlobs copies the files of src missing on all volumes to placed
+// ones.
+func restoreBlobs(src string) (n int, err error) {
+	err = filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() || strings.HasPrefix(d.Name(), ".tmp-") {
+			return nil
+		}
+		if _, ok := blobFile(d.Name()); ok {
+			return nil
+		}
+		v, err := placeBlob(d.Name())
+		if err != nil {
+			return err
+		}
+		if err := copyFileSync(path, blobPath(v.blobDir(), d.Name())); err != nil {
+			return err
+		}
+		n++
+		return nil
+	})
+	return n, err
+}
+
+// watchVolumes checks the free space of each volume against the
+// watermarks.
+func watchVolumes() {
+	for _, v := range volumeList() {
+		abs, err := filepath.Abs(v.Path)
+		if err != nil {
+			continue
+		}
+		free := DiskFree(filepath.ToSlash(abs))
+		if free == 0 {
+			continue
+		}
+		v.free.Store(free)
+
+		old := v.level.Load()
+		if level := diskLevel(free, old); level != old {
+			v.level.Store(level)
+			DebugWarn("WatchDiskFreeSpace", "volume ", v.Name, " disk state ", diskStateNames[old], " -> ", diskStateNames[level],
+				", free space ", free>>20, "MB")
+		}
+	}
+}
+
+// SetVolumeState sets a volume rw or ro, Admin volume-set.
+func SetVolumeState(name, state string) error {
+	if state != VolumeRW && state != VolumeRO {
+		return NewError("state must be rw or ro")
+	}
+	v := findVolume(name)
+	if v == nil {
+		return NewError("no volume " + name)
+	}
+	return saveVolumeState(v, state)
+}
+
+func saveVolumeState(v *Volume, state string) error {
+	err := bgrdb.Update(func(txn *badger.Txn) error {
+		return txn.Set(volumeKey(v.Name), []byte(state))
+	})
+	if err != nil {
+		return err
+	}
+	volumesMu.Lock()
+	v.state = state
+	volumesMu.Unlock()
+	PrintlnInfo("volume", v.Name, " is ", state)
+	return nil
+}
+
+// StartVolumeDrain moves the files of a volume to the others and sets it
+// drained. A file in use stays readable, it exists on the old volume until
+// the new copy is complete.
+func StartVolumeDrain(name string) (*Job, error) {
+	v := findVolume(name)
+	if v == nil {
+		return nil, NewError("no volume " + name)
+	}
+	if v.State() == VolumeDraining {
+		return nil, NewError("volume " + name + " is draining")
+	}
+	if err := saveVolumeState(v, VolumeDraining); err != nil {
+		return nil, err
+	}
+	return startDrain(v), nil
+}
+
+// ResumeVolumeDrains starts the drain of the volumes left draining by the
+// last run, once the jobs are loaded.
+func ResumeVolumeDrains() []*Job {
+	var started []*Job
+	for _, v := range volumeList() {
+		if v.State() == VolumeDraining {
+			DebugInfo("ResumeVolumeDrains", v.Name)
+			started = append(started, startDrain(v))
+		}
+	}
+	return started
+}
+
+func startDrain(v *Volume) *Job {
+	name := v.Name
+	return StartJob("volume-drain", map[string]string{"volume": name}, func(ctx context.Context, j *Job) error {
+		err := filepath.WalkDir(v.blobDir(), func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				if os.IsNotExist(err) {
+					return nil
+				}
+				return err
+			}
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if s := v.State(); s != VolumeDraining {
+				return NewError("drain stopped, volume " + name + " is " + s)
+			}
+			if d.IsDir() || strings.HasPrefix(d.Name(), ".tmp-") {
+				return nil
+			}
+			size, err := moveBlobFile(v, d.Name(), path)
+			if err != nil {
+				return err
+			}
+			j.Add(1, uint64(size), 0)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		return saveVolumeState(v, VolumeDrained)
+	})
+}
+
+func moveBlobFile(from *Volume, hash, path string) (int64, error) {
+	// RunBlobGC must not remove the file while it moves
+	blobMu.RLock()
+	defer blobMu.RUnlock()
+
+	fi, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	exists := false
+	for _, v := range volumeList() {
+		if v == from {
+			continue
+		}
+		if _, err := os.Stat(blobPath(v.blobDir(), hash)); err == nil {
+			exists = true
+			break
+		}
+	}
+	if !exists {
+		to, err := placeBlob(hash)
+		if err != nil {
+			return 0, err
+		}
+		if err = copyFileSync(path, blobPath(to.blobDir(), hash)); err != nil {
+			return 0, err
+		}
+	}
+	return fi.Size(), os.Remove(path)
+}
+
+// ListVolumes counts the files of each volume.
+func ListVolumes() []VolumeInfo {
+	var list []VolumeInfo
+	for _, v := range volumeList() {
+		info := VolumeInfo{Name: v.Name, Path: v.Path, State: v.State(), Disk: diskStateNames[v.level.Load()], Free: v.free.Load()}
+		filepath.WalkDir(v.blobDir(), func(path string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() || strings.HasPrefix(d.Name(), ".tmp-") {
+				return nil
+			}
+			if fi, err := d.Info(); err == nil {
+				info.Files++
+				info.Bytes += uint64(fi.Size())
+			}
+			return nil
+		})
+		list = append(list, info)
+	}
+	return list
+}
+
+// VolumeStats is reported by Admin status.
+func VolumeStats() map[string]string {
+	m := make(map[string]string)
+	for _, v := range volumeList() {
+		m["volume."+v.Name] = v.State() + ":" + diskStateNames[v.level.Load()] + ":" + Uint64ToString(v.free.Load())
+	}
+	return m
+}
+
+// volumeMetrics are the volume gauges in the Prometheus text format.
+func volumeMetrics() string {
+	var b strings.Builder
+	b.WriteString("# HELP zstdb_volume_free_bytes free space of the disk holding the volume\n# TYPE zstdb_volume_free_bytes gauge\n")
+	for _, v := range volumeList() {
+		b.WriteString("zstdb_volume_free_bytes{volume=" + strconv.Quote(v.Name) + "} " + Uint64ToString(v.free.Load()) + "\n")
+	}
+	b.WriteString("# HELP zstdb_volume_disk_state 0 ok, 1 soft watermark, 2 hard watermark\n# TYPE zstdb_volume_disk_state gauge\n")
+	for _, v := range volumeList() {
+		b.WriteString("zstdb_volume_disk_state{volume=" + strconv.Quote(v.Name) + "} " + Int2Str(int(v.level.Load())) + "\n")
+	}
+	b.WriteString("# HELP zstdb_volume_writable 1 if new files may go to the volume\n# TYPE zstdb_volume_writable gauge\n")
+	for _, v := range volumeList() {
+		w := "0"
+		if v.State() == VolumeRW {
+			w = "1"
+		}
+		b.WriteString("zstdb_volume_writable{volume=" + strconv.Quote(v.Name) + "} " + w + "\n")
+	}
+	return b.String()
+}
@@ -0,0 +1,242 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testVolumes adds the volumes v1 and v2 next to the data dir.
+func testVolumes(t *testing.T, set func(s *Settings)) (data, v1, v2 *Volume) {
+	openTestDB(t, set)
+	prev := Volumes
+	Volumes = []string{"v1=" + filepath.Join(t.TempDir(), "v1"), "v2=" + filepath.Join(t.TempDir(), "v2")}
+	t.Cleanup(func() {
+		Volumes = prev
+		volumesMu.Lock()
+		volumes = nil
+		volumesMu.Unlock()
+	})
+	if err := LoadVolumes(); err != nil {
+		t.Fatal(err)
+	}
+	return findVolume("data"), findVolume("v1"), findVolume("v2")
+}
+
+func TestVolumePlacement(t *testing.T) {
+	data, v1, v2 := testVolumes(t, func(s *Settings) {
+		s.VolumePlacement = PlacementFree
+	})
+	all := []*Volume{data, v1, v2}
+	set := func(free [3]uint64, level [3]int32, state [3]string) {
+		for i, v := range all {
+			v.free.Store(free[i])
+			v.level.Store(level[i])
+			v.state = state[i]
+		}
+	}
+	rw := [3]string{VolumeRW, VolumeRW, VolumeRW}
+	ok := [3]int32{DiskOK, DiskOK, DiskOK}
+
+	tests := []struct {
+		name  string
+		free  [3]uint64
+		level [3]int32
+		state [3]string
+		want  *Volume
+	}{
+		{"most free", [3]uint64{10, 30, 20}, ok, rw, v1},
+		{"soft only if no other", [3]uint64{10, 30, 20}, [3]int32{DiskOK, DiskSoft, DiskOK}, rw, v2},
+		{"all soft", [3]uint64{10, 30, 20}, [3]int32{DiskSoft, DiskSoft, DiskSoft}, rw, v1},
+		{"not below the hard watermark", [3]uint64{10, 30, 20}, [3]int32{DiskOK, DiskHard, DiskHard}, rw, data},
+		{"not ro nor draining", [3]uint64{10, 30, 20}, ok, [3]string{VolumeRW, VolumeRO, VolumeDraining}, data},
+		{"none", [3]uint64{10, 30, 20}, ok, [3]string{VolumeRO, VolumeDrained, VolumeDraining}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			set(tt.free, tt.level, tt.state)
+			for i := 0; i < 10; i++ {
+				got, err := placeBlob(fmt.Sprintf("%064d", i))
+				if tt.want == nil {
+					if err != ErrNoVolume {
+						t.Fatalf("placed on %v: %v", got, err)
+					}
+					continue
+				}
+				if got != tt.want {
+					t.Fatalf("placed on %s, want %s", got.Name, tt.want.Name)
+				}
+			}
+		})
+	}
+
+	t.Run("ring", func(t *testing.T) {
+		s := *cfg()
+		s.VolumePlacement = PlacementRing
+		settings.Store(&s)
+		set([3]uint64{10, 30, 20}, ok, rw)
+		placed := make(map[*Volume]int)
+		for i := 0; i < 300; i++ {
+			hash := fmt.Sprintf("%064d", i)
+			got, err := placeBlob(hash)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if first := ringOrder(hash)[0]; got != first {
+				t.Fatalf("%s placed on %s, first of the ring is %s", hash, got.Name, first.Name)
+			}
+			placed[got]++
+		}
+		for _, v := range all {
+			if placed[v] < 50 {
+				t.Errorf("%d of 300 files on %s", placed[v], v.Name)
+			}
+		}
+
+		// the next of the ring when the first is read-only
+		hash := fmt.Sprintf("%064d", 0)
+		order := ringOrder(hash)
+		order[0].state = VolumeRO
+		if got, _ := placeBlob(hash); got != order[1] {
+			t.Errorf("placed on %s, want %s", got.Name, order[1].Name)
+		}
+	})
+}
+
+func TestVolumeWriteBlocked(t *testing.T) {
+	data, v1, v2 := testVolumes(t, func(s *Settings) {
+		s.VolumeMinSizeKB = 64
+		s.DiskSoftMaxUploadMB = 4
+	})
+	t.Cleanup(func() { diskState.Store(DiskOK) })
+	all := []*Volume{data, v1, v2}
+
+	tests := []struct {
+		name    string
+		dataDir int32
+		levels  [3]int32
+		states  [3]string
+		size    int64
+		blocked bool
+	}{
+		{"blob, data dir soft", DiskSoft, [3]int32{DiskSoft, DiskOK, DiskOK}, [3]string{VolumeRW, VolumeRW, VolumeRW}, 8 << 20, false},
+		{"blob, volumes soft", DiskOK, [3]int32{DiskSoft, DiskSoft, DiskSoft}, [3]string{VolumeRW, VolumeRW, VolumeRW}, 8 << 20, true},
+		{"small blob, volumes soft", DiskOK, [3]int32{DiskSoft, DiskSoft, DiskSoft}, [3]string{VolumeRW, VolumeRW, VolumeRW}, 1 << 20, false},
+		{"blob, volumes hard", DiskOK, [3]int32{DiskHard, DiskHard, DiskHard}, [3]string{VolumeRW, VolumeRW, VolumeRW}, 1 << 20, true},
+		{"blob, only a read-only volume has space", DiskOK, [3]int32{DiskHard, DiskOK, DiskHard}, [3]string{VolumeRW, VolumeRO, VolumeRW}, 1 << 20, true},
+		{"no blob, volumes hard", DiskOK, [3]int32{DiskHard, DiskHard, DiskHard}, [3]string{VolumeRW, VolumeRW, VolumeRW}, 1 << 10, false},
+		{"blob, data dir hard", DiskHard, [3]int32{DiskHard, DiskOK, DiskOK}, [3]string{VolumeRW, VolumeRW, VolumeRW}, 1 << 20, true},
+	}
+	for _, tt := range tests {
+		diskState.Store(tt.dataDir)
+		for i, v := range all {
+			v.level.Store(tt.levels[i])
+			v.state = tt.states[i]
+		}
+		if got := diskWriteBlocked(tt.size); (got != "") != tt.blocked {
+			t.Errorf("%s: %q", tt.name, got)
+		}
+	}
+}
+
+func TestVolumeDrain(t *testing.T) {
+	_, v1, _ := testVolumes(t, func(s *Settings) {
+		s.BlobThresholdMB = 1
+		s.VolumePlacement = PlacementFree
+	})
+	v1.free.Store(1 << 62)
+
+	var keys [][]byte
+	var values [][]byte
+	for i := 0; i < 5; i++ {
+		key := []byte(fmt.Sprintf("k%d", i))
+		val := bytes.Repeat([]byte(fmt.Sprintf("value %d ", i)), 200000)
+		if _, err := badgerPut(key, val, GetXxhash(val), SaveOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		keys, values = append(keys, key), append(values, val)
+	}
+	files := func(v *Volume) uint64 {
+		for _, info := range ListVolumes() {
+			if info.Name == v.Name {
+				return info.Files
+			}
+		}
+		return 0
+	}
+	if n := files(v1); n != 5 {
+		t.Fatalf("%d files on v1", n)
+	}
+	readAll := func(step string) {
+		t.Helper()
+		for i, key := range keys {
+			if got, _, _ := badgerGet(context.Background(), key); !bytes.Equal(got, values[i]) {
+				t.Errorf("%s: %s is %d bytes", step, key, len(got))
+			}
+		}
+	}
+	readAll("placed")
+
+	j, err := StartVolumeDrain("v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if done := j.Wait(10 * time.Second); done.State != JobDone || done.Keys != 5 {
+		t.Fatalf("job %s, %d files moved: %s", done.State, done.Keys, done.Error)
+	}
+	if v1.State() != VolumeDrained || files(v1) != 0 {
+		t.Errorf("v1 is %s with %d files", v1.State(), files(v1))
+	}
+	readAll("drained")
+	// again, e.g. after files were copied to it by hand
+	if j, err = StartVolumeDrain("v1"); err != nil {
+		t.Fatal(err)
+	}
+	if done := j.Wait(10 * time.Second); done.State != JobDone || done.Keys != 0 {
+		t.Errorf("job %s, %d files moved: %s", done.State, done.Keys, done.Error)
+	}
+}
+
+func TestVolumeDrainResumed(t *testing.T) {
+	data, v1, _ := testVolumes(t, func(s *Settings) {
+		s.BlobThresholdMB = 1
+	})
+	hash := blobHash([]byte("resumed"))
+	// the file on v1, as if the drain stopped before it moved
+	if err := writeFileSync(blobPath(v1.blobDir(), hash), []byte("file")); err != nil {
+		t.Fatal(err)
+	}
+	if err := saveVolumeState(v1, VolumeDraining); err != nil {
+		t.Fatal(err)
+	}
+
+	// a restart
+	volumesMu.Lock()
+	volumes = nil
+	volumesMu.Unlock()
+	if err := LoadVolumes(); err != nil {
+		t.Fatal(err)
+	}
+	v1 = findVolume("v1")
+	if v1.State() != VolumeDraining {
+		t.Fatalf("v1 is %s after the restart", v1.State())
+	}
+	findVolume("data").free.Store(1 << 62)
+	jobs := ResumeVolumeDrains()
+	if len(jobs) != 1 {
+		t.Fatalf("%d drains resumed", len(jobs))
+	}
+	if done := jobs[0].Wait(10 * time.Second); done.State != JobDone || done.Keys != 1 {
+		t.Fatalf("job %s, %d files moved: %s", done.State, done.Keys, done.Error)
+	}
+	if v1.State() != VolumeDrained {
+		t.Errorf("v1 is %s", v1.State())
+	}
+	if path, ok := blobFile(hash); !ok || !strings.HasPrefix(path, data.blobDir()) {
+		t.Errorf("file at %s, %v", path, ok)
+	}
+}
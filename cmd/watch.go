@@ -0,0 +1,317 @@
+package cmd
+
+import (
+	"context"
+	"encoding/binary"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	pb "zstdb/pbs"
+
+	badger "github.com/dgraph-io/badger/v4"
+	bpb "github.com/dgraph-io/badger/v4/pb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Every Set and Delete appends an event to the change log in the same
+// transaction:
+//
+//	\x00zstdb/cdc/<unix nano:8><xxhash of key:8> => [type][size:8][xxhash:8][key]
+//
+// The version of the event is the version of the transaction. Watch replays
+// the log after the version a client resumes from, then follows new events
+// with bgrdb.Subscribe. Events older than --watch-retention are trimmed.
+var (
+	WatchRetention time.Duration
+	WatchBuffer    int
+)
+
+const (
+	cdcSet          byte = 1
+	cdcDelete       byte = 2
+	cdcDeletePrefix byte = 3
+)
+
+// a "delete-prefix" event has the prefix as key, only older versions wrote
+// them, delete-prefix now logs a delete for every key
+var cdcTypes = map[byte]string{cdcSet: "set", cdcDelete: "delete", cdcDeletePrefix: "delete-prefix"}
+
+func cdcPrefix() []byte {
+	return InternalKey("cdc/")
+}
+
+// cdcAppend records an event in txn, a no-op if the log is disabled.
+func cdcAppend(txn *badger.Txn, typ byte, key []byte, size, sum64 uint64) error {
+	if cfg().WatchRetention <= 0 {
+		return nil
+	}
+	k := binary.BigEndian.AppendUint64(cdcPrefix(), uint64(time.Now().UnixNano()))
+	k = binary.BigEndian.AppendUint64(k, GetXxhash(key))
+
+	v := make([]byte, 0, 17+len(key))
+	v = append(v, typ)
+	v = binary.LittleEndian.AppendUint64(v, size)
+	v = binary.LittleEndian.AppendUint64(v, sum64)
+	v = append(v, key...)
+	return txn.Set(k, v)
+}
+
+// decodeCDC returns nil for anything but an event, e.g. a trimmed one.
+func decodeCDC(k, v []byte, ver uint64) *pb.WatchEvent {
+	p := cdcPrefix()
+	if len(v) < 17 || len(k) < len(p)+16 || cdcTypes[v[0]] == "" {
+		return nil
+	}
+	nano := binary.BigEndian.Uint64(k[len(p):])
+	return &pb.WatchEvent{
+		Type:      cdcTypes[v[0]],
+		Key:       append([]byte{}, v[17:]...),
+		Ver64:     ver,
+		Size:      binary.LittleEndian.Uint64(v[1:9]),
+		Sum64:     binary.LittleEndian.Uint64(v[9:17]),
+		UnixMilli: int64(nano / 1e6),
+	}
+}
+
+func matchPrefixes(key []byte, prefixes []string) bool {
+	if len(prefixes) == 0 {
+		return true
+	}
+	for _, p := range prefixes {
+		if strings.HasPrefix(string(key), p) {
+			return true
+		}
+	}
+	return false
+}
+
+// Watch streams events to send until ctx is done, or returns
+// ResourceExhausted if the client reads slower than events come in.
+func Watch(ctx context.Context, prefixes []string, since uint64, send func(*pb.WatchEvent) error) error {
+	if cfg().WatchRetention <= 0 {
+		return status.Error(codes.FailedPrecondition, "watch is disabled, see --watch-retention")
+	}
+	if since > 0 && since < cdcTrimmedVersion() {
+		return status.Error(codes.OutOfRange, "events after this version were trimmed (--watch-retention), list again and watch from the current version")
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	buffer := cfg().WatchBuffer
+	if buffer < 16 {
+		buffer = 16
+	}
+	events := make(chan *pb.WatchEvent, buffer)
+	subErr := make(chan error, 1)
+	ready := make(chan struct{})
+	pingKey := InternalKey("cdc-ping/" + Uint64ToString(GetXxhash([]byte(time.Now().String()))))
+
+	go func() {
+		var once sync.Once
+		subErr <- bgrdb.Subscribe(ctx, func(kvs *badger.KVList) error {
+			for _, kv := range kvs.Kv {
+				if string(kv.Key) == string(pingKey) {
+					once.Do(func() { close(ready) })
+					continue
+				}
+				ev := decodeCDC(kv.Key, kv.Value, kv.Version)
+				if ev == nil || !matchPrefixes(ev.Key, prefixes) {
+					continue
+				}
+				select {
+				case events <- ev:
+				default:
+					return status.Error(codes.ResourceExhausted, "watch fell behind by more than --watch-buffer events")
+				}
+			}
+			return nil
+		}, []bpb.Match{{Prefix: cdcPrefix()}, {Prefix: pingKey}})
+	}()
+
+	// the snapshot for the replay must be taken after Subscribe is listening
+	if err := waitSubscribed(ctx, pingKey, ready); err != nil {
+		return err
+	}
+
+	var lastVer uint64
+	txn := bgrdb.NewTransaction(false)
+	snapshot := txn.ReadTs()
+	if since > 0 {
+		replay := cdcReplay(txn, prefixes, since)
+		txn.Discard()
+		for _, ev := range replay {
+			if err := send(ev); err != nil {
+				return err
+			}
+			lastVer = ev.Ver64
+		}
+	} else {
+		txn.Discard()
+	}
+	if err := send(&pb.WatchEvent{Type: "synced", Ver64: snapshot, UnixMilli: time.Now().UnixMilli()}); err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-appCtx.Done():
+			return status.Error(codes.Unavailable, "server is shutting down")
+		case err := <-subErr:
+			if status.Code(err) == codes.ResourceExhausted {
+				DebugWarn("Watch", "subscriber fell behind at version ", lastVer)
+				return status.Error(codes.ResourceExhausted,
+					"watch fell behind, resume from version "+Uint64ToString(lastVer))
+			}
+			if err == nil || ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		case ev := <-events:
+			if ev.Ver64 <= snapshot {
+				continue
+			}
+			if err := send(ev); err != nil {
+				return err
+			}
+			lastVer = ev.Ver64
+		}
+	}
+}
+
+// waitSubscribed writes pingKey until the subscriber has seen it.
+func waitSubscribed(ctx context.Context, pingKey []byte, ready chan struct{}) error {
+	defer bgrdb.Update(func(txn *badger.Txn) error {
+		return txn.Delete(pingKey)
+	})
+
+	for i := 0; i < 100; i++ {
+		err := bgrdb.Update(func(txn *badger.Txn) error {
+			return txn.Set(pingKey, []byte{1})
+		})
+		if err != nil {
+			return err
+		}
+		select {
+		case <-ready:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(20 * time.Millisecond):
+		}
+	}
+	return status.Error(codes.Unavailable, "cannot subscribe to the change log")
+}
+
+// cdcReplay returns the events after since, in version order.
+func cdcReplay(txn *badger.Txn, prefixes []string, since uint64) []*pb.WatchEvent {
+	var replay []*pb.WatchEvent
+
+	opts := badger.DefaultIteratorOptions
+	opts.PrefetchValues = false
+	opts.Prefix = cdcPrefix()
+	it := txn.NewIterator(opts)
+	defer it.Close()
+
+	for it.Rewind(); it.Valid(); it.Next() {
+		item := it.Item()
+		if item.Version() <= since {
+			continue
+		}
+		err := item.Value(func(v []byte) error {
+			ev := decodeCDC(item.Key(), v, item.Version())
+			if ev != nil && matchPrefixes(ev.Key, prefixes) {
+				replay = append(replay, ev)
+			}
+			return nil
+		})
+		if err != nil {
+			PrintError("cdcReplay", err)
+		}
+	}
+
+	sort.SliceStable(replay, func(i, j int) bool {
+		return replay[i].Ver64 < replay[j].Ver64
+	})
+	return replay
+}
+
+func cdcTrimmedVersion() uint64 {
+	var ver uint64
+	bgrdb.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(InternalKey("cdc-trimmed"))
+		if err != nil {
+			return nil
+		}
+		return item.Value(func(v []byte) error {
+			if len(v) >= 8 {
+				ver = binary.LittleEndian.Uint64(v)
+			}
+			return nil
+		})
+	})
+	return ver
+}
+
+// TrimChangeLog deletes events older than --watch-retention and records the
+// highest version deleted, cron calls it.
+func TrimChangeLog() error {
+	if bgrdb == nil || bgrdb.IsClosed() {
+		return nil
+	}
+	retention := cfg().WatchRetention
+	if retention <= 0 {
+		// the log is off, drop it all
+		retention = time.Nanosecond
+	}
+	until := binary.BigEndian.AppendUint64(cdcPrefix(), uint64(time.Now().Add(-retention).UnixNano()))
+
+	var keys [][]byte
+	trimmed := cdcTrimmedVersion()
+	err := bgrdb.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		opts.Prefix = cdcPrefix()
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			if string(it.Item().Key()) >= string(until) {
+				break
+			}
+			if len(keys) >= 100000 {
+				// the rest on the next run
+				break
+			}
+			keys = append(keys, it.Item().KeyCopy(nil))
+			if v := it.Item().Version(); v > trimmed {
+				trimmed = v
+			}
+		}
+		return nil
+	})
+	if err != nil || len(keys) == 0 {
+		return err
+	}
+
+	wb := bgrdb.NewWriteBatch()
+	defer wb.Cancel()
+	for _, k := range keys {
+		if err = wb.Delete(k); err != nil {
+			return err
+		}
+	}
+	err = wb.Set(InternalKey("cdc-trimmed"), binary.LittleEndian.AppendUint64(nil, trimmed))
+	if err != nil {
+		return err
+	}
+	if err = wb.Flush(); err != nil {
+		return err
+	}
+	DebugInfo("TrimChangeLog", "trimmed ", len(keys), " events up to version ", trimmed)
+	return nil
+}
@@ -0,0 +1,450 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	badger "github.com/dgraph-io/badger/v4"
+)
+
+// Webhooks are POSTed from a queue inside the db, so deliveries survive a
+// restart. Set and Delete queue their jobs in their own transaction, a job
+// exists if and only if its write committed:
+//
+//	\x00zstdb/hookq/<due unix nano:8><id:8> => WebhookJob
+//	\x00zstdb/hookdlq/<id:8>                => WebhookJob, after --webhook-max-attempts
+//
+// The body is signed with HMAC-SHA256 of "<X-Zstdb-Timestamp>.<body>".
+var (
+	Webhooks           []string
+	WebhookSecret      string
+	WebhookMaxAttempts int
+	WebhookTimeout     time.Duration
+
+	webhookWake = make(chan struct{}, 1)
+	webhookSeq  atomic.Uint64
+)
+
+type Webhook struct {
+	URL      string
+	Prefixes []string
+	Events   map[string]bool
+	Secret   string
+}
+
+type WebhookEvent struct {
+	Event   string `json:"event"`
+	Key     string `json:"key"`
+	Version uint64 `json:"version"`
+	Size    uint64 `json:"size"`
+	Sum64   uint64 `json:"xxhash"`
+	Time    string `json:"time"`
+}
+
+type WebhookJob struct {
+	ID        uint64          `json:"id"`
+	URL       string          `json:"url"`
+	Payload   json.RawMessage `json:"payload"`
+	Attempts  int             `json:"attempts"`
+	LastError string          `json:"last_error,omitempty"`
+	Created   time.Time       `json:"created"`
+	// the payload gets the version of the queue entry, which is the
+	// commit version of the write that queued it
+	FillVersion bool `json:"fill_version,omitempty"`
+}
+
+func init() {
+	webhookSeq.Store(uint64(time.Now().UnixNano()))
+}
+
+// parseWebhooks parses --webhook "url[;prefix=a/,b/][;events=set,delete,backup][;secret=s]",
+// without events every event is sent.
+func parseWebhooks(specs []string, secret string) ([]Webhook, error) {
+	var list []Webhook
+	for _, spec := range specs {
+		parts := strings.Split(spec, ";")
+		w := Webhook{URL: strings.TrimSpace(parts[0]), Secret: secret}
+		if !strings.HasPrefix(w.URL, "http://") && !strings.HasPrefix(w.URL, "https://") {
+			return nil, NewError("--webhook must start with http:// or https://: " + spec)
+		}
+		for _, opt := range parts[1:] {
+			k, v, _ := strings.Cut(strings.TrimSpace(opt), "=")
+			switch k {
+			case "prefix":
+				w.Prefixes = strings.Split(v, ",")
+			case "events":
+				w.Events = make(map[string]bool)
+				for _, e := range strings.Split(v, ",") {
+					w.Events[strings.TrimSpace(e)] = true
+				}
+			case "secret":
+				w.Secret = v
+			default:
+				return nil, NewError("--webhook unknown option: " + opt)
+			}
+		}
+		list = append(list, w)
+	}
+	return list, nil
+}
+
+func (w Webhook) matches(ev *WebhookEvent) bool {
+	if w.Events != nil && !w.Events[ev.Event] {
+		return false
+	}
+	if ev.Event == "backup" {
+		return true
+	}
+	return matchPrefixes([]byte(ev.Key), w.Prefixes)
+}
+
+func webhookSecretFor(url string) string {
+	s := cfg()
+	for _, w := range s.webhooks {
+		if w.URL == url {
+			return w.Secret
+		}
+	}
+	return s.WebhookSecret
+}
+
+// webhookJobs are the jobs of ev, one for every webhook it matches.
+func webhookJobs(ev WebhookEvent) ([]WebhookJob, error) {
+	var urls []string
+	for _, w := range cfg().webhooks {
+		if w.matches(&ev) {
+			urls = append(urls, w.URL)
+		}
+	}
+	if len(urls) == 0 {
+		return nil, nil
+	}
+
+	if ev.Time == "" {
+		ev.Time = time.Now().UTC().Format(time.RFC3339Nano)
+	}
+	payload, err := json.Marshal(ev)
+	if err != nil {
+		return nil, err
+	}
+	jobs := make([]WebhookJob, len(urls))
+	for i, url := range urls {
+		jobs[i] = WebhookJob{ID: webhookSeq.Add(1), URL: url, Payload: payload, Created: time.Now().UTC()}
+	}
+	return jobs, nil
+}
+
+func queueWebhookJobs(txn *badger.Txn, jobs []WebhookJob) error {
+	for _, job := range jobs {
+		if err := putWebhookJob(txn, hookQueueKey(time.Now(), job.ID), job); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// NotifyWebhooks queues ev for every webhook it matches.
+func NotifyWebhooks(ev WebhookEvent) {
+	jobs, err := webhookJobs(ev)
+	if err == nil && len(jobs) > 0 {
+		err = bgrdb.Update(func(txn *badger.Txn) error {
+			return queueWebhookJobs(txn, jobs)
+		})
+	}
+	if err != nil {
+		PrintError("NotifyWebhooks", err)
+		return
+	}
+	wakeWebhooks()
+}
+
+// queueKeyWebhooks queues the webhooks of a Set or Delete of key in txn,
+// the transaction of the write.
+func queueKeyWebhooks(txn *badger.Txn, event string, key []byte, size, sum64 uint64) error {
+	if len(cfg().webhooks) == 0 {
+		return nil
+	}
+	jobs, err := webhookJobs(WebhookEvent{Event: event, Key: string(key), Size: size, Sum64: sum64})
+	if err != nil {
+		return err
+	}
+	for i := range jobs {
+		jobs[i].FillVersion = true
+	}
+	return queueWebhookJobs(txn, jobs)
+}
+
+// wakeWebhooks starts a delivery after a commit which may have queued jobs.
+func wakeWebhooks() {
+	if len(cfg().webhooks) == 0 {
+		return
+	}
+	select {
+	case webhookWake <- struct{}{}:
+	default:
+	}
+}
+
+func hookQueueKey(due time.Time, id uint64) []byte {
+	k := binary.BigEndian.AppendUint64(InternalKey("hookq/"), uint64(due.UnixNano()))
+	return binary.BigEndian.AppendUint64(k, id)
+}
+
+func hookDLQKey(id uint64) []byte {
+	return binary.BigEndian.AppendUint64(InternalKey("hookdlq/"), id)
+}
+
+func putWebhookJob(txn *badger.Txn, k []byte, job WebhookJob) error {
+	b, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	// encrypted like any value when encryption is on
+	return txn.Set(k, EncodeValue(b, CompressionPolicy{Codec: CodecNone}))
+}
+
+func readWebhookJob(item *badger.Item) (WebhookJob, error) {
+	var job WebhookJob
+	err := item.Value(func(v []byte) error {
+		b, err := decodeInternal(v)
+		if err != nil {
+			return err
+		}
+		return json.Unmarshal(b, &job)
+	})
+	if err == nil && job.FillVersion {
+		var ev WebhookEvent
+		if err = json.Unmarshal(job.Payload, &ev); err != nil {
+			return job, err
+		}
+		ev.Version = item.Version()
+		job.Payload, err = json.Marshal(ev)
+		job.FillVersion = false
+	}
+	return job, err
+}
+
+// RunWebhooks delivers the due jobs until ctx is done.
+func RunWebhooks(ctx context.Context) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-webhookWake:
+		}
+		// a full batch means there may be more due
+		for ctx.Err() == nil && deliverDueWebhooks(ctx) == 64 {
+		}
+	}
+}
+
+// deliverDueWebhooks sends up to 64 due jobs, it returns how many were tried.
+func deliverDueWebhooks(ctx context.Context) int {
+	type due struct {
+		key []byte
+		job WebhookJob
+	}
+	var jobs []due
+	now := hookQueueKey(time.Now(), 1<<64-1)
+	bgrdb.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = InternalKey("hookq/")
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		for it.Rewind(); it.Valid() && len(jobs) < 64; it.Next() {
+			if bytes.Compare(it.Item().Key(), now) > 0 {
+				break
+			}
+			job, err := readWebhookJob(it.Item())
+			if err != nil {
+				PrintError("deliverDueWebhooks", err)
+				continue
+			}
+			jobs = append(jobs, due{key: it.Item().KeyCopy(nil), job: job})
+		}
+		return nil
+	})
+	if len(jobs) == 0 {
+		return 0
+	}
+	// never announce a write which a crash could still lose
+	PrintError("deliverDueWebhooks", bgrdb.Sync())
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, 8)
+	for _, d := range jobs {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(key []byte, job WebhookJob) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			err := postWebhook(ctx, job)
+			if ctx.Err() != nil {
+				// shutting down, not an attempt
+				return
+			}
+			PrintError("webhook "+job.URL, finishWebhookJob(key, job, err))
+		}(d.key, d.job)
+	}
+	wg.Wait()
+	return len(jobs)
+}
+
+func postWebhook(ctx context.Context, job WebhookJob) error {
+	timeout := cfg().WebhookTimeout
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, job.URL, bytes.NewReader(job.Payload))
+	if err != nil {
+		return err
+	}
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "zstdb-webhook")
+	req.Header.Set("X-Zstdb-Delivery", Uint64ToString(job.ID))
+	req.Header.Set("X-Zstdb-Timestamp", ts)
+	if secret := webhookSecretFor(job.URL); secret != "" {
+		req.Header.Set("X-Zstdb-Signature", "sha256="+SignWebhook(secret, ts, job.Payload))
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return NewError("http status " + resp.Status)
+	}
+	return nil
+}
+
+// SignWebhook is hex HMAC-SHA256 of "<timestamp>.<body>".
+func SignWebhook(secret, ts string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(ts))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// finishWebhookJob removes a delivered job, or queues it again with
+// exponential backoff, or moves it to the dead-letter queue.
+func finishWebhookJob(key []byte, job WebhookJob, sendErr error) error {
+	return bgrdb.Update(func(txn *badger.Txn) error {
+		if err := txn.Delete(key); err != nil {
+			return err
+		}
+		if sendErr == nil {
+			return nil
+		}
+
+		job.Attempts++
+		job.LastError = sendErr.Error()
+		maxAttempts := cfg().WebhookMaxAttempts
+		if maxAttempts < 1 {
+			maxAttempts = 1
+		}
+		if job.Attempts >= maxAttempts {
+			DebugWarn("webhook", "dead letter after ", job.Attempts, " attempts: ", job.URL, " ", job.LastError)
+			return putWebhookJob(txn, hookDLQKey(job.ID), job)
+		}
+
+		backoff := time.Second << min(job.Attempts, 12)
+		backoff += time.Duration(rand.Int64N(int64(backoff / 4)))
+		return putWebhookJob(txn, hookQueueKey(time.Now().Add(backoff), job.ID), job)
+	})
+}
+
+// WebhookDLQ lists dead letters, oldest first.
+func WebhookDLQ(limit int) ([]WebhookJob, error) {
+	if limit <= 0 {
+		limit = 1000
+	}
+	return readWebhookDLQ(InternalKey("hookdlq/"), limit)
+}
+
+// readWebhookDLQ reads up to limit dead letters from the key from.
+func readWebhookDLQ(from []byte, limit int) ([]WebhookJob, error) {
+	var jobs []WebhookJob
+	err := bgrdb.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = InternalKey("hookdlq/")
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		for it.Seek(from); it.Valid() && len(jobs) < limit; it.Next() {
+			job, err := readWebhookJob(it.Item())
+			if err != nil {
+				return err
+			}
+			jobs = append(jobs, job)
+		}
+		return nil
+	})
+	return jobs, err
+}
+
+// RetryWebhookDLQ queues dead letters again, all of them if id is 0, 1000
+// per txn. n counts the ones queued, also when a later batch failed. The
+// letters dead again meanwhile are not retried twice.
+func RetryWebhookDLQ(id uint64) (n int, err error) {
+	defer func() {
+		if n > 0 {
+			wakeWebhooks()
+		}
+	}()
+
+	from, limit := InternalKey("hookdlq/"), 1000
+	if id != 0 {
+		from, limit = hookDLQKey(id), 1
+	}
+	for {
+		jobs, err := readWebhookDLQ(from, limit)
+		if id != 0 && len(jobs) > 0 && jobs[0].ID != id {
+			jobs = nil
+		}
+		if err != nil || len(jobs) == 0 {
+			return n, err
+		}
+
+		err = badgerUpdate(func(txn *badger.Txn) error {
+			now := time.Now()
+			for _, job := range jobs {
+				if err := txn.Delete(hookDLQKey(job.ID)); err != nil {
+					return err
+				}
+				job.Attempts = 0
+				if err := putWebhookJob(txn, hookQueueKey(now, job.ID), job); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return n, err
+		}
+		n += len(jobs)
+		if len(jobs) < limit || id != 0 {
+			return n, nil
+		}
+		from = append(hookDLQKey(jobs[len(jobs)-1].ID), 0)
+	}
+}
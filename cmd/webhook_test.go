@@ -0,0 +1,141 @@
+package cmd
+
+import (
+	"encoding/json"
+	"testing"
+
+	badger "github.com/dgraph-io/badger/v4"
+)
+
+func queuedWebhookEvents(t *testing.T) []WebhookEvent {
+	t.Helper()
+	var events []WebhookEvent
+	err := bgrdb.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = InternalKey("hookq/")
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			job, err := readWebhookJob(it.Item())
+			if err != nil {
+				return err
+			}
+			var ev WebhookEvent
+			if err = json.Unmarshal(job.Payload, &ev); err != nil {
+				return err
+			}
+			events = append(events, ev)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return events
+}
+
+func keyVersion(t *testing.T, key string) uint64 {
+	t.Helper()
+	var ver uint64
+	err := bgrdb.View(func(txn *badger.Txn) error {
+		item, err := txn.Get([]byte(key))
+		if err == nil {
+			ver = item.Version()
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ver
+}
+
+func TestWebhooksQueuedWithWrite(t *testing.T) {
+	openTestDB(t, func(s *Settings) {
+		s.IsAllowOverWrite = true
+		s.webhooks = []Webhook{{URL: "http://127.0.0.1:1/hook", Prefixes: []string{"a/"}}}
+		s.namespaceQuotas = map[string]Quota{"a": {MaxKeys: 1}}
+	})
+
+	val := []byte("v1")
+	if _, err := badgerPut([]byte("a/1"), val, GetXxhash(val), SaveOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	// not matched, and refused by the quota: no job
+	if _, err := badgerPut([]byte("b/1"), val, GetXxhash(val), SaveOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := badgerPut([]byte("a/2"), val, GetXxhash(val), SaveOptions{}); err != ErrQuotaExceeded {
+		t.Fatalf("got %v, want the quota error", err)
+	}
+
+	events := queuedWebhookEvents(t)
+	if len(events) != 1 {
+		t.Fatalf("%d jobs queued, want 1", len(events))
+	}
+	ev := events[0]
+	if ev.Event != "set" || ev.Key != "a/1" || ev.Size != 2 || ev.Sum64 != GetXxhash(val) {
+		t.Errorf("unexpected event %+v", ev)
+	}
+	if want := keyVersion(t, "a/1"); ev.Version != want {
+		t.Errorf("version %d, want the commit version %d", ev.Version, want)
+	}
+
+	if _, _, err := badgerDelete([]byte("a/1")); err != nil {
+		t.Fatal(err)
+	}
+	if events = queuedWebhookEvents(t); len(events) != 2 || events[1].Event != "delete" || events[1].Version <= ev.Version {
+		t.Errorf("unexpected events after delete %+v", events)
+	}
+}
+
+func TestRetryWebhookDLQ(t *testing.T) {
+	openTestDB(t, nil)
+	const dead = 2500
+	for i := 0; i < dead; i += 500 {
+		err := bgrdb.Update(func(txn *badger.Txn) error {
+			for id := uint64(i + 1); id <= uint64(i+500); id++ {
+				job := WebhookJob{ID: id, URL: "http://127.0.0.1:1/hook", Attempts: 5}
+				if err := putWebhookJob(txn, hookDLQKey(id), job); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	queued := func() (n int) {
+		t.Helper()
+		err := bgrdb.View(func(txn *badger.Txn) error {
+			it := txn.NewIterator(badger.IteratorOptions{Prefix: InternalKey("hookq/")})
+			defer it.Close()
+			for it.Rewind(); it.Valid(); it.Next() {
+				n++
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+
+	if n, err := RetryWebhookDLQ(7); n != 1 || err != nil {
+		t.Fatalf("retried %d: %v", n, err)
+	}
+	if n, err := RetryWebhookDLQ(7); n != 0 || err != nil {
+		t.Fatalf("retried %d again: %v", n, err)
+	}
+	if n, err := RetryWebhookDLQ(0); n != dead-1 || err != nil {
+		t.Fatalf("retried %d: %v", n, err)
+	}
+	if n := queued(); n != dead {
+		t.Errorf("%d jobs queued, want %d", n, dead)
+	}
+	if jobs, _ := WebhookDLQ(0); len(jobs) != 0 {
+		t.Errorf("%d dead letters left", len(jobs))
+	}
+}
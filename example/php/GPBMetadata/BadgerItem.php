@@ -16,7 +16,7 @@ class BadgerItem
           return;
         }
         $pool->internalAddGeneratedFile(
-            "\x0A\xB7\x04\x0A\x10badgerItem.proto\"?\x0A\x04Item\x12\x0B\x0A\x03key\x18\x01 \x01(\x0C\x12\x0C\x0A\x04data\x18\x02 \x01(\x0C\x12\x0D\x0A\x05ver64\x18\x03 \x01(\x04\x12\x0D\x0A\x05sum64\x18\x04 \x01(\x04\"e\x0A\x09ItemReply\x12\x0F\x0A\x07errcode\x18\x01 \x01(\x05\x12\x0E\x0A\x06status\x18\x02 \x01(\x0C\x12\x0B\x0A\x03key\x18\x03 \x01(\x0C\x12\x0C\x0A\x04data\x18\x04 \x01(\x0C\x12\x0D\x0A\x05ver64\x18\x05 \x01(\x04\x12\x0D\x0A\x05sum64\x18\x06 \x01(\x04\"-\x0A\x0AListFilter\x12\x0E\x0A\x06prefix\x18\x01 \x01(\x09\x12\x0F\x0A\x07pagenum\x18\x02 \x01(\x05\"\x1F\x0A\x0FListFilterReply\x12\x0C\x0A\x04keys\x18\x01 \x03(\x092\x80\x02\x0A\x06Badger\x12\x1A\x0A\x03Get\x12\x05.Item\x1A\x0A.ItemReply\"\x00\x12\x1A\x0A\x03Set\x12\x05.Item\x1A\x0A.ItemReply\"\x00\x12\x1D\x0A\x06Delete\x12\x05.Item\x1A\x0A.ItemReply\"\x00\x12\x1D\x0A\x06Exists\x12\x05.Item\x1A\x0A.ItemReply\"\x00\x12\x1C\x0A\x05Count\x12\x05.Item\x1A\x0A.ItemReply\"\x00\x12\x1C\x0A\x05Admin\x12\x05.Item\x1A\x0A.ItemReply\"\x00\x12\x1B\x0A\x04Ping\x12\x05.Item\x1A\x0A.ItemReply\"\x00\x12'\x0A\x04List\x12\x0B.ListFilter\x1A\x10.ListFilterReply\"\x00B Z\x1Egithub.com/harryzhu/zstdfs/pbsb\x06proto3"
+            "\x0A\xA9\x09\x0A\x10badgerItem.proto\"?\x0A\x04Item\x12\x0B\x0A\x03key\x18\x01 \x01(\x0C\x12\x0C\x0A\x04data\x18\x02 \x01(\x0C\x12\x0D\x0A\x05ver64\x18\x03 \x01(\x04\x12\x0D\x0A\x05sum64\x18\x04 \x01(\x04\"e\x0A\x09ItemReply\x12\x0F\x0A\x07errcode\x18\x01 \x01(\x05\x12\x0E\x0A\x06status\x18\x02 \x01(\x0C\x12\x0B\x0A\x03key\x18\x03 \x01(\x0C\x12\x0C\x0A\x04data\x18\x04 \x01(\x0C\x12\x0D\x0A\x05ver64\x18\x05 \x01(\x04\x12\x0D\x0A\x05sum64\x18\x06 \x01(\x04\";\x0A\x0CRangeRequest\x12\x0B\x0A\x03key\x18\x01 \x01(\x0C\x12\x0E\x0A\x06offset\x18\x02 \x01(\x04\x12\x0E\x0A\x06length\x18\x03 \x01(\x04\"-\x0A\x0AListFilter\x12\x0E\x0A\x06prefix\x18\x01 \x01(\x09\x12\x0F\x0A\x07pagenum\x18\x02 \x01(\x05\"\x1F\x0A\x0FListFilterReply\x12\x0C\x0A\x04keys\x18\x01 \x03(\x09\"/\x0A\x0CWatchRequest\x12\x10\x0A\x08prefixes\x18\x01 \x03(\x09\x12\x0D\x0A\x05since\x18\x02 \x01(\x04\"g\x0A\x0AWatchEvent\x12\x0C\x0A\x04type\x18\x01 \x01(\x09\x12\x0B\x0A\x03key\x18\x02 \x01(\x0C\x12\x0D\x0A\x05ver64\x18\x03 \x01(\x04\x12\x0C\x0A\x04size\x18\x04 \x01(\x04\x12\x0D\x0A\x05sum64\x18\x05 \x01(\x04\x12\x12\x0A\x0Aunix_milli\x18\x06 \x01(\x03\"\\\x0A\x05TxnOp\x12\x0A\x0A\x02op\x18\x01 \x01(\x09\x12\x0B\x0A\x03key\x18\x02 \x01(\x0C\x12\x0C\x0A\x04data\x18\x03 \x01(\x0C\x12\x0D\x0A\x05sum64\x18\x04 \x01(\x04\x12\x0D\x0A\x05ver64\x18\x05 \x01(\x04\x12\x0E\x0A\x06exists\x18\x06 \x01(\x05\"!\x0A\x0ATxnRequest\x12\x13\x0A\x03ops\x18\x01 \x03(\x0B2\x06.TxnOp\"J\x0A\x0BTxnOpResult\x12\x0F\x0A\x07errcode\x18\x01 \x01(\x05\x12\x0E\x0A\x06status\x18\x02 \x01(\x0C\x12\x0B\x0A\x03key\x18\x03 \x01(\x0C\x12\x0D\x0A\x05ver64\x18\x04 \x01(\x04\"Y\x0A\x08TxnReply\x12\x0F\x0A\x07errcode\x18\x01 \x01(\x05\x12\x0E\x0A\x06status\x18\x02 \x01(\x0C\x12\x1D\x0A\x07results\x18\x03 \x03(\x0B2\x0C.TxnOpResult\x12\x0D\x0A\x05ver64\x18\x04 \x01(\x042\xF3\x02\x0A\x06Badger\x12\x1A\x0A\x03Get\x12\x05.Item\x1A\x0A.ItemReply\"\x00\x12'\x0A\x08GetRange\x12\x0D.RangeRequest\x1A\x0A.ItemReply\"\x00\x12\x1A\x0A\x03Set\x12\x05.Item\x1A\x0A.ItemReply\"\x00\x12\x1D\x0A\x06Delete\x12\x05.Item\x1A\x0A.ItemReply\"\x00\x12\x1D\x0A\x06Exists\x12\x05.Item\x1A\x0A.ItemReply\"\x00\x12\x1C\x0A\x05Count\x12\x05.Item\x1A\x0A.ItemReply\"\x00\x12\x1C\x0A\x05Admin\x12\x05.Item\x1A\x0A.ItemReply\"\x00\x12\x1B\x0A\x04Ping\x12\x05.Item\x1A\x0A.ItemReply\"\x00\x12'\x0A\x04List\x12\x0B.ListFilter\x1A\x10.ListFilterReply\"\x00\x12'\x0A\x05Watch\x12\x0D.WatchRequest\x1A\x0B.WatchEvent\"\x000\x01\x12\x1F\x0A\x03Txn\x12\x0B.TxnRequest\x1A\x09.TxnReply\"\x00B Z\x1Egithub.com/harryzhu/zstdfs/pbsb\x06proto3"
         , true);
 
         static::$is_initialized = true;
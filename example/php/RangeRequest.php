@@ -0,0 +1,114 @@
+<?php
+# Generated by the protocol buffer compiler.  DO NOT EDIT!
+# NO CHECKED-IN PROTOBUF GENCODE
+# source: badgerItem.proto
+
+use Google\Protobuf\Internal\GPBType;
+use Google\Protobuf\Internal\RepeatedField;
+use Google\Protobuf\Internal\GPBUtil;
+
+/**
+ * GetRange reads length bytes of the value of key from offset, length 0
+ * reads to the end.
+ *
+ * Generated from protobuf message <code>RangeRequest</code>
+ */
+class RangeRequest extends \Google\Protobuf\Internal\Message
+{
+    /**
+     * Generated from protobuf field <code>bytes key = 1;</code>
+     */
+    protected $key = '';
+    /**
+     * Generated from protobuf field <code>uint64 offset = 2;</code>
+     */
+    protected $offset = 0;
+    /**
+     * Generated from protobuf field <code>uint64 length = 3;</code>
+     */
+    protected $length = 0;
+
+    /**
+     * Constructor.
+     *
+     * @param array $data {
+     *     Optional. Data for populating the Message object.
+     *
+     *     @type string $key
+     *     @type int|string $offset
+     *     @type int|string $length
+     * }
+     */
+    public function __construct($data = NULL) {
+        \GPBMetadata\BadgerItem::initOnce();
+        parent::__construct($data);
+    }
+
+    /**
+     * Generated from protobuf field <code>bytes key = 1;</code>
+     * @return string
+     */
+    public function getKey()
+    {
+        return $this->key;
+    }
+
+    /**
+     * Generated from protobuf field <code>bytes key = 1;</code>
+     * @param string $var
+     * @return $this
+     */
+    public function setKey($var)
+    {
+        GPBUtil::checkString($var, False);
+        $this->key = $var;
+
+        return $this;
+    }
+
+    /**
+     * Generated from protobuf field <code>uint64 offset = 2;</code>
+     * @return int|string
+     */
+    public function getOffset()
+    {
+        return $this->offset;
+    }
+
+    /**
+     * Generated from protobuf field <code>uint64 offset = 2;</code>
+     * @param int|string $var
+     * @return $this
+     */
+    public function setOffset($var)
+    {
+        GPBUtil::checkUint64($var);
+        $this->offset = $var;
+
+        return $this;
+    }
+
+    /**
+     * Generated from protobuf field <code>uint64 length = 3;</code>
+     * @return int|string
+     */
+    public function getLength()
+    {
+        return $this->length;
+    }
+
+    /**
+     * Generated from protobuf field <code>uint64 length = 3;</code>
+     * @param int|string $var
+     * @return $this
+     */
+    public function setLength($var)
+    {
+        GPBUtil::checkUint64($var);
+        $this->length = $var;
+
+        return $this;
+    }
+
+}
+
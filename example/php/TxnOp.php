@@ -0,0 +1,195 @@
+<?php
+# Generated by the protocol buffer compiler.  DO NOT EDIT!
+# NO CHECKED-IN PROTOBUF GENCODE
+# source: badgerItem.proto
+
+use Google\Protobuf\Internal\GPBType;
+use Google\Protobuf\Internal\RepeatedField;
+use Google\Protobuf\Internal\GPBUtil;
+
+/**
+ * op is "put", "delete" or "check". A check needs the key at version ver64
+ * (if not 0) and, with exists 1/-1, the key to exist or not.
+ *
+ * Generated from protobuf message <code>TxnOp</code>
+ */
+class TxnOp extends \Google\Protobuf\Internal\Message
+{
+    /**
+     * Generated from protobuf field <code>string op = 1;</code>
+     */
+    protected $op = '';
+    /**
+     * Generated from protobuf field <code>bytes key = 2;</code>
+     */
+    protected $key = '';
+    /**
+     * Generated from protobuf field <code>bytes data = 3;</code>
+     */
+    protected $data = '';
+    /**
+     * Generated from protobuf field <code>uint64 sum64 = 4;</code>
+     */
+    protected $sum64 = 0;
+    /**
+     * Generated from protobuf field <code>uint64 ver64 = 5;</code>
+     */
+    protected $ver64 = 0;
+    /**
+     * Generated from protobuf field <code>int32 exists = 6;</code>
+     */
+    protected $exists = 0;
+
+    /**
+     * Constructor.
+     *
+     * @param array $data {
+     *     Optional. Data for populating the Message object.
+     *
+     *     @type string $op
+     *     @type string $key
+     *     @type string $data
+     *     @type int|string $sum64
+     *     @type int|string $ver64
+     *     @type int $exists
+     * }
+     */
+    public function __construct($data = NULL) {
+        \GPBMetadata\BadgerItem::initOnce();
+        parent::__construct($data);
+    }
+
+    /**
+     * Generated from protobuf field <code>string op = 1;</code>
+     * @return string
+     */
+    public function getOp()
+    {
+        return $this->op;
+    }
+
+    /**
+     * Generated from protobuf field <code>string op = 1;</code>
+     * @param string $var
+     * @return $this
+     */
+    public function setOp($var)
+    {
+        GPBUtil::checkString($var, True);
+        $this->op = $var;
+
+        return $this;
+    }
+
+    /**
+     * Generated from protobuf field <code>bytes key = 2;</code>
+     * @return string
+     */
+    public function getKey()
+    {
+        return $this->key;
+    }
+
+    /**
+     * Generated from protobuf field <code>bytes key = 2;</code>
+     * @param string $var
+     * @return $this
+     */
+    public function setKey($var)
+    {
+        GPBUtil::checkString($var, False);
+        $this->key = $var;
+
+        return $this;
+    }
+
+    /**
+     * Generated from protobuf field <code>bytes data = 3;</code>
+     * @return string
+     */
+    public function getData()
+    {
+        return $this->data;
+    }
+
+    /**
+     * Generated from protobuf field <code>bytes data = 3;</code>
+     * @param string $var
+     * @return $this
+     */
+    public function setData($var)
+    {
+        GPBUtil::checkString($var, False);
+        $this->data = $var;
+
+        return $this;
+    }
+
+    /**
+     * Generated from protobuf field <code>uint64 sum64 = 4;</code>
+     * @return int|string
+     */
+    public function getSum64()
+    {
+        return $this->sum64;
+    }
+
+    /**
+     * Generated from protobuf field <code>uint64 sum64 = 4;</code>
+     * @param int|string $var
+     * @return $this
+     */
+    public function setSum64($var)
+    {
+        GPBUtil::checkUint64($var);
+        $this->sum64 = $var;
+
+        return $this;
+    }
+
+    /**
+     * Generated from protobuf field <code>uint64 ver64 = 5;</code>
+     * @return int|string
+     */
+    public function getVer64()
+    {
+        return $this->ver64;
+    }
+
+    /**
+     * Generated from protobuf field <code>uint64 ver64 = 5;</code>
+     * @param int|string $var
+     * @return $this
+     */
+    public function setVer64($var)
+    {
+        GPBUtil::checkUint64($var);
+        $this->ver64 = $var;
+
+        return $this;
+    }
+
+    /**
+     * Generated from protobuf field <code>int32 exists = 6;</code>
+     * @return int
+     */
+    public function getExists()
+    {
+        return $this->exists;
+    }
+
+    /**
+     * Generated from protobuf field <code>int32 exists = 6;</code>
+     * @param int $var
+     * @return $this
+     */
+    public function setExists($var)
+    {
+        GPBUtil::checkInt32($var);
+        $this->exists = $var;
+
+        return $this;
+    }
+
+}
+
@@ -0,0 +1,138 @@
+<?php
+# Generated by the protocol buffer compiler.  DO NOT EDIT!
+# NO CHECKED-IN PROTOBUF GENCODE
+# source: badgerItem.proto
+
+use Google\Protobuf\Internal\GPBType;
+use Google\Protobuf\Internal\RepeatedField;
+use Google\Protobuf\Internal\GPBUtil;
+
+/**
+ * Generated from protobuf message <code>TxnOpResult</code>
+ */
+class TxnOpResult extends \Google\Protobuf\Internal\Message
+{
+    /**
+     * Generated from protobuf field <code>int32 errcode = 1;</code>
+     */
+    protected $errcode = 0;
+    /**
+     * Generated from protobuf field <code>bytes status = 2;</code>
+     */
+    protected $status = '';
+    /**
+     * Generated from protobuf field <code>bytes key = 3;</code>
+     */
+    protected $key = '';
+    /**
+     * Generated from protobuf field <code>uint64 ver64 = 4;</code>
+     */
+    protected $ver64 = 0;
+
+    /**
+     * Constructor.
+     *
+     * @param array $data {
+     *     Optional. Data for populating the Message object.
+     *
+     *     @type int $errcode
+     *     @type string $status
+     *     @type string $key
+     *     @type int|string $ver64
+     * }
+     */
+    public function __construct($data = NULL) {
+        \GPBMetadata\BadgerItem::initOnce();
+        parent::__construct($data);
+    }
+
+    /**
+     * Generated from protobuf field <code>int32 errcode = 1;</code>
+     * @return int
+     */
+    public function getErrcode()
+    {
+        return $this->errcode;
+    }
+
+    /**
+     * Generated from protobuf field <code>int32 errcode = 1;</code>
+     * @param int $var
+     * @return $this
+     */
+    public function setErrcode($var)
+    {
+        GPBUtil::checkInt32($var);
+        $this->errcode = $var;
+
+        return $this;
+    }
+
+    /**
+     * Generated from protobuf field <code>bytes status = 2;</code>
+     * @return string
+     */
+    public function getStatus()
+    {
+        return $this->status;
+    }
+
+    /**
+     * Generated from protobuf field <code>bytes status = 2;</code>
+     * @param string $var
+     * @return $this
+     */
+    public function setStatus($var)
+    {
+        GPBUtil::checkString($var, False);
+        $this->status = $var;
+
+        return $this;
+    }
+
+    /**
+     * Generated from protobuf field <code>bytes key = 3;</code>
+     * @return string
+     */
+    public function getKey()
+    {
+        return $this->key;
+    }
+
+    /**
+     * Generated from protobuf field <code>bytes key = 3;</code>
+     * @param string $var
+     * @return $this
+     */
+    public function setKey($var)
+    {
+        GPBUtil::checkString($var, False);
+        $this->key = $var;
+
+        return $this;
+    }
+
+    /**
+     * Generated from protobuf field <code>uint64 ver64 = 4;</code>
+     * @return int|string
+     */
+    public function getVer64()
+    {
+        return $this->ver64;
+    }
+
+    /**
+     * Generated from protobuf field <code>uint64 ver64 = 4;</code>
+     * @param int|string $var
+     * @return $this
+     */
+    public function setVer64($var)
+    {
+        GPBUtil::checkUint64($var);
+        $this->ver64 = $var;
+
+        return $this;
+    }
+
+}
+
@@ -0,0 +1,141 @@
+<?php
+# Generated by the protocol buffer compiler.  DO NOT EDIT!
+# NO CHECKED-IN PROTOBUF GENCODE
+# source: badgerItem.proto
+
+use Google\Protobuf\Internal\GPBType;
+use Google\Protobuf\Internal\RepeatedField;
+use Google\Protobuf\Internal\GPBUtil;
+
+/**
+ * errcode is 0 if every op is applied, none is applied otherwise;
+ * 409 means a conflict with another write, retry the whole Txn.
+ *
+ * Generated from protobuf message <code>TxnReply</code>
+ */
+class TxnReply extends \Google\Protobuf\Internal\Message
+{
+    /**
+     * Generated from protobuf field <code>int32 errcode = 1;</code>
+     */
+    protected $errcode = 0;
+    /**
+     * Generated from protobuf field <code>bytes status = 2;</code>
+     */
+    protected $status = '';
+    /**
+     * Generated from protobuf field <code>repeated .TxnOpResult results = 3;</code>
+     */
+    private $results;
+    /**
+     * Generated from protobuf field <code>uint64 ver64 = 4;</code>
+     */
+    protected $ver64 = 0;
+
+    /**
+     * Constructor.
+     *
+     * @param array $data {
+     *     Optional. Data for populating the Message object.
+     *
+     *     @type int $errcode
+     *     @type string $status
+     *     @type array<\TxnOpResult>|\Google\Protobuf\Internal\RepeatedField $results
+     *     @type int|string $ver64
+     * }
+     */
+    public function __construct($data = NULL) {
+        \GPBMetadata\BadgerItem::initOnce();
+        parent::__construct($data);
+    }
+
+    /**
+     * Generated from protobuf field <code>int32 errcode = 1;</code>
+     * @return int
+     */
+    public function getErrcode()
+    {
+        return $this->errcode;
+    }
+
+    /**
+     * Generated from protobuf field <code>int32 errcode = 1;</code>
+     * @param int $var
+     * @return $this
+     */
+    public function setErrcode($var)
+    {
+        GPBUtil::checkInt32($var);
+        $this->errcode = $var;
+
+        return $this;
+    }
+
+    /**
+     * Generated from protobuf field <code>bytes status = 2;</code>
+     * @return string
+     */
+    public function getStatus()
+    {
+        return $this->status;
+    }
+
+    /**
+     * Generated from protobuf field <code>bytes status = 2;</code>
+     * @param string $var
+     * @return $this
+     */
+    public function setStatus($var)
+    {
+        GPBUtil::checkString($var, False);
+        $this->status = $var;
+
+        return $this;
+    }
+
+    /**
+     * Generated from protobuf field <code>repeated .TxnOpResult results = 3;</code>
+     * @return \Google\Protobuf\Internal\RepeatedField
+     */
+    public function getResults()
+    {
+        return $this->results;
+    }
+
+    /**
+     * Generated from protobuf field <code>repeated .TxnOpResult results = 3;</code>
+     * @param array<\TxnOpResult>|\Google\Protobuf\Internal\RepeatedField $var
+     * @return $this
+     */
+    public function setResults($var)
+    {
+        $arr = GPBUtil::checkRepeatedField($var, \Google\Protobuf\Internal\GPBType::MESSAGE, \TxnOpResult::class);
+        $this->results = $arr;
+
+        return $this;
+    }
+
+    /**
+     * Generated from protobuf field <code>uint64 ver64 = 4;</code>
+     * @return int|string
+     */
+    public function getVer64()
+    {
+        return $this->ver64;
+    }
+
+    /**
+     * Generated from protobuf field <code>uint64 ver64 = 4;</code>
+     * @param int|string $var
+     * @return $this
+     */
+    public function setVer64($var)
+    {
+        GPBUtil::checkUint64($var);
+        $this->ver64 = $var;
+
+        return $this;
+    }
+
+}
+
@@ -0,0 +1,57 @@
+<?php
+# Generated by the protocol buffer compiler.  DO NOT EDIT!
+# NO CHECKED-IN PROTOBUF GENCODE
+# source: badgerItem.proto
+
+use Google\Protobuf\Internal\GPBType;
+use Google\Protobuf\Internal\RepeatedField;
+use Google\Protobuf\Internal\GPBUtil;
+
+/**
+ * Generated from protobuf message <code>TxnRequest</code>
+ */
+class TxnRequest extends \Google\Protobuf\Internal\Message
+{
+    /**
+     * Generated from protobuf field <code>repeated .TxnOp ops = 1;</code>
+     */
+    private $ops;
+
+    /**
+     * Constructor.
+     *
+     * @param array $data {
+     *     Optional. Data for populating the Message object.
+     *
+     *     @type array<\TxnOp>|\Google\Protobuf\Internal\RepeatedField $ops
+     * }
+     */
+    public function __construct($data = NULL) {
+        \GPBMetadata\BadgerItem::initOnce();
+        parent::__construct($data);
+    }
+
+    /**
+     * Generated from protobuf field <code>repeated .TxnOp ops = 1;</code>
+     * @return \Google\Protobuf\Internal\RepeatedField
+     */
+    public function getOps()
+    {
+        return $this->ops;
+    }
+
+    /**
+     * Generated from protobuf field <code>repeated .TxnOp ops = 1;</code>
+     * @param array<\TxnOp>|\Google\Protobuf\Internal\RepeatedField $var
+     * @return $this
+     */
+    public function setOps($var)
+    {
+        $arr = GPBUtil::checkRepeatedField($var, \Google\Protobuf\Internal\GPBType::MESSAGE, \TxnOp::class);
+        $this->ops = $arr;
+
+        return $this;
+    }
+
+}
+
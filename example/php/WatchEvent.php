@@ -0,0 +1,196 @@
+<?php
+# Generated by the protocol buffer compiler.  DO NOT EDIT!
+# NO CHECKED-IN PROTOBUF GENCODE
+# source: badgerItem.proto
+
+use Google\Protobuf\Internal\GPBType;
+use Google\Protobuf\Internal\RepeatedField;
+use Google\Protobuf\Internal\GPBUtil;
+
+/**
+ * type is "set", "delete", or "synced" once the events before ver64 are
+ * sent; change logs of older versions may hold "delete-prefix" (key is the
+ * prefix).
+ *
+ * Generated from protobuf message <code>WatchEvent</code>
+ */
+class WatchEvent extends \Google\Protobuf\Internal\Message
+{
+    /**
+     * Generated from protobuf field <code>string type = 1;</code>
+     */
+    protected $type = '';
+    /**
+     * Generated from protobuf field <code>bytes key = 2;</code>
+     */
+    protected $key = '';
+    /**
+     * Generated from protobuf field <code>uint64 ver64 = 3;</code>
+     */
+    protected $ver64 = 0;
+    /**
+     * Generated from protobuf field <code>uint64 size = 4;</code>
+     */
+    protected $size = 0;
+    /**
+     * Generated from protobuf field <code>uint64 sum64 = 5;</code>
+     */
+    protected $sum64 = 0;
+    /**
+     * Generated from protobuf field <code>int64 unix_milli = 6;</code>
+     */
+    protected $unix_milli = 0;
+
+    /**
+     * Constructor.
+     *
+     * @param array $data {
+     *     Optional. Data for populating the Message object.
+     *
+     *     @type string $type
+     *     @type string $key
+     *     @type int|string $ver64
+     *     @type int|string $size
+     *     @type int|string $sum64
+     *     @type int|string $unix_milli
+     * }
+     */
+    public function __construct($data = NULL) {
+        \GPBMetadata\BadgerItem::initOnce();
+        parent::__construct($data);
+    }
+
+    /**
+     * Generated from protobuf field <code>string type = 1;</code>
+     * @return string
+     */
+    public function getType()
+    {
+        return $this->type;
+    }
+
+    /**
+     * Generated from protobuf field <code>string type = 1;</code>
+     * @param string $var
+     * @return $this
+     */
+    public function setType($var)
+    {
+        GPBUtil::checkString($var, True);
+        $this->type = $var;
+
+        return $this;
+    }
+
+    /**
+     * Generated from protobuf field <code>bytes key = 2;</code>
+     * @return string
+     */
+    public function getKey()
+    {
+        return $this->key;
+    }
+
+    /**
+     * Generated from protobuf field <code>bytes key = 2;</code>
+     * @param string $var
+     * @return $this
+     */
+    public function setKey($var)
+    {
+        GPBUtil::checkString($var, False);
+        $this->key = $var;
+
+        return $this;
+    }
+
+    /**
+     * Generated from protobuf field <code>uint64 ver64 = 3;</code>
+     * @return int|string
+     */
+    public function getVer64()
+    {
+        return $this->ver64;
+    }
+
+    /**
+     * Generated from protobuf field <code>uint64 ver64 = 3;</code>
+     * @param int|string $var
+     * @return $this
+     */
+    public function setVer64($var)
+    {
+        GPBUtil::checkUint64($var);
+        $this->ver64 = $var;
+
+        return $this;
+    }
+
+    /**
+     * Generated from protobuf field <code>uint64 size = 4;</code>
+     * @return int|string
+     */
+    public function getSize()
+    {
+        return $this->size;
+    }
+
+    /**
+     * Generated from protobuf field <code>uint64 size = 4;</code>
+     * @param int|string $var
+     * @return $this
+     */
+    public function setSize($var)
+    {
+        GPBUtil::checkUint64($var);
+        $this->size = $var;
+
+        return $this;
+    }
+
+    /**
+     * Generated from protobuf field <code>uint64 sum64 = 5;</code>
+     * @return int|string
+     */
+    public function getSum64()
+    {
+        return $this->sum64;
+    }
+
+    /**
+     * Generated from protobuf field <code>uint64 sum64 = 5;</code>
+     * @param int|string $var
+     * @return $this
+     */
+    public function setSum64($var)
+    {
+        GPBUtil::checkUint64($var);
+        $this->sum64 = $var;
+
+        return $this;
+    }
+
+    /**
+     * Generated from protobuf field <code>int64 unix_milli = 6;</code>
+     * @return int|string
+     */
+    public function getUnixMilli()
+    {
+        return $this->unix_milli;
+    }
+
+    /**
+     * Generated from protobuf field <code>int64 unix_milli = 6;</code>
+     * @param int|string $var
+     * @return $this
+     */
+    public function setUnixMilli($var)
+    {
+        GPBUtil::checkInt64($var);
+        $this->unix_milli = $var;
+
+        return $this;
+    }
+
+}
+
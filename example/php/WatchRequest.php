@@ -0,0 +1,87 @@
+<?php
+# Generated by the protocol buffer compiler.  DO NOT EDIT!
+# NO CHECKED-IN PROTOBUF GENCODE
+# source: badgerItem.proto
+
+use Google\Protobuf\Internal\GPBType;
+use Google\Protobuf\Internal\RepeatedField;
+use Google\Protobuf\Internal\GPBUtil;
+
+/**
+ * Watch sends the Set/Delete events of keys starting with one of prefixes
+ * (all keys if empty), after version since (only new events if 0).
+ *
+ * Generated from protobuf message <code>WatchRequest</code>
+ */
+class WatchRequest extends \Google\Protobuf\Internal\Message
+{
+    /**
+     * Generated from protobuf field <code>repeated string prefixes = 1;</code>
+     */
+    private $prefixes;
+    /**
+     * Generated from protobuf field <code>uint64 since = 2;</code>
+     */
+    protected $since = 0;
+
+    /**
+     * Constructor.
+     *
+     * @param array $data {
+     *     Optional. Data for populating the Message object.
+     *
+     *     @type array<string>|\Google\Protobuf\Internal\RepeatedField $prefixes
+     *     @type int|string $since
+     * }
+     */
+    public function __construct($data = NULL) {
+        \GPBMetadata\BadgerItem::initOnce();
+        parent::__construct($data);
+    }
+
+    /**
+     * Generated from protobuf field <code>repeated string prefixes = 1;</code>
+     * @return \Google\Protobuf\Internal\RepeatedField
+     */
+    public function getPrefixes()
+    {
+        return $this->prefixes;
+    }
+
+    /**
+     * Generated from protobuf field <code>repeated string prefixes = 1;</code>
+     * @param array<string>|\Google\Protobuf\Internal\RepeatedField $var
+     * @return $this
+     */
+    public function setPrefixes($var)
+    {
+        $arr = GPBUtil::checkRepeatedField($var, \Google\Protobuf\Internal\GPBType::STRING);
+        $this->prefixes = $arr;
+
+        return $this;
+    }
+
+    /**
+     * Generated from protobuf field <code>uint64 since = 2;</code>
+     * @return int|string
+     */
+    public function getSince()
+    {
+        return $this->since;
+    }
+
+    /**
+     * Generated from protobuf field <code>uint64 since = 2;</code>
+     * @param int|string $var
+     * @return $this
+     */
+    public function setSince($var)
+    {
+        GPBUtil::checkUint64($var);
+        $this->since = $var;
+
+        return $this;
+    }
+
+}
+
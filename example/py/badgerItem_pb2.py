@@ -24,7 +24,7 @@ _sym_db = _symbol_database.Default()
 
 
 
-DESCRIPTOR = _descriptor_pool.Default().AddSerializedFile(b'\n\x10\x62\x61\x64gerItem.proto\"?\n\x04Item\x12\x0b\n\x03key\x18\x01 \x01(\x0c\x12\x0c\n\x04\x64\x61ta\x18\x02 \x01(\x0c\x12\r\n\x05ver64\x18\x03 \x01(\x04\x12\r\n\x05sum64\x18\x04 \x01(\x04\"e\n\tItemReply\x12\x0f\n\x07\x65rrcode\x18\x01 \x01(\x05\x12\x0e\n\x06status\x18\x02 \x01(\x0c\x12\x0b\n\x03key\x18\x03 \x01(\x0c\x12\x0c\n\x04\x64\x61ta\x18\x04 \x01(\x0c\x12\r\n\x05ver64\x18\x05 \x01(\x04\x12\r\n\x05sum64\x18\x06 \x01(\x04\"-\n\nListFilter\x12\x0e\n\x06prefix\x18\x01 \x01(\t\x12\x0f\n\x07pagenum\x18\x02 \x01(\x05\"\x1f\n\x0fListFilterReply\x12\x0c\n\x04keys\x18\x01 \x03(\t2\x80\x02\n\x06\x42\x61\x64ger\x12\x1a\n\x03Get\x12\x05.Item\x1a\n.ItemReply\"\x00\x12\x1a\n\x03Set\x12\x05.Item\x1a\n.ItemReply\"\x00\x12\x1d\n\x06\x44\x65lete\x12\x05.Item\x1a\n.ItemReply\"\x00\x12\x1d\n\x06\x45xists\x12\x05.Item\x1a\n.ItemReply\"\x00\x12\x1c\n\x05\x43ount\x12\x05.Item\x1a\n.ItemReply\"\x00\x12\x1c\n\x05\x41\x64min\x12\x05.Item\x1a\n.ItemReply\"\x00\x12\x1b\n\x04Ping\x12\x05.Item\x1a\n.ItemReply\"\x00\x12\'\n\x04List\x12\x0b.ListFilter\x1a\x10.ListFilterReply\"\x00\x42 Z\x1egithub.com/harryzhu/zstdfs/pbsb\x06proto3')
+DESCRIPTOR = _descriptor_pool.Default().AddSerializedFile(b'\n\x10\x62\x61\x64gerItem.proto\"?\n\x04Item\x12\x0b\n\x03key\x18\x01 \x01(\x0c\x12\x0c\n\x04\x64\x61ta\x18\x02 \x01(\x0c\x12\r\n\x05ver64\x18\x03 \x01(\x04\x12\r\n\x05sum64\x18\x04 \x01(\x04\"e\n\tItemReply\x12\x0f\n\x07\x65rrcode\x18\x01 \x01(\x05\x12\x0e\n\x06status\x18\x02 \x01(\x0c\x12\x0b\n\x03key\x18\x03 \x01(\x0c\x12\x0c\n\x04\x64\x61ta\x18\x04 \x01(\x0c\x12\r\n\x05ver64\x18\x05 \x01(\x04\x12\r\n\x05sum64\x18\x06 \x01(\x04\";\n\x0cRangeRequest\x12\x0b\n\x03key\x18\x01 \x01(\x0c\x12\x0e\n\x06offset\x18\x02 \x01(\x04\x12\x0e\n\x06length\x18\x03 \x01(\x04\"-\n\nListFilter\x12\x0e\n\x06prefix\x18\x01 \x01(\t\x12\x0f\n\x07pagenum\x18\x02 \x01(\x05\"\x1f\n\x0fListFilterReply\x12\x0c\n\x04keys\x18\x01 \x03(\t\"/\n\x0cWatchRequest\x12\x10\n\x08prefixes\x18\x01 \x03(\t\x12\r\n\x05since\x18\x02 \x01(\x04\"g\n\nWatchEvent\x12\x0c\n\x04type\x18\x01 \x01(\t\x12\x0b\n\x03key\x18\x02 \x01(\x0c\x12\r\n\x05ver64\x18\x03 \x01(\x04\x12\x0c\n\x04size\x18\x04 \x01(\x04\x12\r\n\x05sum64\x18\x05 \x01(\x04\x12\x12\n\nunix_milli\x18\x06 \x01(\x03\"\\\n\x05TxnOp\x12\n\n\x02op\x18\x01 \x01(\t\x12\x0b\n\x03key\x18\x02 \x01(\x0c\x12\x0c\n\x04\x64\x61ta\x18\x03 \x01(\x0c\x12\r\n\x05sum64\x18\x04 \x01(\x04\x12\r\n\x05ver64\x18\x05 \x01(\x04\x12\x0e\n\x06\x65xists\x18\x06 \x01(\x05\"!\n\nTxnRequest\x12\x13\n\x03ops\x18\x01 \x03(\x0b\x32\x06.TxnOp\"J\n\x0bTxnOpResult\x12\x0f\n\x07\x65rrcode\x18\x01 \x01(\x05\x12\x0e\n\x06status\x18\x02 \x01(\x0c\x12\x0b\n\x03key\x18\x03 \x01(\x0c\x12\r\n\x05ver64\x18\x04 \x01(\x04\"Y\n\x08TxnReply\x12\x0f\n\x07\x65rrcode\x18\x01 \x01(\x05\x12\x0e\n\x06status\x18\x02 \x01(\x0c\x12\x1d\n\x07results\x18\x03 \x03(\x0b\x32\x0c.TxnOpResult\x12\r\n\x05ver64\x18\x04 \x01(\x04\x32\xf3\x02\n\x06\x42\x61\x64ger\x12\x1a\n\x03Get\x12\x05.Item\x1a\n.ItemReply\"\x00\x12\'\n\x08GetRange\x12\r.RangeRequest\x1a\n.ItemReply\"\x00\x12\x1a\n\x03Set\x12\x05.Item\x1a\n.ItemReply\"\x00\x12\x1d\n\x06\x44\x65lete\x12\x05.Item\x1a\n.ItemReply\"\x00\x12\x1d\n\x06\x45xists\x12\x05.Item\x1a\n.ItemReply\"\x00\x12\x1c\n\x05\x43ount\x12\x05.Item\x1a\n.ItemReply\"\x00\x12\x1c\n\x05\x41\x64min\x12\x05.Item\x1a\n.ItemReply\"\x00\x12\x1b\n\x04Ping\x12\x05.Item\x1a\n.ItemReply\"\x00\x12\'\n\x04List\x12\x0b.ListFilter\x1a\x10.ListFilterReply\"\x00\x12\'\n\x05Watch\x12\r.WatchRequest\x1a\x0b.WatchEvent\"\x00\x30\x01\x12\x1f\n\x03Txn\x12\x0b.TxnRequest\x1a\t.TxnReply\"\x00\x42 Z\x1egithub.com/harryzhu/zstdfs/pbsb\x06proto3')
 
 _globals = globals()
 _builder.BuildMessageAndEnumDescriptors(DESCRIPTOR, _globals)
@@ -36,10 +36,24 @@ if not _descriptor._USE_C_DESCRIPTORS:
   _globals['_ITEM']._serialized_end=83
   _globals['_ITEMREPLY']._serialized_start=85
   _globals['_ITEMREPLY']._serialized_end=186
-  _globals['_LISTFILTER']._serialized_start=188
-  _globals['_LISTFILTER']._serialized_end=233
-  _globals['_LISTFILTERREPLY']._serialized_start=235
-  _globals['_LISTFILTERREPLY']._serialized_end=266
-  _globals['_BADGER']._serialized_start=269
-  _globals['_BADGER']._serialized_end=525
+  _globals['_RANGEREQUEST']._serialized_start=188
+  _globals['_RANGEREQUEST']._serialized_end=247
+  _globals['_LISTFILTER']._serialized_start=249
+  _globals['_LISTFILTER']._serialized_end=294
+  _globals['_LISTFILTERREPLY']._serialized_start=296
+  _globals['_LISTFILTERREPLY']._serialized_end=327
+  _globals['_WATCHREQUEST']._serialized_start=329
+  _globals['_WATCHREQUEST']._serialized_end=376
+  _globals['_WATCHEVENT']._serialized_start=378
+  _globals['_WATCHEVENT']._serialized_end=481
+  _globals['_TXNOP']._serialized_start=483
+  _globals['_TXNOP']._serialized_end=575
+  _globals['_TXNREQUEST']._serialized_start=577
+  _globals['_TXNREQUEST']._serialized_end=610
+  _globals['_TXNOPRESULT']._serialized_start=612
+  _globals['_TXNOPRESULT']._serialized_end=686
+  _globals['_TXNREPLY']._serialized_start=688
+  _globals['_TXNREPLY']._serialized_end=777
+  _globals['_BADGER']._serialized_start=780
+  _globals['_BADGER']._serialized_end=1151
 # @@protoc_insertion_point(module_scope)
@@ -39,6 +39,11 @@ class BadgerStub(object):
                 request_serializer=badgerItem__pb2.Item.SerializeToString,
                 response_deserializer=badgerItem__pb2.ItemReply.FromString,
                 _registered_method=True)
+        self.GetRange = channel.unary_unary(
+                '/Badger/GetRange',
+                request_serializer=badgerItem__pb2.RangeRequest.SerializeToString,
+                response_deserializer=badgerItem__pb2.ItemReply.FromString,
+                _registered_method=True)
         self.Set = channel.unary_unary(
                 '/Badger/Set',
                 request_serializer=badgerItem__pb2.Item.SerializeToString,
@@ -74,6 +79,16 @@ class BadgerStub(object):
                 request_serializer=badgerItem__pb2.ListFilter.SerializeToString,
                 response_deserializer=badgerItem__pb2.ListFilterReply.FromString,
                 _registered_method=True)
+        self.Watch = channel.unary_stream(
+                '/Badger/Watch',
+                request_serializer=badgerItem__pb2.WatchRequest.SerializeToString,
+                response_deserializer=badgerItem__pb2.WatchEvent.FromString,
+                _registered_method=True)
+        self.Txn = channel.unary_unary(
+                '/Badger/Txn',
+                request_serializer=badgerItem__pb2.TxnRequest.SerializeToString,
+                response_deserializer=badgerItem__pb2.TxnReply.FromString,
+                _registered_method=True)
 
 
 class BadgerServicer(object):
@@ -85,6 +100,12 @@ class BadgerServicer(object):
         context.set_details('Method not implemented!')
         raise NotImplementedError('Method not implemented!')
 
+    def GetRange(self, request, context):
+        """Missing associated documentation comment in .proto file."""
+        context.set_code(grpc.StatusCode.UNIMPLEMENTED)
+        context.set_details('Method not implemented!')
+        raise NotImplementedError('Method not implemented!')
+
     def Set(self, request, context):
         """Missing associated documentation comment in .proto file."""
         context.set_code(grpc.StatusCode.UNIMPLEMENTED)
@@ -127,6 +148,18 @@ class BadgerServicer(object):
         context.set_details('Method not implemented!')
         raise NotImplementedError('Method not implemented!')
 
+    def Watch(self, request, context):
+        """Missing associated documentation comment in .proto file."""
+        context.set_code(grpc.StatusCode.UNIMPLEMENTED)
+        context.set_details('Method not implemented!')
+        raise NotImplementedError('Method not implemented!')
+
+    def Txn(self, request, context):
+        """Missing associated documentation comment in .proto file."""
+        context.set_code(grpc.StatusCode.UNIMPLEMENTED)
+        context.set_details('Method not implemented!')
+        raise NotImplementedError('Method not implemented!')
+
 
 def add_BadgerServicer_to_server(servicer, server):
     rpc_method_handlers = {
@@ -135,6 +168,11 @@ def add_BadgerServicer_to_server(servicer, server):
                     request_deserializer=badgerItem__pb2.Item.FromString,
                     response_serializer=badgerItem__pb2.ItemReply.SerializeToString,
             ),
+            'GetRange': grpc.unary_unary_rpc_method_handler(
+                    servicer.GetRange,
+                    request_deserializer=badgerItem__pb2.RangeRequest.FromString,
+                    response_serializer=badgerItem__pb2.ItemReply.SerializeToString,
+            ),
             'Set': grpc.unary_unary_rpc_method_handler(
                     servicer.Set,
                     request_deserializer=badgerItem__pb2.Item.FromString,
@@ -170,6 +208,16 @@ def add_BadgerServicer_to_server(servicer, server):
                     request_deserializer=badgerItem__pb2.ListFilter.FromString,
                     response_serializer=badgerItem__pb2.ListFilterReply.SerializeToString,
             ),
+            'Watch': grpc.unary_stream_rpc_method_handler(
+                    servicer.Watch,
+                    request_deserializer=badgerItem__pb2.WatchRequest.FromString,
+                    response_serializer=badgerItem__pb2.WatchEvent.SerializeToString,
+            ),
+            'Txn': grpc.unary_unary_rpc_method_handler(
+                    servicer.Txn,
+                    request_deserializer=badgerItem__pb2.TxnRequest.FromString,
+                    response_serializer=badgerItem__pb2.TxnReply.SerializeToString,
+            ),
     }
     generic_handler = grpc.method_handlers_generic_handler(
             'Badger', rpc_method_handlers)
@@ -208,6 +256,33 @@ class Badger(object):
             metadata,
             _registered_method=True)
 
+    @staticmethod
+    def GetRange(request,
+            target,
+            options=(),
+            channel_credentials=None,
+            call_credentials=None,
+            insecure=False,
+            compression=None,
+            wait_for_ready=None,
+            timeout=None,
+            metadata=None):
+        return grpc.experimental.unary_unary(
+            request,
+            target,
+            '/Badger/GetRange',
+            badgerItem__pb2.RangeRequest.SerializeToString,
+            badgerItem__pb2.ItemReply.FromString,
+            options,
+            channel_credentials,
+            insecure,
+            call_credentials,
+            compression,
+            wait_for_ready,
+            timeout,
+            metadata,
+            _registered_method=True)
+
     @staticmethod
     def Set(request,
             target,
@@ -396,3 +471,57 @@ class Badger(object):
             timeout,
             metadata,
             _registered_method=True)
+
+    @staticmethod
+    def Watch(request,
+            target,
+            options=(),
+            channel_credentials=None,
+            call_credentials=None,
+            insecure=False,
+            compression=None,
+            wait_for_ready=None,
+            timeout=None,
+            metadata=None):
+        return grpc.experimental.unary_stream(
+            request,
+            target,
+            '/Badger/Watch',
+            badgerItem__pb2.WatchRequest.SerializeToString,
+            badgerItem__pb2.WatchEvent.FromString,
+            options,
+            channel_credentials,
+            insecure,
+            call_credentials,
+            compression,
+            wait_for_ready,
+            timeout,
+            metadata,
+            _registered_method=True)
+
+    @staticmethod
+    def Txn(request,
+            target,
+            options=(),
+            channel_credentials=None,
+            call_credentials=None,
+            insecure=False,
+            compression=None,
+            wait_for_ready=None,
+            timeout=None,
+            metadata=None):
+        return grpc.experimental.unary_unary(
+            request,
+            target,
+            '/Badger/Txn',
+            badgerItem__pb2.TxnRequest.SerializeToString,
+            badgerItem__pb2.TxnReply.FromString,
+            options,
+            channel_credentials,
+            insecure,
+            call_credentials,
+            compression,
+            wait_for_ready,
+            timeout,
+            metadata,
+            _registered_method=True)
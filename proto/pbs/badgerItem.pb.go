@@ -175,6 +175,68 @@ func (x *ItemReply) GetSum64() uint64 {
 	return 0
 }
 
+// GetRange reads length bytes of the value of key from offset, length 0
+// reads to the end.
+type RangeRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Key           []byte                 `protobuf:"bytes,1,opt,name=key,proto3" json:"key,omitempty"`
+	Offset        uint64                 `protobuf:"varint,2,opt,name=offset,proto3" json:"offset,omitempty"`
+	Length        uint64                 `protobuf:"varint,3,opt,name=length,proto3" json:"length,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RangeRequest) Reset() {
+	*x = RangeRequest{}
+	mi := &file_badgerItem_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RangeRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RangeRequest) ProtoMessage() {}
+
+func (x *RangeRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_badgerItem_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RangeRequest.ProtoReflect.Descriptor instead.
+func (*RangeRequest) Descriptor() ([]byte, []int) {
+	return file_badgerItem_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *RangeRequest) GetKey() []byte {
+	if x != nil {
+		return x.Key
+	}
+	return nil
+}
+
+func (x *RangeRequest) GetOffset() uint64 {
+	if x != nil {
+		return x.Offset
+	}
+	return 0
+}
+
+func (x *RangeRequest) GetLength() uint64 {
+	if x != nil {
+		return x.Length
+	}
+	return 0
+}
+
 type ListFilter struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	Prefix        string                 `protobuf:"bytes,1,opt,name=prefix,proto3" json:"prefix,omitempty"`
@@ -185,7 +247,7 @@ type ListFilter struct {
 
 func (x *ListFilter) Reset() {
 	*x = ListFilter{}
-	mi := &file_badgerItem_proto_msgTypes[2]
+	mi := &file_badgerItem_proto_msgTypes[3]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -197,7 +259,7 @@ func (x *ListFilter) String() string {
 func (*ListFilter) ProtoMessage() {}
 
 func (x *ListFilter) ProtoReflect() protoreflect.Message {
-	mi := &file_badgerItem_proto_msgTypes[2]
+	mi := &file_badgerItem_proto_msgTypes[3]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -210,7 +272,7 @@ func (x *ListFilter) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use ListFilter.ProtoReflect.Descriptor instead.
 func (*ListFilter) Descriptor() ([]byte, []int) {
-	return file_badgerItem_proto_rawDescGZIP(), []int{2}
+	return file_badgerItem_proto_rawDescGZIP(), []int{3}
 }
 
 func (x *ListFilter) GetPrefix() string {
@@ -236,7 +298,7 @@ type ListFilterReply struct {
 
 func (x *ListFilterReply) Reset() {
 	*x = ListFilterReply{}
-	mi := &file_badgerItem_proto_msgTypes[3]
+	mi := &file_badgerItem_proto_msgTypes[4]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -248,7 +310,7 @@ func (x *ListFilterReply) String() string {
 func (*ListFilterReply) ProtoMessage() {}
 
 func (x *ListFilterReply) ProtoReflect() protoreflect.Message {
-	mi := &file_badgerItem_proto_msgTypes[3]
+	mi := &file_badgerItem_proto_msgTypes[4]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -261,7 +323,7 @@ func (x *ListFilterReply) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use ListFilterReply.ProtoReflect.Descriptor instead.
 func (*ListFilterReply) Descriptor() ([]byte, []int) {
-	return file_badgerItem_proto_rawDescGZIP(), []int{3}
+	return file_badgerItem_proto_rawDescGZIP(), []int{4}
 }
 
 func (x *ListFilterReply) GetKeys() []string {
@@ -271,6 +333,415 @@ func (x *ListFilterReply) GetKeys() []string {
 	return nil
 }
 
+// Watch sends the Set/Delete events of keys starting with one of prefixes
+// (all keys if empty), after version since (only new events if 0).
+type WatchRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Prefixes      []string               `protobuf:"bytes,1,rep,name=prefixes,proto3" json:"prefixes,omitempty"`
+	Since         uint64                 `protobuf:"varint,2,opt,name=since,proto3" json:"since,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *WatchRequest) Reset() {
+	*x = WatchRequest{}
+	mi := &file_badgerItem_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *WatchRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WatchRequest) ProtoMessage() {}
+
+func (x *WatchRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_badgerItem_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WatchRequest.ProtoReflect.Descriptor instead.
+func (*WatchRequest) Descriptor() ([]byte, []int) {
+	return file_badgerItem_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *WatchRequest) GetPrefixes() []string {
+	if x != nil {
+		return x.Prefixes
+	}
+	return nil
+}
+
+func (x *WatchRequest) GetSince() uint64 {
+	if x != nil {
+		return x.Since
+	}
+	return 0
+}
+
+// type is "set", "delete", or "synced" once the events before ver64 are
+// sent; change logs of older versions may hold "delete-prefix" (key is the
+// prefix).
+type WatchEvent struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Type          string                 `protobuf:"bytes,1,opt,name=type,proto3" json:"type,omitempty"`
+	Key           []byte                 `protobuf:"bytes,2,opt,name=key,proto3" json:"key,omitempty"`
+	Ver64         uint64                 `protobuf:"varint,3,opt,name=ver64,proto3" json:"ver64,omitempty"`
+	Size          uint64                 `protobuf:"varint,4,opt,name=size,proto3" json:"size,omitempty"`
+	Sum64         uint64                 `protobuf:"varint,5,opt,name=sum64,proto3" json:"sum64,omitempty"`
+	UnixMilli     int64                  `protobuf:"varint,6,opt,name=unix_milli,json=unixMilli,proto3" json:"unix_milli,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *WatchEvent) Reset() {
+	*x = WatchEvent{}
+	mi := &file_badgerItem_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *WatchEvent) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WatchEvent) ProtoMessage() {}
+
+func (x *WatchEvent) ProtoReflect() protoreflect.Message {
+	mi := &file_badgerItem_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WatchEvent.ProtoReflect.Descriptor instead.
+func (*WatchEvent) Descriptor() ([]byte, []int) {
+	return file_badgerItem_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *WatchEvent) GetType() string {
+	if x != nil {
+		return x.Type
+	}
+	return ""
+}
+
+func (x *WatchEvent) GetKey() []byte {
+	if x != nil {
+		return x.Key
+	}
+	return nil
+}
+
+func (x *WatchEvent) GetVer64() uint64 {
+	if x != nil {
+		return x.Ver64
+	}
+	return 0
+}
+
+func (x *WatchEvent) GetSize() uint64 {
+	if x != nil {
+		return x.Size
+	}
+	return 0
+}
+
+func (x *WatchEvent) GetSum64() uint64 {
+	if x != nil {
+		return x.Sum64
+	}
+	return 0
+}
+
+func (x *WatchEvent) GetUnixMilli() int64 {
+	if x != nil {
+		return x.UnixMilli
+	}
+	return 0
+}
+
+// op is "put", "delete" or "check". A check needs the key at version ver64
+// (if not 0) and, with exists 1/-1, the key to exist or not.
+type TxnOp struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Op            string                 `protobuf:"bytes,1,opt,name=op,proto3" json:"op,omitempty"`
+	Key           []byte                 `protobuf:"bytes,2,opt,name=key,proto3" json:"key,omitempty"`
+	Data          []byte                 `protobuf:"bytes,3,opt,name=data,proto3" json:"data,omitempty"`
+	Sum64         uint64                 `protobuf:"varint,4,opt,name=sum64,proto3" json:"sum64,omitempty"`
+	Ver64         uint64                 `protobuf:"varint,5,opt,name=ver64,proto3" json:"ver64,omitempty"`
+	Exists        int32                  `protobuf:"varint,6,opt,name=exists,proto3" json:"exists,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *TxnOp) Reset() {
+	*x = TxnOp{}
+	mi := &file_badgerItem_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *TxnOp) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TxnOp) ProtoMessage() {}
+
+func (x *TxnOp) ProtoReflect() protoreflect.Message {
+	mi := &file_badgerItem_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TxnOp.ProtoReflect.Descriptor instead.
+func (*TxnOp) Descriptor() ([]byte, []int) {
+	return file_badgerItem_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *TxnOp) GetOp() string {
+	if x != nil {
+		return x.Op
+	}
+	return ""
+}
+
+func (x *TxnOp) GetKey() []byte {
+	if x != nil {
+		return x.Key
+	}
+	return nil
+}
+
+func (x *TxnOp) GetData() []byte {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+func (x *TxnOp) GetSum64() uint64 {
+	if x != nil {
+		return x.Sum64
+	}
+	return 0
+}
+
+func (x *TxnOp) GetVer64() uint64 {
+	if x != nil {
+		return x.Ver64
+	}
+	return 0
+}
+
+func (x *TxnOp) GetExists() int32 {
+	if x != nil {
+		return x.Exists
+	}
+	return 0
+}
+
+type TxnRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Ops           []*TxnOp               `protobuf:"bytes,1,rep,name=ops,proto3" json:"ops,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *TxnRequest) Reset() {
+	*x = TxnRequest{}
+	mi := &file_badgerItem_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *TxnRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TxnRequest) ProtoMessage() {}
+
+func (x *TxnRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_badgerItem_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TxnRequest.ProtoReflect.Descriptor instead.
+func (*TxnRequest) Descriptor() ([]byte, []int) {
+	return file_badgerItem_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *TxnRequest) GetOps() []*TxnOp {
+	if x != nil {
+		return x.Ops
+	}
+	return nil
+}
+
+type TxnOpResult struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Errcode       int32                  `protobuf:"varint,1,opt,name=errcode,proto3" json:"errcode,omitempty"`
+	Status        []byte                 `protobuf:"bytes,2,opt,name=status,proto3" json:"status,omitempty"`
+	Key           []byte                 `protobuf:"bytes,3,opt,name=key,proto3" json:"key,omitempty"`
+	Ver64         uint64                 `protobuf:"varint,4,opt,name=ver64,proto3" json:"ver64,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *TxnOpResult) Reset() {
+	*x = TxnOpResult{}
+	mi := &file_badgerItem_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *TxnOpResult) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TxnOpResult) ProtoMessage() {}
+
+func (x *TxnOpResult) ProtoReflect() protoreflect.Message {
+	mi := &file_badgerItem_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TxnOpResult.ProtoReflect.Descriptor instead.
+func (*TxnOpResult) Descriptor() ([]byte, []int) {
+	return file_badgerItem_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *TxnOpResult) GetErrcode() int32 {
+	if x != nil {
+		return x.Errcode
+	}
+	return 0
+}
+
+func (x *TxnOpResult) GetStatus() []byte {
+	if x != nil {
+		return x.Status
+	}
+	return nil
+}
+
+func (x *TxnOpResult) GetKey() []byte {
+	if x != nil {
+		return x.Key
+	}
+	return nil
+}
+
+func (x *TxnOpResult) GetVer64() uint64 {
+	if x != nil {
+		return x.Ver64
+	}
+	return 0
+}
+
+// errcode is 0 if every op is applied, none is applied otherwise;
+// 409 means a conflict with another write, retry the whole Txn.
+type TxnReply struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Errcode       int32                  `protobuf:"varint,1,opt,name=errcode,proto3" json:"errcode,omitempty"`
+	Status        []byte                 `protobuf:"bytes,2,opt,name=status,proto3" json:"status,omitempty"`
+	Results       []*TxnOpResult         `protobuf:"bytes,3,rep,name=results,proto3" json:"results,omitempty"`
+	Ver64         uint64                 `protobuf:"varint,4,opt,name=ver64,proto3" json:"ver64,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *TxnReply) Reset() {
+	*x = TxnReply{}
+	mi := &file_badgerItem_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *TxnReply) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TxnReply) ProtoMessage() {}
+
+func (x *TxnReply) ProtoReflect() protoreflect.Message {
+	mi := &file_badgerItem_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TxnReply.ProtoReflect.Descriptor instead.
+func (*TxnReply) Descriptor() ([]byte, []int) {
+	return file_badgerItem_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *TxnReply) GetErrcode() int32 {
+	if x != nil {
+		return x.Errcode
+	}
+	return 0
+}
+
+func (x *TxnReply) GetStatus() []byte {
+	if x != nil {
+		return x.Status
+	}
+	return nil
+}
+
+func (x *TxnReply) GetResults() []*TxnOpResult {
+	if x != nil {
+		return x.Results
+	}
+	return nil
+}
+
+func (x *TxnReply) GetVer64() uint64 {
+	if x != nil {
+		return x.Ver64
+	}
+	return 0
+}
+
 var File_badgerItem_proto protoreflect.FileDescriptor
 
 const file_badgerItem_proto_rawDesc = "" +
@@ -287,15 +758,53 @@ const file_badgerItem_proto_rawDesc = "" +
 	"\x03key\x18\x03 \x01(\fR\x03key\x12\x12\n" +
 	"\x04data\x18\x04 \x01(\fR\x04data\x12\x14\n" +
 	"\x05ver64\x18\x05 \x01(\x04R\x05ver64\x12\x14\n" +
-	"\x05sum64\x18\x06 \x01(\x04R\x05sum64\">\n" +
+	"\x05sum64\x18\x06 \x01(\x04R\x05sum64\"P\n" +
+	"\fRangeRequest\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\fR\x03key\x12\x16\n" +
+	"\x06offset\x18\x02 \x01(\x04R\x06offset\x12\x16\n" +
+	"\x06length\x18\x03 \x01(\x04R\x06length\">\n" +
 	"\n" +
 	"ListFilter\x12\x16\n" +
 	"\x06prefix\x18\x01 \x01(\tR\x06prefix\x12\x18\n" +
 	"\apagenum\x18\x02 \x01(\x05R\apagenum\"%\n" +
 	"\x0fListFilterReply\x12\x12\n" +
-	"\x04keys\x18\x01 \x03(\tR\x04keys2\x80\x02\n" +
+	"\x04keys\x18\x01 \x03(\tR\x04keys\"@\n" +
+	"\fWatchRequest\x12\x1a\n" +
+	"\bprefixes\x18\x01 \x03(\tR\bprefixes\x12\x14\n" +
+	"\x05since\x18\x02 \x01(\x04R\x05since\"\x91\x01\n" +
+	"\n" +
+	"WatchEvent\x12\x12\n" +
+	"\x04type\x18\x01 \x01(\tR\x04type\x12\x10\n" +
+	"\x03key\x18\x02 \x01(\fR\x03key\x12\x14\n" +
+	"\x05ver64\x18\x03 \x01(\x04R\x05ver64\x12\x12\n" +
+	"\x04size\x18\x04 \x01(\x04R\x04size\x12\x14\n" +
+	"\x05sum64\x18\x05 \x01(\x04R\x05sum64\x12\x1d\n" +
+	"\n" +
+	"unix_milli\x18\x06 \x01(\x03R\tunixMilli\"\x81\x01\n" +
+	"\x05TxnOp\x12\x0e\n" +
+	"\x02op\x18\x01 \x01(\tR\x02op\x12\x10\n" +
+	"\x03key\x18\x02 \x01(\fR\x03key\x12\x12\n" +
+	"\x04data\x18\x03 \x01(\fR\x04data\x12\x14\n" +
+	"\x05sum64\x18\x04 \x01(\x04R\x05sum64\x12\x14\n" +
+	"\x05ver64\x18\x05 \x01(\x04R\x05ver64\x12\x16\n" +
+	"\x06exists\x18\x06 \x01(\x05R\x06exists\"&\n" +
+	"\n" +
+	"TxnRequest\x12\x18\n" +
+	"\x03ops\x18\x01 \x03(\v2\x06.TxnOpR\x03ops\"g\n" +
+	"\vTxnOpResult\x12\x18\n" +
+	"\aerrcode\x18\x01 \x01(\x05R\aerrcode\x12\x16\n" +
+	"\x06status\x18\x02 \x01(\fR\x06status\x12\x10\n" +
+	"\x03key\x18\x03 \x01(\fR\x03key\x12\x14\n" +
+	"\x05ver64\x18\x04 \x01(\x04R\x05ver64\"z\n" +
+	"\bTxnReply\x12\x18\n" +
+	"\aerrcode\x18\x01 \x01(\x05R\aerrcode\x12\x16\n" +
+	"\x06status\x18\x02 \x01(\fR\x06status\x12&\n" +
+	"\aresults\x18\x03 \x03(\v2\f.TxnOpResultR\aresults\x12\x14\n" +
+	"\x05ver64\x18\x04 \x01(\x04R\x05ver642\xf3\x02\n" +
 	"\x06Badger\x12\x1a\n" +
 	"\x03Get\x12\x05.Item\x1a\n" +
+	".ItemReply\"\x00\x12'\n" +
+	"\bGetRange\x12\r.RangeRequest\x1a\n" +
 	".ItemReply\"\x00\x12\x1a\n" +
 	"\x03Set\x12\x05.Item\x1a\n" +
 	".ItemReply\"\x00\x12\x1d\n" +
@@ -309,7 +818,9 @@ const file_badgerItem_proto_rawDesc = "" +
 	".ItemReply\"\x00\x12\x1b\n" +
 	"\x04Ping\x12\x05.Item\x1a\n" +
 	".ItemReply\"\x00\x12'\n" +
-	"\x04List\x12\v.ListFilter\x1a\x10.ListFilterReply\"\x00B Z\x1egithub.com/harryzhu/zstdfs/pbsb\x06proto3"
+	"\x04List\x12\v.ListFilter\x1a\x10.ListFilterReply\"\x00\x12'\n" +
+	"\x05Watch\x12\r.WatchRequest\x1a\v.WatchEvent\"\x000\x01\x12\x1f\n" +
+	"\x03Txn\x12\v.TxnRequest\x1a\t.TxnReply\"\x00B Z\x1egithub.com/harryzhu/zstdfs/pbsb\x06proto3"
 
 var (
 	file_badgerItem_proto_rawDescOnce sync.Once
@@ -323,35 +834,50 @@ func file_badgerItem_proto_rawDescGZIP() []byte {
 	return file_badgerItem_proto_rawDescData
 }
 
-var file_badgerItem_proto_msgTypes = make([]protoimpl.MessageInfo, 4)
+var file_badgerItem_proto_msgTypes = make([]protoimpl.MessageInfo, 11)
 var file_badgerItem_proto_goTypes = []any{
 	(*Item)(nil),            // 0: Item
 	(*ItemReply)(nil),       // 1: ItemReply
-	(*ListFilter)(nil),      // 2: ListFilter
-	(*ListFilterReply)(nil), // 3: ListFilterReply
+	(*RangeRequest)(nil),    // 2: RangeRequest
+	(*ListFilter)(nil),      // 3: ListFilter
+	(*ListFilterReply)(nil), // 4: ListFilterReply
+	(*WatchRequest)(nil),    // 5: WatchRequest
+	(*WatchEvent)(nil),      // 6: WatchEvent
+	(*TxnOp)(nil),           // 7: TxnOp
+	(*TxnRequest)(nil),      // 8: TxnRequest
+	(*TxnOpResult)(nil),     // 9: TxnOpResult
+	(*TxnReply)(nil),        // 10: TxnReply
 }
 var file_badgerItem_proto_depIdxs = []int32{
-	0, // 0: Badger.Get:input_type -> Item
-	0, // 1: Badger.Set:input_type -> Item
-	0, // 2: Badger.Delete:input_type -> Item
-	0, // 3: Badger.Exists:input_type -> Item
-	0, // 4: Badger.Count:input_type -> Item
-	0, // 5: Badger.Admin:input_type -> Item
-	0, // 6: Badger.Ping:input_type -> Item
-	2, // 7: Badger.List:input_type -> ListFilter
-	1, // 8: Badger.Get:output_type -> ItemReply
-	1, // 9: Badger.Set:output_type -> ItemReply
-	1, // 10: Badger.Delete:output_type -> ItemReply
-	1, // 11: Badger.Exists:output_type -> ItemReply
-	1, // 12: Badger.Count:output_type -> ItemReply
-	1, // 13: Badger.Admin:output_type -> ItemReply
-	1, // 14: Badger.Ping:output_type -> ItemReply
-	3, // 15: Badger.List:output_type -> ListFilterReply
-	8, // [8:16] is the sub-list for method output_type
-	0, // [0:8] is the sub-list for method input_type
-	0, // [0:0] is the sub-list for extension type_name
-	0, // [0:0] is the sub-list for extension extendee
-	0, // [0:0] is the sub-list for field type_name
+	7,  // 0: TxnRequest.ops:type_name -> TxnOp
+	9,  // 1: TxnReply.results:type_name -> TxnOpResult
+	0,  // 2: Badger.Get:input_type -> Item
+	2,  // 3: Badger.GetRange:input_type -> RangeRequest
+	0,  // 4: Badger.Set:input_type -> Item
+	0,  // 5: Badger.Delete:input_type -> Item
+	0,  // 6: Badger.Exists:input_type -> Item
+	0,  // 7: Badger.Count:input_type -> Item
+	0,  // 8: Badger.Admin:input_type -> Item
+	0,  // 9: Badger.Ping:input_type -> Item
+	3,  // 10: Badger.List:input_type -> ListFilter
+	5,  // 11: Badger.Watch:input_type -> WatchRequest
+	8,  // 12: Badger.Txn:input_type -> TxnRequest
+	1,  // 13: Badger.Get:output_type -> ItemReply
+	1,  // 14: Badger.GetRange:output_type -> ItemReply
+	1,  // 15: Badger.Set:output_type -> ItemReply
+	1,  // 16: Badger.Delete:output_type -> ItemReply
+	1,  // 17: Badger.Exists:output_type -> ItemReply
+	1,  // 18: Badger.Count:output_type -> ItemReply
+	1,  // 19: Badger.Admin:output_type -> ItemReply
+	1,  // 20: Badger.Ping:output_type -> ItemReply
+	4,  // 21: Badger.List:output_type -> ListFilterReply
+	6,  // 22: Badger.Watch:output_type -> WatchEvent
+	10, // 23: Badger.Txn:output_type -> TxnReply
+	13, // [13:24] is the sub-list for method output_type
+	2,  // [2:13] is the sub-list for method input_type
+	2,  // [2:2] is the sub-list for extension type_name
+	2,  // [2:2] is the sub-list for extension extendee
+	0,  // [0:2] is the sub-list for field type_name
 }
 
 func init() { file_badgerItem_proto_init() }
@@ -365,7 +891,7 @@ func file_badgerItem_proto_init() {
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_badgerItem_proto_rawDesc), len(file_badgerItem_proto_rawDesc)),
 			NumEnums:      0,
-			NumMessages:   4,
+			NumMessages:   11,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
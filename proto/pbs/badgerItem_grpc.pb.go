@@ -19,14 +19,17 @@ import (
 const _ = grpc.SupportPackageIsVersion9
 
 const (
-	Badger_Get_FullMethodName    = "/Badger/Get"
-	Badger_Set_FullMethodName    = "/Badger/Set"
-	Badger_Delete_FullMethodName = "/Badger/Delete"
-	Badger_Exists_FullMethodName = "/Badger/Exists"
-	Badger_Count_FullMethodName  = "/Badger/Count"
-	Badger_Admin_FullMethodName  = "/Badger/Admin"
-	Badger_Ping_FullMethodName   = "/Badger/Ping"
-	Badger_List_FullMethodName   = "/Badger/List"
+	Badger_Get_FullMethodName      = "/Badger/Get"
+	Badger_GetRange_FullMethodName = "/Badger/GetRange"
+	Badger_Set_FullMethodName      = "/Badger/Set"
+	Badger_Delete_FullMethodName   = "/Badger/Delete"
+	Badger_Exists_FullMethodName   = "/Badger/Exists"
+	Badger_Count_FullMethodName    = "/Badger/Count"
+	Badger_Admin_FullMethodName    = "/Badger/Admin"
+	Badger_Ping_FullMethodName     = "/Badger/Ping"
+	Badger_List_FullMethodName     = "/Badger/List"
+	Badger_Watch_FullMethodName    = "/Badger/Watch"
+	Badger_Txn_FullMethodName      = "/Badger/Txn"
 )
 
 // BadgerClient is the client API for Badger service.
@@ -34,6 +37,7 @@ const (
 // For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
 type BadgerClient interface {
 	Get(ctx context.Context, in *Item, opts ...grpc.CallOption) (*ItemReply, error)
+	GetRange(ctx context.Context, in *RangeRequest, opts ...grpc.CallOption) (*ItemReply, error)
 	Set(ctx context.Context, in *Item, opts ...grpc.CallOption) (*ItemReply, error)
 	Delete(ctx context.Context, in *Item, opts ...grpc.CallOption) (*ItemReply, error)
 	Exists(ctx context.Context, in *Item, opts ...grpc.CallOption) (*ItemReply, error)
@@ -41,6 +45,8 @@ type BadgerClient interface {
 	Admin(ctx context.Context, in *Item, opts ...grpc.CallOption) (*ItemReply, error)
 	Ping(ctx context.Context, in *Item, opts ...grpc.CallOption) (*ItemReply, error)
 	List(ctx context.Context, in *ListFilter, opts ...grpc.CallOption) (*ListFilterReply, error)
+	Watch(ctx context.Context, in *WatchRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[WatchEvent], error)
+	Txn(ctx context.Context, in *TxnRequest, opts ...grpc.CallOption) (*TxnReply, error)
 }
 
 type badgerClient struct {
@@ -61,6 +67,16 @@ func (c *badgerClient) Get(ctx context.Context, in *Item, opts ...grpc.CallOptio
 	return out, nil
 }
 
+func (c *badgerClient) GetRange(ctx context.Context, in *RangeRequest, opts ...grpc.CallOption) (*ItemReply, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ItemReply)
+	err := c.cc.Invoke(ctx, Badger_GetRange_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 func (c *badgerClient) Set(ctx context.Context, in *Item, opts ...grpc.CallOption) (*ItemReply, error) {
 	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
 	out := new(ItemReply)
@@ -131,11 +147,41 @@ func (c *badgerClient) List(ctx context.Context, in *ListFilter, opts ...grpc.Ca
 	return out, nil
 }
 
+func (c *badgerClient) Watch(ctx context.Context, in *WatchRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[WatchEvent], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Badger_ServiceDesc.Streams[0], Badger_Watch_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[WatchRequest, WatchEvent]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Badger_WatchClient = grpc.ServerStreamingClient[WatchEvent]
+
+func (c *badgerClient) Txn(ctx context.Context, in *TxnRequest, opts ...grpc.CallOption) (*TxnReply, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(TxnReply)
+	err := c.cc.Invoke(ctx, Badger_Txn_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // BadgerServer is the server API for Badger service.
 // All implementations must embed UnimplementedBadgerServer
 // for forward compatibility.
 type BadgerServer interface {
 	Get(context.Context, *Item) (*ItemReply, error)
+	GetRange(context.Context, *RangeRequest) (*ItemReply, error)
 	Set(context.Context, *Item) (*ItemReply, error)
 	Delete(context.Context, *Item) (*ItemReply, error)
 	Exists(context.Context, *Item) (*ItemReply, error)
@@ -143,6 +189,8 @@ type BadgerServer interface {
 	Admin(context.Context, *Item) (*ItemReply, error)
 	Ping(context.Context, *Item) (*ItemReply, error)
 	List(context.Context, *ListFilter) (*ListFilterReply, error)
+	Watch(*WatchRequest, grpc.ServerStreamingServer[WatchEvent]) error
+	Txn(context.Context, *TxnRequest) (*TxnReply, error)
 	mustEmbedUnimplementedBadgerServer()
 }
 
@@ -156,6 +204,9 @@ type UnimplementedBadgerServer struct{}
 func (UnimplementedBadgerServer) Get(context.Context, *Item) (*ItemReply, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method Get not implemented")
 }
+func (UnimplementedBadgerServer) GetRange(context.Context, *RangeRequest) (*ItemReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetRange not implemented")
+}
 func (UnimplementedBadgerServer) Set(context.Context, *Item) (*ItemReply, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method Set not implemented")
 }
@@ -177,6 +228,12 @@ func (UnimplementedBadgerServer) Ping(context.Context, *Item) (*ItemReply, error
 func (UnimplementedBadgerServer) List(context.Context, *ListFilter) (*ListFilterReply, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method List not implemented")
 }
+func (UnimplementedBadgerServer) Watch(*WatchRequest, grpc.ServerStreamingServer[WatchEvent]) error {
+	return status.Errorf(codes.Unimplemented, "method Watch not implemented")
+}
+func (UnimplementedBadgerServer) Txn(context.Context, *TxnRequest) (*TxnReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Txn not implemented")
+}
 func (UnimplementedBadgerServer) mustEmbedUnimplementedBadgerServer() {}
 func (UnimplementedBadgerServer) testEmbeddedByValue()                {}
 
@@ -216,6 +273,24 @@ func _Badger_Get_Handler(srv interface{}, ctx context.Context, dec func(interfac
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Badger_GetRange_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RangeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BadgerServer).GetRange(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Badger_GetRange_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BadgerServer).GetRange(ctx, req.(*RangeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 func _Badger_Set_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
 	in := new(Item)
 	if err := dec(in); err != nil {
@@ -342,6 +417,35 @@ func _Badger_List_Handler(srv interface{}, ctx context.Context, dec func(interfa
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Badger_Watch_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(BadgerServer).Watch(m, &grpc.GenericServerStream[WatchRequest, WatchEvent]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Badger_WatchServer = grpc.ServerStreamingServer[WatchEvent]
+
+func _Badger_Txn_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(TxnRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BadgerServer).Txn(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Badger_Txn_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BadgerServer).Txn(ctx, req.(*TxnRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // Badger_ServiceDesc is the grpc.ServiceDesc for Badger service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -353,6 +457,10 @@ var Badger_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "Get",
 			Handler:    _Badger_Get_Handler,
 		},
+		{
+			MethodName: "GetRange",
+			Handler:    _Badger_GetRange_Handler,
+		},
 		{
 			MethodName: "Set",
 			Handler:    _Badger_Set_Handler,
@@ -381,7 +489,17 @@ var Badger_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "List",
 			Handler:    _Badger_List_Handler,
 		},
+		{
+			MethodName: "Txn",
+			Handler:    _Badger_Txn_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Watch",
+			Handler:       _Badger_Watch_Handler,
+			ServerStreams: true,
+		},
 	},
-	Streams:  []grpc.StreamDesc{},
 	Metadata: "badgerItem.proto",
 }